@@ -0,0 +1,220 @@
+// Package api exposes the watchlists, the search and the price history of the service as a JSON API.
+//
+// Every endpoint but the spec requires the token of a user, obtained through the bots, in the Authorization header:
+//
+//	Authorization: Bearer <token>
+package api
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/giornetta/watchazon"
+	"github.com/giornetta/watchazon/service"
+)
+
+// Prefix is the path the API is served under.
+const Prefix = "/api/v1"
+
+//go:embed openapi.yaml
+var spec []byte
+
+// Server handles the requests to the API.
+type Server struct {
+	service watchazon.Service
+	mux     *http.ServeMux
+}
+
+func New(svc watchazon.Service) *Server {
+	s := &Server{
+		service: svc,
+		mux:     http.NewServeMux(),
+	}
+
+	s.mux.HandleFunc(Prefix+"/openapi.yaml", s.handleSpec)
+	s.mux.HandleFunc(Prefix+"/watchlist", s.authenticated(s.handleWatchList))
+	s.mux.HandleFunc(Prefix+"/search", s.authenticated(s.handleSearch))
+	s.mux.HandleFunc(Prefix+"/history", s.authenticated(s.handleHistory))
+
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// authenticated passes to h the user the token of the request belongs to.
+func (s *Server) authenticated(h func(w http.ResponseWriter, r *http.Request, userID int64)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		userID, err := s.service.Authenticate(r.Context(), token)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		h(w, r, userID)
+	}
+}
+
+func (s *Server) handleSpec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/yaml")
+	_, _ = w.Write(spec)
+}
+
+func (s *Server) handleWatchList(w http.ResponseWriter, r *http.Request, userID int64) {
+	switch r.Method {
+	case http.MethodGet:
+		products, err := s.service.GetUserWatchList(r.Context(), userID)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, newProducts(products))
+	case http.MethodPost:
+		var req struct {
+			Link string `json:"link"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, errBadRequest)
+			return
+		}
+
+		product, err := s.service.AddToWatchList(r.Context(), req.Link, userID)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		writeJSON(w, http.StatusCreated, newProduct(product))
+	case http.MethodDelete:
+		link := r.URL.Query().Get("link")
+		if link == "" {
+			writeError(w, errBadRequest)
+			return
+		}
+
+		if err := s.service.RemoveFromWatchList(r.Context(), link, userID); err != nil {
+			writeError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, errMethodNotAllowed)
+	}
+}
+
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request, _ int64) {
+	if r.Method != http.MethodGet {
+		writeError(w, errMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query().Get("q")
+	domain := watchazon.Domain(r.URL.Query().Get("domain"))
+	if domain == "" {
+		domain = watchazon.DefaultDomain
+	}
+	if _, ok := watchazon.LookupMarketplace(domain); query == "" || !ok {
+		writeError(w, errBadRequest)
+		return
+	}
+
+	products, err := s.service.Search(r.Context(), query, domain)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newProducts(products))
+}
+
+func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request, userID int64) {
+	if r.Method != http.MethodGet {
+		writeError(w, errMethodNotAllowed)
+		return
+	}
+
+	link := r.URL.Query().Get("link")
+	if link == "" {
+		writeError(w, errBadRequest)
+		return
+	}
+
+	var since time.Time
+	if v := r.URL.Query().Get("since"); v != "" {
+		var err error
+		if since, err = time.Parse(time.RFC3339, v); err != nil {
+			writeError(w, errBadRequest)
+			return
+		}
+	}
+
+	// Only the history of watched products can be seen, as for the bots.
+	if err := checkWatched(r.Context(), s.service, userID, link); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	points, err := s.service.PriceHistory(r.Context(), link, since)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := make([]PricePoint, 0, len(points))
+	for _, p := range points {
+		res = append(res, PricePoint{Price: newPrice(p.Price), CheckedAt: p.CheckedAt})
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// checkWatched returns service.ErrNotWatched if the user doesn't have the product in its watchlist.
+// The link needn't be the one of the watchlist, the service sanitizes it.
+func checkWatched(ctx context.Context, svc watchazon.Service, userID int64, link string) error {
+	_, err := svc.AlertRule(ctx, link, userID)
+	return err
+}
+
+var (
+	errBadRequest       = errors.New("bad request")
+	errMethodNotAllowed = errors.New("method not allowed")
+)
+
+// writeError answers with the error, using the status code matching it.
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, errBadRequest), errors.Is(err, service.ErrInvalidLink), errors.Is(err, service.ErrInvalidRule):
+		status = http.StatusBadRequest
+	case errors.Is(err, service.ErrUnauthorized):
+		status = http.StatusUnauthorized
+	case errors.Is(err, service.ErrNotFound), errors.Is(err, service.ErrNotWatched), errors.Is(err, watchazon.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, errMethodNotAllowed):
+		status = http.StatusMethodNotAllowed
+	case errors.Is(err, service.ErrBlocked):
+		status = http.StatusServiceUnavailable
+	default:
+		slog.Error("api error", "error", err)
+		err = service.ErrInternal
+	}
+
+	writeJSON(w, status, Error{Error: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("could not write response", "error", err)
+	}
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/giornetta/watchazon"
+	"github.com/giornetta/watchazon/memory"
+	"github.com/giornetta/watchazon/scraper"
+	"github.com/giornetta/watchazon/service"
+)
+
+const link = "https://www.amazon.it/dp/B07PHPXHQS"
+
+func newServer(t *testing.T) (*httptest.Server, string) {
+	t.Helper()
+
+	store := memory.New()
+	price := watchazon.Money{Amount: 4999, Currency: "EUR"}
+	if err := store.Insert(context.Background(), &watchazon.Product{Title: "Echo Dot", Link: link, Price: price}, 1); err != nil {
+		t.Fatalf("could not insert product: %v", err)
+	}
+	if err := store.AppendPrice(context.Background(), link, watchazon.PricePoint{Price: price, CheckedAt: time.Now()}); err != nil {
+		t.Fatalf("could not append price: %v", err)
+	}
+
+	svc := service.New(scraper.New(), store, 1)
+	token, err := svc.NewAPIToken(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("could not create token: %v", err)
+	}
+
+	server := httptest.NewServer(New(svc))
+	t.Cleanup(server.Close)
+
+	return server, token
+}
+
+func TestServer(t *testing.T) {
+	server, token := newServer(t)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		token      string
+		wantStatus int
+		wantBody   string
+	}{
+		{"Spec", http.MethodGet, "/openapi.yaml", "", "", http.StatusOK, "openapi: 3.0.3"},
+		{"No token", http.MethodGet, "/watchlist", "", "", http.StatusUnauthorized, `"error":"invalid api token"`},
+		{"Invalid token", http.MethodGet, "/watchlist", "", "invalid", http.StatusUnauthorized, ""},
+		{"Watchlist", http.MethodGet, "/watchlist", "", token, http.StatusOK, `"price":{"amount":4999,"currency":"EUR","formatted":"49.99 €"}`},
+		{"Watch invalid link", http.MethodPost, "/watchlist", `{"link": "https://example.com"}`, token, http.StatusBadRequest, `"error":"invalid link"`},
+		{"Watch malformed", http.MethodPost, "/watchlist", `{`, token, http.StatusBadRequest, ""},
+		{"Watch link ending in dp", http.MethodPost, "/watchlist", `{"link": "https://www.amazon.it/dp"}`, token, http.StatusBadRequest, `"error":"invalid link"`},
+		{"Watch link ending in product", http.MethodPost, "/watchlist", `{"link": "https://www.amazon.it/gp/product"}`, token, http.StatusBadRequest, `"error":"invalid link"`},
+		{"Watch redirect without url", http.MethodPost, "/watchlist", `{"link": "https://www.amazon.it/gp/slredirect/picassoRedirect.html"}`, token, http.StatusBadRequest, `"error":"invalid link"`},
+		{"History", http.MethodGet, "/history?link=" + url.QueryEscape(link), "", token, http.StatusOK, `"amount":4999`},
+		{"History long link", http.MethodGet, "/history?link=" + url.QueryEscape("https://amazon.it/Echo-Dot/dp/B07PHPXHQS/ref=sr_1_1?th=1"), "", token, http.StatusOK, `"amount":4999`},
+		{"History invalid link", http.MethodGet, "/history?link=" + url.QueryEscape("https://www.amazon.it/dp"), "", token, http.StatusBadRequest, `"error":"invalid link"`},
+		{"History not watched", http.MethodGet, "/history?link=" + url.QueryEscape("https://www.amazon.it/dp/B07VJRZ62R"), "", token, http.StatusNotFound, ""},
+		{"History invalid since", http.MethodGet, "/history?since=yesterday&link=" + url.QueryEscape(link), "", token, http.StatusBadRequest, ""},
+		{"Search without query", http.MethodGet, "/search", "", token, http.StatusBadRequest, ""},
+		{"Search unknown domain", http.MethodGet, "/search?q=echo&domain=xyz", "", token, http.StatusBadRequest, ""},
+		{"Method not allowed", http.MethodPut, "/watchlist", "", token, http.StatusMethodNotAllowed, ""},
+		{"Unwatch link ending in dp", http.MethodDelete, "/watchlist?link=" + url.QueryEscape("https://www.amazon.it/dp"), "", token, http.StatusBadRequest, `"error":"invalid link"`},
+		// The link is sanitized as when watching the product.
+		{"Unwatch", http.MethodDelete, "/watchlist?link=" + url.QueryEscape("https://amazon.it/Echo-Dot/dp/B07PHPXHQS/ref=sr_1_1"), "", token, http.StatusNoContent, ""},
+		{"Empty watchlist", http.MethodGet, "/watchlist", "", token, http.StatusOK, "[]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, server.URL+Prefix+tt.path, strings.NewReader(tt.body))
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("request error = %v", err)
+			}
+			defer res.Body.Close()
+
+			var body bytes.Buffer
+			_, _ = body.ReadFrom(res.Body)
+
+			if res.StatusCode != tt.wantStatus {
+				t.Errorf("%s %s got status %d, want %d: %s", tt.method, tt.path, res.StatusCode, tt.wantStatus, body.String())
+			}
+			if !strings.Contains(body.String(), tt.wantBody) {
+				t.Errorf("%s %s got body %s, want it to contain %s", tt.method, tt.path, body.String(), tt.wantBody)
+			}
+			if res.StatusCode != http.StatusNoContent && res.Header.Get("Content-Type") == "application/json" && !json.Valid(body.Bytes()) {
+				t.Errorf("%s %s got invalid json %s", tt.method, tt.path, body.String())
+			}
+		})
+	}
+}
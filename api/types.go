@@ -0,0 +1,63 @@
+package api
+
+import (
+	"time"
+
+	"github.com/giornetta/watchazon"
+)
+
+// The types of the responses, as described in openapi.yaml.
+
+type Error struct {
+	Error string `json:"error"`
+}
+
+// A Price is expressed in the minor units of its currency, e.g. cents, and formatted for display.
+type Price struct {
+	Amount    int64  `json:"amount"`
+	Currency  string `json:"currency"`
+	Formatted string `json:"formatted"`
+}
+
+type Product struct {
+	Title        string    `json:"title"`
+	Link         string    `json:"link"`
+	Image        string    `json:"image,omitempty"`
+	Price        *Price    `json:"price"`
+	Availability string    `json:"availability"`
+	CheckedAt    time.Time `json:"checked_at"`
+	Failure      string    `json:"failure,omitempty"`
+}
+
+type PricePoint struct {
+	Price     *Price    `json:"price"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// newPrice returns the price of the response, nil for products without a price.
+func newPrice(m watchazon.Money) *Price {
+	if m.IsZero() {
+		return nil
+	}
+	return &Price{Amount: m.Amount, Currency: m.Currency, Formatted: m.String()}
+}
+
+func newProduct(p *watchazon.Product) Product {
+	return Product{
+		Title:        p.Title,
+		Link:         p.Link,
+		Image:        p.Image,
+		Price:        newPrice(p.Price),
+		Availability: p.FormattedAvailability(),
+		CheckedAt:    p.CheckedAt,
+		Failure:      p.Failure,
+	}
+}
+
+func newProducts(products []*watchazon.Product) []Product {
+	res := make([]Product, 0, len(products))
+	for _, p := range products {
+		res = append(res, newProduct(p))
+	}
+	return res
+}
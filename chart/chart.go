@@ -0,0 +1,175 @@
+// Package chart renders the price history of products as PNG images.
+package chart
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"time"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+
+	"github.com/giornetta/watchazon"
+)
+
+// Default size of the charts, fitting the previews of the chat apps.
+const (
+	DefaultWidth  = 800
+	DefaultHeight = 400
+)
+
+// ErrNoHistory is returned when there are no prices to plot.
+var ErrNoHistory = errors.New("no price history")
+
+var (
+	background = color.White
+	axis       = color.Gray{Y: 0x44}
+	grid       = color.Gray{Y: 0xe0}
+	line       = color.RGBA{R: 0x39, G: 0x9e, B: 0x5a, A: 0xff}
+)
+
+// Margins around the plot, leaving room for the labels.
+const (
+	marginLeft   = 90
+	marginRight  = 20
+	marginTop    = 20
+	marginBottom = 30
+	gridLines    = 4
+)
+
+// Render returns a width x height PNG with the step chart of the prices, oldest first as returned by the stores.
+// Each price is kept until the next one, as prices only change when they are checked.
+func Render(points []watchazon.PricePoint, width, height int) ([]byte, error) {
+	if len(points) == 0 {
+		return nil, ErrNoHistory
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+
+	plot := image.Rect(marginLeft, marginTop, width-marginRight, height-marginBottom)
+	s := newScale(points, plot)
+
+	// Horizontal grid with the prices, from the lowest to the highest.
+	currency := points[0].Price.Currency
+	for i := 0; i <= gridLines; i++ {
+		amount := s.low + (s.high-s.low)*int64(i)/gridLines
+		y := s.y(amount)
+		hline(img, plot.Min.X, plot.Max.X, y, grid)
+		label(img, 4, y+4, watchazon.Money{Amount: amount, Currency: currency}.Code())
+	}
+
+	hline(img, plot.Min.X, plot.Max.X, plot.Max.Y, axis)
+	vline(img, plot.Min.X, plot.Min.Y, plot.Max.Y, axis)
+
+	// Dates of the first and last points below the axis.
+	first, last := points[0].CheckedAt, points[len(points)-1].CheckedAt
+	label(img, plot.Min.X, plot.Max.Y+18, first.Format("2 Jan 2006"))
+	if !last.Equal(first) {
+		text := last.Format("2 Jan 2006")
+		label(img, plot.Max.X-font.MeasureString(basicfont.Face7x13, text).Round(), plot.Max.Y+18, text)
+	}
+
+	x0, y0 := s.x(points[0].CheckedAt), s.y(points[0].Price.Amount)
+	for _, p := range points[1:] {
+		x, y := s.x(p.CheckedAt), s.y(p.Price.Amount)
+		thick(img, x0, y0, x, y0)
+		thick(img, x, y0, x, y)
+		x0, y0 = x, y
+	}
+	thick(img, x0, y0, plot.Max.X, y0)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// scale maps times and amounts to the pixels of the plot.
+type scale struct {
+	plot       image.Rectangle
+	start, end time.Time
+	low, high  int64
+}
+
+func newScale(points []watchazon.PricePoint, plot image.Rectangle) scale {
+	lowest, _ := watchazon.LowestPrice(points)
+	highest, _ := watchazon.HighestPrice(points)
+
+	s := scale{
+		plot:  plot,
+		start: points[0].CheckedAt,
+		end:   points[len(points)-1].CheckedAt,
+		low:   lowest.Price.Amount,
+		high:  highest.Price.Amount,
+	}
+
+	// Leave some room above and below the line, which would be flat if the price never changed.
+	pad := (s.high - s.low) / 10
+	if pad == 0 {
+		pad = int64(math.Max(1, float64(s.low)/10))
+	}
+	s.low, s.high = s.low-pad, s.high+pad
+	if s.low < 0 {
+		s.low = 0
+	}
+
+	return s
+}
+
+func (s scale) x(t time.Time) int {
+	span := s.end.Sub(s.start)
+	if span <= 0 {
+		return s.plot.Min.X
+	}
+	return s.plot.Min.X + int(float64(t.Sub(s.start))/float64(span)*float64(s.plot.Dx()))
+}
+
+func (s scale) y(amount int64) int {
+	return s.plot.Max.Y - int(float64(amount-s.low)/float64(s.high-s.low)*float64(s.plot.Dy()))
+}
+
+func hline(img *image.RGBA, x0, x1, y int, c color.Color) {
+	for x := x0; x <= x1; x++ {
+		img.Set(x, y, c)
+	}
+}
+
+func vline(img *image.RGBA, x, y0, y1 int, c color.Color) {
+	for y := y0; y <= y1; y++ {
+		img.Set(x, y, c)
+	}
+}
+
+// thick draws a horizontal or vertical segment of the price line, three pixels wide.
+func thick(img *image.RGBA, x0, y0, x1, y1 int) {
+	if x0 > x1 {
+		x0, x1 = x1, x0
+	}
+	if y0 > y1 {
+		y0, y1 = y1, y0
+	}
+
+	for x := x0 - 1; x <= x1+1; x++ {
+		for y := y0 - 1; y <= y1+1; y++ {
+			img.Set(x, y, line)
+		}
+	}
+}
+
+func label(img *image.RGBA, x, y int, text string) {
+	d := font.Drawer{
+		Dst:  img,
+		Src:  image.NewUniform(axis),
+		Face: basicfont.Face7x13,
+		Dot:  fixed.P(x, y),
+	}
+	d.DrawString(text)
+}
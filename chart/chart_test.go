@@ -0,0 +1,58 @@
+package chart
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+	"time"
+
+	"github.com/giornetta/watchazon"
+)
+
+func TestRender(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	eur := func(amount int64) watchazon.Money { return watchazon.Money{Amount: amount, Currency: "EUR"} }
+
+	tests := []struct {
+		name    string
+		points  []watchazon.PricePoint
+		wantErr error
+	}{
+		{"No history", nil, ErrNoHistory},
+		{"Single point", []watchazon.PricePoint{{Price: eur(4999), CheckedAt: start}}, nil},
+		{"Flat", []watchazon.PricePoint{{Price: eur(4999), CheckedAt: start}, {Price: eur(4999), CheckedAt: start.Add(time.Hour)}}, nil},
+		{"Changes", []watchazon.PricePoint{
+			{Price: eur(5999), CheckedAt: start},
+			{Price: eur(4999), CheckedAt: start.Add(24 * time.Hour)},
+			{Price: eur(6499), CheckedAt: start.Add(72 * time.Hour)},
+		}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := Render(tt.points, DefaultWidth, DefaultHeight)
+			if err != tt.wantErr {
+				t.Fatalf("Render() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			img, err := png.Decode(bytes.NewReader(b))
+			if err != nil {
+				t.Fatalf("Render() returned an invalid png: %v", err)
+			}
+			if size := img.Bounds().Size(); size.X != DefaultWidth || size.Y != DefaultHeight {
+				t.Errorf("Render() got size %v, want %dx%d", size, DefaultWidth, DefaultHeight)
+			}
+
+			// The line must start at the left of the plot, at the height of the first price.
+			s := newScale(tt.points, image.Rect(marginLeft, marginTop, DefaultWidth-marginRight, DefaultHeight-marginBottom))
+			x, y := s.x(tt.points[0].CheckedAt)+5, s.y(tt.points[0].Price.Amount)
+			if got := color.RGBAModel.Convert(img.At(x, y)); got != line {
+				t.Errorf("Render() got color %v at (%d, %d), want the line", got, x, y)
+			}
+		})
+	}
+}
@@ -1,79 +1,246 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"sync"
 	"syscall"
 	"time"
 
+	"github.com/giornetta/watchazon"
+	"github.com/giornetta/watchazon/api"
 	"github.com/giornetta/watchazon/config"
+	"github.com/giornetta/watchazon/dashboard"
+	"github.com/giornetta/watchazon/discord"
+	"github.com/giornetta/watchazon/health"
 	"github.com/giornetta/watchazon/locator"
+	"github.com/giornetta/watchazon/logging"
 
 	"github.com/giornetta/watchazon/database"
+	"github.com/giornetta/watchazon/memory"
+	"github.com/giornetta/watchazon/metrics"
+	"github.com/giornetta/watchazon/notify"
 	"github.com/giornetta/watchazon/scraper"
 	"github.com/giornetta/watchazon/service"
+	"github.com/giornetta/watchazon/sqlite"
 	"github.com/giornetta/watchazon/telegram"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
+// shutdownTimeout is how long the HTTP server waits for the requests in progress when shutting down.
+const shutdownTimeout = 10 * time.Second
+
 func main() {
-	// Load configuration
-	c := config.FromDotEnv()
+	// Load configuration from the file, the environment and the flags
+	c, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err == nil {
+		err = c.Validate()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration:\n%v\n", err)
+		os.Exit(2)
+	}
 
-	// Initialize Amazon scraper
-	scr := scraper.New(c.AllowedDomains...)
+	if err := run(c); err != nil {
+		slog.Error("bot stopped", "error", err)
+		os.Exit(1)
+	}
+}
 
-	// Open badger database
-	db, err := database.Open(c.BadgerPath)
+// run runs the bot with the configuration c until SIGTERM or SIGINT, or until it fails.
+// Everything it started is stopped before it returns.
+func run(c *config.Config) error {
+	// Stop everything on SIGTERM or SIGINT
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	// The level can be changed by reloading the configuration, the format can't
+	level := new(slog.LevelVar)
+	if l, err := logging.ParseLevel(c.Log.Level); err == nil {
+		level.Set(l)
+	}
+	logger, err := logging.New(os.Stderr, c.Log.Format, level)
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("invalid log settings: %w", err)
 	}
-	defer db.Close()
+	slog.SetDefault(logger)
+
+	// Initialize Amazon scraper, it's configured with the other settings that can be reloaded below
+	scr := scraper.New()
+
+	// Open the storage backend
+	store, err := openStore(c)
+	if err != nil {
+		return fmt.Errorf("could not open store: %w", err)
+	}
+	defer store.Close()
+
+	// Record the latency of the store and count what it holds
+	store = metrics.NewStore(store)
+	prometheus.MustRegister(metrics.NewActive(store))
 
 	// Initialize Locator service
 	loc := locator.New(c.Here.AppID, c.Here.AppCode)
 
 	// Initialize the Service
-	svc := service.New(scr, db)
+	svc := service.New(scr, store, c.Workers)
+
+	// Deliver the notifications through the channels chosen by each user
+	router := notify.NewRouter(store)
+
+	l := &live{
+		started: c,
+		level:   level,
+		scraper: scr,
+		service: svc,
+		router:  router,
+		store:   store,
+		bots:    make(map[string]watchazon.Notifier),
+	}
+	defer l.close()
+	l.configure(c)
+
+	// Restart the process if the store breaks, and take it out of rotation while checks or scrapes keep failing
+	checker := health.New()
+	checker.Liveness("store", func(ctx context.Context) (map[string]interface{}, error) {
+		return nil, store.Ping(ctx)
+	})
+	checker.Readiness("checks", svc.Health)
+	checker.Readiness("scraper", scr.Health)
+
+	// workers are the goroutines to wait for before closing the store, which are stopped by cancel
+	// if run fails once they are started
+	ctx, cancel := context.WithCancel(ctx)
+	var workers sync.WaitGroup
+	defer workers.Wait()
+	defer cancel()
+
+	slog.Info("service running", "workers", c.Workers)
+	// Check each product when it's due, more often the more it's volatile and watched
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		svc.Run(ctx)
+	}()
 
-	// Create the bot
-	bot, err := telegram.New(c.TelegramToken, svc, loc)
-	if err != nil {
-		log.Fatal(err)
+	if c.Notifies(watchazon.ChannelWebhook) {
+		if err := l.openDeadLetter(); err != nil {
+			return fmt.Errorf("could not open webhook dead letter file: %w", err)
+		}
 	}
 
-	log.Println("Service running...")
-	go func() {
-		for {
-			log.Println("Running products update...")
-			err := svc.Update()
-			if err != nil {
-				log.Printf("could not update products: %v", err)
-			}
-
-			time.Sleep(25 * time.Minute)
+	// Start the bots whose token is set
+	if c.TelegramToken != "" {
+		bot, err := telegram.New(c.TelegramToken, svc, loc)
+		if err != nil {
+			return fmt.Errorf("could not start telegram bot: %w", err)
+		}
+		l.bots[watchazon.ChannelTelegram] = bot
+		checker.Readiness("telegram", bot.Health)
+
+		// The dashboard relies on the Telegram login
+		http.Handle(dashboard.Prefix+"/", dashboard.New(svc, c.TelegramToken, bot.Username()))
+
+		slog.Info("telegram bot running", "username", bot.Username())
+		go bot.Run()
+		defer bot.Stop()
+	}
+	if c.DiscordToken != "" {
+		bot, err := discord.New(c.DiscordToken, svc)
+		if err != nil {
+			return fmt.Errorf("could not start discord bot: %w", err)
+		}
+		l.bots[watchazon.ChannelDiscord] = bot
+
+		if err := bot.Run(); err != nil {
+			return fmt.Errorf("could not start discord bot: %w", err)
 		}
+		slog.Info("discord bot running")
+		defer bot.Stop()
+	}
+
+	// Register the notifiers, and reload the configuration on SIGHUP or when its file changes
+	l.configureNotifiers(c)
+	go config.Watch(ctx, c, os.Args[1:], l.apply)
+
+	// The bots are stopped after the router, so that the notification being delivered gets to them
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		router.Run(ctx, svc)
 	}()
 
-	log.Println("Bot running...")
-	go bot.Run()
-	defer bot.Stop()
+	fs := http.FileServer(http.Dir("./cmd/bot/web"))
+	http.Handle("/", fs)
+	http.Handle(api.Prefix+"/", api.New(svc))
+	http.Handle("/metrics", promhttp.Handler())
+	http.Handle("/healthz", checker.Healthz())
+	http.Handle("/readyz", checker.Readyz())
 
+	server := &http.Server{Addr: ":" + strconv.Itoa(c.Port)}
+	serveErr := make(chan error, 1)
 	go func() {
-		fs := http.FileServer(http.Dir("./cmd/bot/web"))
-		http.Handle("/", fs)
+		slog.Info("listening", "addr", server.Addr)
+		serveErr <- server.ListenAndServe()
+	}()
 
-		port := os.Getenv("PORT")
-		log.Printf("Listening on :%s...\n", port)
-		err = http.ListenAndServe(":"+port, nil)
+	var runErr error
+	select {
+	case <-ctx.Done():
+	case err := <-serveErr:
+		runErr = fmt.Errorf("could not serve http: %w", err)
+	}
+	// A second signal kills the process
+	stop()
+	cancel()
+	slog.Info("shutting down")
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancelShutdown()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Error("could not shut down the HTTP server", "error", err)
+	}
+
+	// Wait for the checks in progress to be canceled and the notification being delivered to be acknowledged
+	workers.Wait()
+	slog.Info("shutdown complete")
+	return runErr
+}
+
+func openStore(c *config.Config) (watchazon.Store, error) {
+	switch c.Store {
+	case "badger":
+		db, err := database.Open(c.BadgerPath)
 		if err != nil {
-			log.Fatal(err)
+			return nil, err
 		}
-	}()
 
-	ch := make(chan os.Signal, 1)
-	signal.Notify(ch, syscall.SIGTERM, syscall.SIGINT)
+		n, err := db.Migrate()
+		if err != nil {
+			_ = db.Close()
+			return nil, fmt.Errorf("could not migrate database: %v", err)
+		}
+		if n > 0 {
+			slog.Info("migrated database", "values", n, "schema_version", database.SchemaVersion)
+		}
 
-	<-ch
+		return db, nil
+	case "sqlite":
+		return sqlite.Open(c.SQLitePath)
+	case "memory":
+		return memory.New(), nil
+	default:
+		return nil, fmt.Errorf("unknown store %q", c.Store)
+	}
 }
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"sync"
+
+	"github.com/giornetta/watchazon"
+	"github.com/giornetta/watchazon/config"
+	"github.com/giornetta/watchazon/email"
+	"github.com/giornetta/watchazon/logging"
+	"github.com/giornetta/watchazon/notify"
+	"github.com/giornetta/watchazon/scraper"
+	"github.com/giornetta/watchazon/service"
+	"github.com/giornetta/watchazon/webhook"
+)
+
+// live holds the parts of the bot whose settings can change while it runs.
+type live struct {
+	mu sync.Mutex
+	// started is the configuration the bot started with, the one in use for the settings that need a restart.
+	started *config.Config
+
+	level   *slog.LevelVar
+	scraper *scraper.Scraper
+	service *service.Service
+	router  *notify.Router
+	store   watchazon.Store
+	// bots are the running bots, which are registered to the router when their channel is enabled.
+	bots map[string]watchazon.Notifier
+	// deadLetter is opened when webhook notifications are first enabled, and closed by close.
+	deadLetter *os.File
+	// emailDisabled tells whether email notifications were disabled by the last configuration, not to warn at each reload.
+	emailDisabled bool
+}
+
+// apply applies the settings of c that don't need a restart, and reports the ones that do.
+func (l *live) apply(c *config.Config) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, s := range l.started.RestartNeeded(c) {
+		slog.Warn("setting changed, restart to apply it", "setting", s)
+	}
+
+	l.configure(c)
+	l.configureNotifiers(c)
+}
+
+// configure applies the settings of c to the logger, the scraper and the service.
+func (l *live) configure(c *config.Config) {
+	level, err := logging.ParseLevel(c.Log.Level)
+	if err == nil {
+		l.level.Set(level)
+	}
+
+	l.scraper.Configure(scraper.Settings{
+		AllowedDomains: c.AllowedDomains,
+		Delay:          c.Scraper.Delay,
+		RandomDelay:    c.Scraper.RandomDelay,
+		Retries:        c.Scraper.Retries,
+		Backoff:        c.Scraper.Backoff,
+		Timeout:        c.Scraper.Timeout,
+	})
+	l.service.SetIntervals(service.Intervals{Base: c.Intervals.Base, Min: c.Intervals.Min, Max: c.Intervals.Max})
+}
+
+// configureNotifiers registers to the router the notifiers of the channels enabled by c, and unregisters the others.
+func (l *live) configureNotifiers(c *config.Config) {
+	if c.Notifies(watchazon.ChannelEmail) && c.SMTP.Addr != "" {
+		l.router.Register(watchazon.ChannelEmail, email.New(c.SMTP.Addr, c.SMTP.Username, c.SMTP.Password, c.SMTP.From, l.store))
+		if l.emailDisabled {
+			slog.Info("email notifications are enabled")
+		}
+		l.emailDisabled = false
+	} else {
+		l.router.Unregister(watchazon.ChannelEmail)
+		if !l.emailDisabled {
+			slog.Warn("email notifications are disabled")
+		}
+		l.emailDisabled = true
+	}
+
+	if c.Notifies(watchazon.ChannelWebhook) {
+		if err := l.openDeadLetter(); err != nil {
+			slog.Error("could not open webhook dead letter file, webhook notifications are disabled", "error", err)
+			l.router.Unregister(watchazon.ChannelWebhook)
+		} else {
+			if c.Webhook.Secret == "" {
+				slog.Warn("webhook secret not set, webhook payloads can't be verified")
+			}
+			l.router.Register(watchazon.ChannelWebhook, webhook.New(c.Webhook.URL, c.Webhook.Secret, l.store, l.deadLetter))
+		}
+	} else {
+		l.router.Unregister(watchazon.ChannelWebhook)
+	}
+
+	for channel, bot := range l.bots {
+		if c.Notifies(channel) {
+			l.router.Register(channel, bot)
+		} else {
+			l.router.Unregister(channel)
+		}
+	}
+}
+
+// openDeadLetter opens the dead letter file of the webhooks, if it isn't yet.
+func (l *live) openDeadLetter() error {
+	if l.deadLetter != nil {
+		return nil
+	}
+
+	f, err := os.OpenFile(l.started.Webhook.DeadLetter, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	l.deadLetter = f
+	return nil
+}
+
+// close closes the dead letter file, if open.
+func (l *live) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.deadLetter != nil {
+		_ = l.deadLetter.Close()
+	}
+}
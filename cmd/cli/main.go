@@ -1,25 +1,60 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"sort"
 
 	"github.com/giornetta/watchazon"
 	"github.com/giornetta/watchazon/config"
+	"github.com/giornetta/watchazon/database"
 	"github.com/giornetta/watchazon/scraper"
 )
 
+const usage = `usage:
+	./cli <query> <domain>	search products on Amazon
+	./cli reindex		rebuild the user index of the database
+	./cli versions		report how many records are stored with each schema version
+	./cli migrate		migrate the stored values to the current schema version`
+
 func main() {
 	if len(os.Args) == 1 {
-		log.Fatalf("usage: ./cli <query> <domain>")
+		log.Fatal(usage)
 	}
 
-	c := config.FromDotEnv()
+	// The arguments are the command, so the configuration only comes from the file and the environment
+	c, err := config.Load(nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	switch os.Args[1] {
+	case "reindex":
+		reindex(c)
+	case "versions":
+		versions(c)
+	case "migrate":
+		migrate(c)
+	default:
+		search(c, os.Args[1:])
+	}
+}
+
+func search(c *config.Config, args []string) {
+	if len(args) != 2 {
+		log.Fatal(usage)
+	}
 
 	scr := scraper.New(c.AllowedDomains...)
+	scr.Retries, scr.Backoff = c.Scraper.Retries, c.Scraper.Backoff
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
 
-	prods, err := scr.Search(os.Args[1], watchazon.Domain(os.Args[2]))
+	prods, err := scr.Search(ctx, args[0], watchazon.Domain(args[1]))
 	if err != nil {
 		log.Fatalf("could not search: %v", err)
 	}
@@ -28,3 +63,56 @@ func main() {
 		fmt.Println(p.Title, p.Price)
 	}
 }
+
+func reindex(c *config.Config) {
+	db, err := database.Open(c.BadgerPath)
+	if err != nil {
+		log.Fatalf("could not open database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.RebuildUserIndex(); err != nil {
+		log.Fatalf("could not rebuild user index: %v", err)
+	}
+
+	log.Println("User index rebuilt")
+}
+
+func versions(c *config.Config) {
+	db, err := database.Open(c.BadgerPath)
+	if err != nil {
+		log.Fatalf("could not open database: %v", err)
+	}
+	defer db.Close()
+
+	versions, err := db.SchemaVersions()
+	if err != nil {
+		log.Fatalf("could not read schema versions: %v", err)
+	}
+
+	keys := make([]int, 0, len(versions))
+	for v := range versions {
+		keys = append(keys, v)
+	}
+	sort.Ints(keys)
+
+	fmt.Printf("Current schema version: %d\n", database.SchemaVersion)
+	for _, v := range keys {
+		fmt.Printf("v%d: %d records\n", v, versions[v])
+	}
+}
+
+func migrate(c *config.Config) {
+	db, err := database.Open(c.BadgerPath)
+	if err != nil {
+		log.Fatalf("could not open database: %v", err)
+	}
+	defer db.Close()
+
+	n, err := db.Migrate()
+	if err != nil {
+		log.Fatalf("could not migrate database: %v", err)
+	}
+
+	log.Printf("Migrated %d values to schema version %d", n, database.SchemaVersion)
+}
@@ -1,38 +1,381 @@
+// Package config loads the configuration of the programs from a YAML file, the environment and the command line.
 package config
 
 import (
-	"log"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
 	"os"
 	"strings"
+	"time"
 
+	"github.com/giornetta/watchazon"
+	"github.com/giornetta/watchazon/logging"
+	"github.com/giornetta/watchazon/scraper"
+	"github.com/giornetta/watchazon/service"
 	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
 )
 
 // Config contains the required configuration variables for the program.
 type Config struct {
-	TelegramToken  string
-	AllowedDomains []string
-	BadgerPath     string
-	Here           struct {
-		AppID   string
-		AppCode string
-	}
+	// Path is the file the configuration was loaded from, if any.
+	Path string `yaml:"-"`
+
+	// TelegramToken and DiscordToken enable the respective bots, at least one of them is required.
+	TelegramToken string `yaml:"telegram_token"`
+	DiscordToken  string `yaml:"discord_token"`
+	// Port is the one the HTTP server listens on.
+	Port int `yaml:"port"`
+	// AllowedDomains restricts the hosts that can be scraped, all the supported marketplaces are allowed if empty.
+	// The hosts can be written without www., as in amazon.it, which is added when loading.
+	AllowedDomains []string `yaml:"allowed_domains"`
+	// Store is the storage backend to use: badger (default), sqlite, which needs a binary built with cgo, or memory.
+	Store      string `yaml:"store"`
+	BadgerPath string `yaml:"badger_path"`
+	SQLitePath string `yaml:"sqlite_path"`
+	Here       struct {
+		AppID   string `yaml:"app_id"`
+		AppCode string `yaml:"app_code"`
+	} `yaml:"here"`
+	// Scraper contains the rate limiting and retry settings of the scraper.
+	Scraper struct {
+		Delay       time.Duration `yaml:"delay"`
+		RandomDelay time.Duration `yaml:"random_delay"`
+		Retries     int           `yaml:"retries"`
+		Backoff     time.Duration `yaml:"backoff"`
+		// Timeout bounds each scrape, retries included.
+		Timeout time.Duration `yaml:"timeout"`
+	} `yaml:"scraper"`
+	// Workers is how many products are updated concurrently.
+	Workers int `yaml:"workers"`
+	// Intervals tune how often the products are checked, see service.Intervals.
+	Intervals struct {
+		Base time.Duration `yaml:"base"`
+		Min  time.Duration `yaml:"min"`
+		Max  time.Duration `yaml:"max"`
+	} `yaml:"intervals"`
+	// Notifiers are the channels notifications are sent through. When empty, every channel whose
+	// settings are set is used: the bots with a token, email with an SMTP server, and webhooks.
+	Notifiers []string `yaml:"notifiers"`
+	// SMTP contains the server email notifications are sent through.
+	SMTP struct {
+		// Addr is the host:port of the server.
+		Addr     string `yaml:"addr"`
+		Username string `yaml:"username"`
+		Password string `yaml:"password"`
+		From     string `yaml:"from"`
+	} `yaml:"smtp"`
+	// Webhook contains the settings of the webhook notifications.
+	Webhook struct {
+		// URL is the webhook of the users who didn't set their own.
+		URL string `yaml:"url"`
+		// Secret signs the payloads.
+		Secret string `yaml:"secret"`
+		// DeadLetter is the file undelivered payloads are appended to.
+		DeadLetter string `yaml:"dead_letter"`
+	} `yaml:"webhook"`
+	// Log contains the output format (text or json) and the minimum level (debug, info, warn or error) of the logs.
+	Log struct {
+		Format string `yaml:"format"`
+		Level  string `yaml:"level"`
+	} `yaml:"log"`
 }
 
-// FromDotEnv loads the required configuration variables from a .env file.
-func FromDotEnv() *Config {
-	config := &Config{}
+// Default returns the configuration of the settings that aren't set anywhere.
+func Default() *Config {
+	c := &Config{
+		Port:    8080,
+		Store:   "badger",
+		Workers: service.DefaultWorkers,
+	}
+	c.Scraper.Delay = scraper.DefaultDelay
+	c.Scraper.RandomDelay = scraper.DefaultRandomDelay
+	c.Scraper.Retries = scraper.DefaultRetries
+	c.Scraper.Backoff = scraper.DefaultBackoff
+	c.Scraper.Timeout = scraper.DefaultTimeout
+	c.Intervals.Base = service.DefaultIntervals.Base
+	c.Intervals.Min = service.DefaultIntervals.Min
+	c.Intervals.Max = service.DefaultIntervals.Max
+	c.Webhook.DeadLetter = "webhook-dead-letter.jsonl"
+	c.Log.Format = logging.FormatText
+	c.Log.Level = "info"
+
+	return c
+}
 
+// Load returns the configuration made of, from the lowest to the highest precedence: the defaults,
+// the YAML file given by the -config flag or by CONFIG_FILE, the env variables, which a .env file
+// may add to, and the command line flags in args.
+// The configuration isn't validated, as the programs may not need all of it.
+func Load(args []string) (*Config, error) {
 	if err := godotenv.Load(); err != nil {
-		log.Println("could not find .env file, loading env variables")
+		slog.Debug("could not find .env file, loading env variables")
+	}
+
+	return load(args)
+}
+
+// load returns the configuration as Load does, without reading the .env file.
+func load(args []string) (*Config, error) {
+	path := configPath(args)
+	if path == "" {
+		path = os.Getenv("CONFIG_FILE")
 	}
 
-	config.TelegramToken = os.Getenv("TELEGRAM_TOKEN")
-	config.AllowedDomains = strings.Split(os.Getenv("ALLOWED_DOMAINS"), ",")
-	config.BadgerPath = os.Getenv("BADGER_PATH")
+	c := Default()
+	if path != "" {
+		if err := c.loadFile(path); err != nil {
+			return nil, err
+		}
+		c.Path = path
+	}
+
+	fs, envs := c.flagSet()
+	var errs []error
+	for _, e := range envs {
+		v := os.Getenv(e.env)
+		if v == "" {
+			continue
+		}
+		if err := fs.Set(e.flag, v); err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s %q: %w", e.env, v, err))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	// The marketplaces are often written without www., which their hosts have.
+	for i, d := range c.AllowedDomains {
+		d = strings.ToLower(d)
+		if !strings.HasPrefix(d, "www.") {
+			d = "www." + d
+		}
+		c.AllowedDomains[i] = d
+	}
+
+	return c, nil
+}
+
+// loadFile overrides the configuration with the YAML file at path, in which unknown keys are an error.
+func (c *Config) loadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("could not open config file: %w", err)
+	}
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("could not parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// configPath returns the value of the -config flag in args, which is needed before parsing the
+// other flags as they take precedence over the file. The errors are left to the parse of all the flags.
+func configPath(args []string) string {
+	fs, _ := Default().flagSet()
+	fs.SetOutput(io.Discard)
+	_ = fs.Parse(args)
+	return fs.Lookup("config").Value.String()
+}
+
+// envFlag is an env variable overriding the setting of a flag.
+type envFlag struct {
+	env  string
+	flag string
+}
+
+// flagSet returns the flags overriding the settings of c, defaulting to its current values, and the env
+// variables overriding the same settings.
+func (c *Config) flagSet() (*flag.FlagSet, []envFlag) {
+	fs := flag.NewFlagSet("watchazon", flag.ContinueOnError)
+	var envs []envFlag
+	env := func(name, key string) {
+		envs = append(envs, envFlag{env: key, flag: name})
+		f := fs.Lookup(name)
+		f.Usage = fmt.Sprintf("%s (env %s)", f.Usage, key)
+	}
+
+	fs.String("config", "", "YAML file to load the configuration from (env CONFIG_FILE)")
+
+	fs.StringVar(&c.TelegramToken, "telegram-token", c.TelegramToken, "token of the Telegram bot")
+	env("telegram-token", "TELEGRAM_TOKEN")
+	fs.StringVar(&c.DiscordToken, "discord-token", c.DiscordToken, "token of the Discord bot")
+	env("discord-token", "DISCORD_TOKEN")
+	fs.IntVar(&c.Port, "port", c.Port, "port of the HTTP server")
+	env("port", "PORT")
+	fs.Var((*listValue)(&c.AllowedDomains), "allowed-domains", "comma separated hosts that can be scraped, all the marketplaces if empty")
+	env("allowed-domains", "ALLOWED_DOMAINS")
+
+	fs.StringVar(&c.Store, "store", c.Store, "storage backend: badger, sqlite or memory")
+	env("store", "STORE")
+	fs.StringVar(&c.BadgerPath, "badger-path", c.BadgerPath, "directory of the badger database")
+	env("badger-path", "BADGER_PATH")
+	fs.StringVar(&c.SQLitePath, "sqlite-path", c.SQLitePath, "file of the sqlite database")
+	env("sqlite-path", "SQLITE_PATH")
 
-	config.Here.AppCode = os.Getenv("HERE_APP_CODE")
-	config.Here.AppID = os.Getenv("HERE_APP_ID")
+	fs.StringVar(&c.Here.AppID, "here-app-id", c.Here.AppID, "app ID of the HERE geocoder")
+	env("here-app-id", "HERE_APP_ID")
+	fs.StringVar(&c.Here.AppCode, "here-app-code", c.Here.AppCode, "app code of the HERE geocoder")
+	env("here-app-code", "HERE_APP_CODE")
 
-	return config
+	fs.DurationVar(&c.Scraper.Delay, "scraper-delay", c.Scraper.Delay, "minimum time between two requests to the same host")
+	env("scraper-delay", "SCRAPER_DELAY")
+	fs.DurationVar(&c.Scraper.RandomDelay, "scraper-random-delay", c.Scraper.RandomDelay, "maximum random time added to the delay")
+	env("scraper-random-delay", "SCRAPER_RANDOM_DELAY")
+	fs.IntVar(&c.Scraper.Retries, "scraper-retries", c.Scraper.Retries, "retries after a server error or a captcha page")
+	env("scraper-retries", "SCRAPER_RETRIES")
+	fs.DurationVar(&c.Scraper.Backoff, "scraper-backoff", c.Scraper.Backoff, "wait before the first retry, doubled at each one")
+	env("scraper-backoff", "SCRAPER_BACKOFF")
+	fs.DurationVar(&c.Scraper.Timeout, "scraper-timeout", c.Scraper.Timeout, "bound of each scrape, retries included")
+	env("scraper-timeout", "SCRAPER_TIMEOUT")
+
+	fs.IntVar(&c.Workers, "workers", c.Workers, "products checked concurrently")
+	env("workers", "UPDATE_WORKERS")
+	fs.DurationVar(&c.Intervals.Base, "check-interval", c.Intervals.Base, "wait between the checks of a product with one watcher and a price changing once a week")
+	env("check-interval", "CHECK_INTERVAL")
+	fs.DurationVar(&c.Intervals.Min, "min-check-interval", c.Intervals.Min, "minimum wait between the checks of a product")
+	env("min-check-interval", "MIN_CHECK_INTERVAL")
+	fs.DurationVar(&c.Intervals.Max, "max-check-interval", c.Intervals.Max, "maximum wait between the checks of a product")
+	env("max-check-interval", "MAX_CHECK_INTERVAL")
+
+	fs.Var((*listValue)(&c.Notifiers), "notifiers", "comma separated channels notifications are sent through, all the configured ones if empty")
+	env("notifiers", "NOTIFIERS")
+	fs.StringVar(&c.SMTP.Addr, "smtp-addr", c.SMTP.Addr, "host:port of the SMTP server")
+	env("smtp-addr", "SMTP_ADDR")
+	fs.StringVar(&c.SMTP.Username, "smtp-username", c.SMTP.Username, "username of the SMTP server")
+	env("smtp-username", "SMTP_USERNAME")
+	fs.StringVar(&c.SMTP.Password, "smtp-password", c.SMTP.Password, "password of the SMTP server")
+	env("smtp-password", "SMTP_PASSWORD")
+	fs.StringVar(&c.SMTP.From, "smtp-from", c.SMTP.From, "sender of the emails")
+	env("smtp-from", "SMTP_FROM")
+	fs.StringVar(&c.Webhook.URL, "webhook-url", c.Webhook.URL, "webhook of the users who didn't set their own")
+	env("webhook-url", "WEBHOOK_URL")
+	fs.StringVar(&c.Webhook.Secret, "webhook-secret", c.Webhook.Secret, "secret signing the webhook payloads")
+	env("webhook-secret", "WEBHOOK_SECRET")
+	fs.StringVar(&c.Webhook.DeadLetter, "webhook-dead-letter", c.Webhook.DeadLetter, "file undelivered webhook payloads are appended to")
+	env("webhook-dead-letter", "WEBHOOK_DEAD_LETTER")
+
+	fs.StringVar(&c.Log.Format, "log-format", c.Log.Format, "format of the logs: text or json")
+	env("log-format", "LOG_FORMAT")
+	fs.StringVar(&c.Log.Level, "log-level", c.Log.Level, "minimum level of the logs: debug, info, warn or error")
+	env("log-level", "LOG_LEVEL")
+
+	return fs, envs
+}
+
+// listValue is a flag.Value for comma separated lists.
+type listValue []string
+
+func (l *listValue) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, ",")
+}
+
+func (l *listValue) Set(v string) error {
+	*l = nil
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			*l = append(*l, s)
+		}
+	}
+	return nil
+}
+
+// Validate checks the configuration of the bot, reporting all the problems it finds.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.TelegramToken != "" || c.DiscordToken != "", "neither telegram_token nor discord_token are set, there's no bot to run")
+	check(c.Port > 0 && c.Port < 1<<16, "port %d is out of range", c.Port)
+
+	hosts := make(map[string]bool)
+	for _, h := range watchazon.Hosts() {
+		hosts[h] = true
+	}
+	for _, d := range c.AllowedDomains {
+		check(hosts[d], "allowed domain %q isn't the host of a supported marketplace", d)
+	}
+
+	switch c.Store {
+	case "badger":
+		check(c.BadgerPath != "", "badger_path is required by the badger store")
+	case "sqlite":
+		check(c.SQLitePath != "", "sqlite_path is required by the sqlite store")
+	case "memory":
+	default:
+		check(false, "unknown store %q, want badger, sqlite or memory", c.Store)
+	}
+
+	check(c.Scraper.Delay >= 0 && c.Scraper.RandomDelay >= 0, "scraper delays can't be negative")
+	check(c.Scraper.Retries >= 0, "scraper retries can't be negative")
+	check(c.Scraper.Backoff >= 0, "scraper backoff can't be negative")
+	check(c.Scraper.Timeout >= 0, "scraper timeout can't be negative")
+
+	check(c.Workers > 0, "workers must be at least 1, got %d", c.Workers)
+	iv := c.Intervals
+	check(iv.Min > 0 && iv.Min <= iv.Base && iv.Base <= iv.Max,
+		"intervals must be positive with min <= base <= max, got min %v, base %v and max %v", iv.Min, iv.Base, iv.Max)
+
+	for _, n := range c.Notifiers {
+		switch n {
+		case watchazon.ChannelTelegram:
+			check(c.TelegramToken != "", "telegram notifier requires telegram_token")
+		case watchazon.ChannelDiscord:
+			check(c.DiscordToken != "", "discord notifier requires discord_token")
+		case watchazon.ChannelEmail:
+			check(c.SMTP.Addr != "", "email notifier requires smtp.addr")
+		case watchazon.ChannelWebhook:
+		default:
+			check(false, "unknown notifier %q", n)
+		}
+	}
+	if c.SMTP.Addr != "" {
+		_, _, err := net.SplitHostPort(c.SMTP.Addr)
+		check(err == nil, "smtp.addr %q isn't host:port", c.SMTP.Addr)
+		check(c.SMTP.From != "", "smtp.from is required to send emails")
+	}
+	if c.Webhook.URL != "" {
+		u, err := url.Parse(c.Webhook.URL)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "webhook.url %q isn't an http(s) URL", c.Webhook.URL)
+	}
+	check(c.Webhook.DeadLetter != "", "webhook.dead_letter is required")
+
+	check(c.Log.Format == logging.FormatText || c.Log.Format == logging.FormatJSON, "log format %q isn't text or json", c.Log.Format)
+	_, err := logging.ParseLevel(c.Log.Level)
+	check(err == nil, "log level %q isn't debug, info, warn or error", c.Log.Level)
+
+	return errors.Join(errs...)
+}
+
+// Notifies tells whether notifications may be sent through channel, provided that its settings are set.
+func (c *Config) Notifies(channel string) bool {
+	if len(c.Notifiers) == 0 {
+		return true
+	}
+	for _, n := range c.Notifiers {
+		if n == channel {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,139 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/giornetta/watchazon/scraper"
+)
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "watchazon.yaml")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("could not write config file: %v", err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	path := writeFile(t, `
+telegram_token: file-token
+port: 9000
+workers: 2
+intervals:
+  base: 1h
+allowed_domains: [amazon.it, www.amazon.de]
+scraper:
+  retries: 5
+`)
+	t.Setenv("CONFIG_FILE", path)
+	t.Setenv("UPDATE_WORKERS", "8")
+	t.Setenv("PORT", "9001")
+
+	c, err := Load([]string{"-port", "9002", "-check-interval=2h"})
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	// Flags win over the environment, which wins over the file, which wins over the defaults.
+	if c.Port != 9002 {
+		t.Errorf("Port = %d, want the flag 9002", c.Port)
+	}
+	if c.Intervals.Base != 2*time.Hour {
+		t.Errorf("Intervals.Base = %v, want the flag 2h", c.Intervals.Base)
+	}
+	if c.Workers != 8 {
+		t.Errorf("Workers = %d, want the env 8", c.Workers)
+	}
+	if c.TelegramToken != "file-token" || c.Scraper.Retries != 5 || len(c.AllowedDomains) != 2 {
+		t.Errorf("Load() = %+v, want the settings of the file", c)
+	}
+	// The hosts of the marketplaces are completed with www.
+	if want := []string{"www.amazon.it", "www.amazon.de"}; !reflect.DeepEqual(c.AllowedDomains, want) {
+		t.Errorf("AllowedDomains = %v, want %v", c.AllowedDomains, want)
+	}
+	if c.Scraper.Delay != scraper.DefaultDelay {
+		t.Errorf("Scraper.Delay = %v, want the default %v", c.Scraper.Delay, scraper.DefaultDelay)
+	}
+
+	// The flag takes the place of the env variable.
+	other := writeFile(t, "discord_token: other-token\n")
+	c, err = Load([]string{"-config", other})
+	if err != nil {
+		t.Fatalf("Load() with -config error = %v", err)
+	}
+	if c.DiscordToken != "other-token" || c.TelegramToken != "" {
+		t.Errorf("Load() with -config = %+v, want the settings of %s", c, other)
+	}
+
+	// The file is found after flags with a separate value too, and the flags still take precedence over it.
+	c, err = Load([]string{"-port", "9090", "-config", other, "-telegram-token", "flag-token"})
+	if err != nil {
+		t.Fatalf("Load() with -config after other flags error = %v", err)
+	}
+	if c.DiscordToken != "other-token" || c.Port != 9090 || c.TelegramToken != "flag-token" {
+		t.Errorf("Load() with -config after other flags = %+v, want the settings of %s and the flags", c, other)
+	}
+}
+
+func TestLoad_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env  map[string]string
+		args []string
+		want string
+	}{
+		{"Unknown key", "telegram_tokn: x\n", nil, nil, "telegram_tokn"},
+		{"Invalid env", "", map[string]string{"SCRAPER_DELAY": "soon"}, nil, "SCRAPER_DELAY"},
+		{"Invalid flag", "", nil, []string{"-workers", "many"}, "workers"},
+		{"Missing file", "", nil, []string{"-config", "missing.yaml"}, "missing.yaml"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.file != "" {
+				t.Setenv("CONFIG_FILE", writeFile(t, tt.file))
+			}
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			_, err := Load(tt.args)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Load() error = %v, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	valid := Default()
+	valid.TelegramToken = "token"
+	valid.BadgerPath = "data"
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+
+	c := Default()
+	c.Workers = 0
+	c.Intervals.Min = 2 * c.Intervals.Base
+	c.AllowedDomains = []string{"www.ebay.com"}
+	c.Notifiers = []string{"email", "sms"}
+	c.Log.Level = "verbose"
+
+	err := c.Validate()
+	if err == nil {
+		t.Fatalf("Validate() expected an error")
+	}
+	for _, want := range []string{"no bot to run", "badger_path", "workers", "intervals", "www.ebay.com", "smtp.addr", "sms", "verbose"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Validate() error = %v, want it to mention %q", err, want)
+		}
+	}
+}
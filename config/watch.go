@@ -0,0 +1,115 @@
+package config
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// settleTime is how long the config file must stay unchanged before it's loaded again,
+// as editors may write it in several steps.
+const settleTime = 500 * time.Millisecond
+
+// Watch loads the configuration again from args each time the process receives SIGHUP or the file of c changes,
+// until ctx is done. The configurations passing validation are given to apply, the others are logged and ignored.
+// If the file can't be watched, the configuration is only loaded again on SIGHUP.
+// The .env file is only read by Load at startup: the variables it set keep their values, and changing it needs a restart.
+func Watch(ctx context.Context, c *Config, args []string, apply func(*Config)) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	// The directory is watched rather than the file, which editors and orchestrators replace instead of writing it.
+	var changes <-chan fsnotify.Event
+	var errs <-chan error
+	if c.Path != "" {
+		w, err := watchDir(filepath.Dir(c.Path))
+		if err != nil {
+			slog.Error("could not watch config file, reload it with SIGHUP", "path", c.Path, "error", err)
+		} else {
+			defer w.Close()
+			changes, errs = w.Events, w.Errors
+		}
+	}
+	path := filepath.Clean(c.Path)
+
+	settle := time.NewTimer(settleTime)
+	settle.Stop()
+	defer settle.Stop()
+
+	reload := func(reason string) {
+		next, err := load(args)
+		if err == nil {
+			err = next.Validate()
+		}
+		if err != nil {
+			slog.Error("could not reload configuration, keeping the current one", "reason", reason, "error", err)
+			return
+		}
+
+		slog.Info("reloading configuration", "reason", reason, "path", next.Path)
+		apply(next)
+	}
+
+	for {
+		select {
+		case <-hup:
+			reload("sighup")
+		case e := <-changes:
+			if filepath.Clean(e.Name) == path && e.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) != 0 {
+				settle.Reset(settleTime)
+			}
+		case <-settle.C:
+			reload("file changed")
+		case err := <-errs:
+			slog.Error("could not watch config file", "path", c.Path, "error", err)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// watchDir returns a watcher of the files in dir.
+func watchDir(dir string) (*fsnotify.Watcher, error) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err := w.Add(dir); err != nil {
+		_ = w.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// RestartNeeded returns the settings changed in next which are only read at startup, so that they can't be applied
+// without restarting the program.
+func (c *Config) RestartNeeded(next *Config) []string {
+	var changed []string
+	check := func(name string, prev, next interface{}) {
+		if !reflect.DeepEqual(prev, next) {
+			changed = append(changed, name)
+		}
+	}
+
+	check("config", c.Path, next.Path)
+	check("telegram_token", c.TelegramToken, next.TelegramToken)
+	check("discord_token", c.DiscordToken, next.DiscordToken)
+	check("port", c.Port, next.Port)
+	check("store", c.Store, next.Store)
+	check("badger_path", c.BadgerPath, next.BadgerPath)
+	check("sqlite_path", c.SQLitePath, next.SQLitePath)
+	check("here", c.Here, next.Here)
+	check("workers", c.Workers, next.Workers)
+	check("webhook.dead_letter", c.Webhook.DeadLetter, next.Webhook.DeadLetter)
+	check("log.format", c.Log.Format, next.Log.Format)
+
+	return changed
+}
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	path := writeFile(t, "telegram_token: token\nbadger_path: data\nworkers: 2\n")
+	args := []string{"-config", path}
+	c, err := Load(args)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	applied := make(chan *Config, 1)
+	done := make(chan struct{})
+	go func() {
+		Watch(ctx, c, args, func(next *Config) { applied <- next })
+		close(done)
+	}()
+	// Give the watcher the time to start.
+	time.Sleep(100 * time.Millisecond)
+
+	// Invalid configurations aren't applied.
+	if err := os.WriteFile(path, []byte("telegram_token: token\nbadger_path: data\nworkers: 0\n"), 0600); err != nil {
+		t.Fatalf("could not write config file: %v", err)
+	}
+	select {
+	case next := <-applied:
+		t.Fatalf("Watch() applied an invalid configuration %+v", next)
+	case <-time.After(2 * settleTime):
+	}
+
+	if err := os.WriteFile(path, []byte("telegram_token: token\nbadger_path: data\nworkers: 3\n"), 0600); err != nil {
+		t.Fatalf("could not write config file: %v", err)
+	}
+	select {
+	case next := <-applied:
+		if next.Workers != 3 {
+			t.Errorf("Watch() applied workers = %d, want 3", next.Workers)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Watch() didn't apply the changed configuration")
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Errorf("Watch() didn't return when the context was canceled")
+	}
+}
+
+func TestConfig_RestartNeeded(t *testing.T) {
+	c := Default()
+	next := Default()
+	next.Port = 9000
+	next.Workers = 10
+	next.Here.AppID = "app"
+	next.AllowedDomains = []string{"www.amazon.it"}
+	next.Log.Level = "debug"
+
+	want := []string{"port", "here", "workers"}
+	if got := c.RestartNeeded(next); !reflect.DeepEqual(got, want) {
+		t.Errorf("RestartNeeded() got = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,105 @@
+package dashboard
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// loginMaxAge is how long after being issued by the widget a login is accepted.
+const loginMaxAge = 24 * time.Hour
+
+// sessionDuration is how long a session lasts after the login.
+const sessionDuration = 7 * 24 * time.Hour
+
+var (
+	errInvalidLogin   = errors.New("invalid login")
+	errExpiredLogin   = errors.New("login expired")
+	errInvalidSession = errors.New("invalid session")
+)
+
+// verifyLogin checks the data sent by the Telegram Login Widget, returning the ID of the user who logged in.
+// See https://core.telegram.org/widgets/login#checking-authorization.
+func verifyLogin(botToken string, query url.Values, now time.Time) (int64, error) {
+	hash := query.Get("hash")
+	if hash == "" {
+		return 0, errInvalidLogin
+	}
+
+	var fields []string
+	for k := range query {
+		if k != "hash" {
+			fields = append(fields, k+"="+query.Get(k))
+		}
+	}
+	sort.Strings(fields)
+
+	key := sha256.Sum256([]byte(botToken))
+	mac := hmac.New(sha256.New, key[:])
+	mac.Write([]byte(strings.Join(fields, "\n")))
+	if !hmac.Equal([]byte(hex.EncodeToString(mac.Sum(nil))), []byte(hash)) {
+		return 0, errInvalidLogin
+	}
+
+	authDate, err := strconv.ParseInt(query.Get("auth_date"), 10, 64)
+	if err != nil {
+		return 0, errInvalidLogin
+	}
+	if now.Sub(time.Unix(authDate, 0)) > loginMaxAge {
+		return 0, errExpiredLogin
+	}
+
+	return strconv.ParseInt(query.Get("id"), 10, 64)
+}
+
+// sessions signs and verifies the session cookies, whose value is userID.expiry.signature.
+type sessions struct {
+	key []byte
+}
+
+func (s sessions) sign(payload string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// issue returns the value of the cookie of a new session of the user.
+func (s sessions) issue(userID int64, now time.Time) string {
+	payload := strconv.FormatInt(userID, 10) + "." + strconv.FormatInt(now.Add(sessionDuration).Unix(), 10)
+	return payload + "." + s.sign(payload)
+}
+
+// verify returns the user of the session in the cookie, if it's valid and not expired.
+func (s sessions) verify(cookie string, now time.Time) (int64, error) {
+	i := strings.LastIndex(cookie, ".")
+	if i < 0 {
+		return 0, errInvalidSession
+	}
+
+	payload, signature := cookie[:i], cookie[i+1:]
+	if !hmac.Equal([]byte(s.sign(payload)), []byte(signature)) {
+		return 0, errInvalidSession
+	}
+
+	parts := strings.SplitN(payload, ".", 2)
+	if len(parts) != 2 {
+		return 0, errInvalidSession
+	}
+	expiry, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || now.After(time.Unix(expiry, 0)) {
+		return 0, errInvalidSession
+	}
+
+	return strconv.ParseInt(parts[0], 10, 64)
+}
+
+// csrfToken returns the token the forms of a session must carry, which changes with the session.
+func (s sessions) csrfToken(cookie string) string {
+	return s.sign("csrf:" + cookie)
+}
@@ -0,0 +1,286 @@
+// Package dashboard serves the web dashboard, where the users of the Telegram bot log in with the
+// Telegram Login Widget to manage their watchlist.
+package dashboard
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"embed"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/giornetta/watchazon"
+)
+
+// Prefix is the path the dashboard is served under.
+const Prefix = "/dashboard"
+
+// historyWindow is how far back the charts of the prices go.
+const historyWindow = 90 * 24 * time.Hour
+
+const sessionCookie = "session"
+
+//go:embed templates
+var templates embed.FS
+
+var (
+	loginTemplate     = template.Must(template.ParseFS(templates, "templates/layout.html", "templates/login.html"))
+	watchListTemplate = template.Must(template.ParseFS(templates, "templates/layout.html", "templates/watchlist.html"))
+)
+
+// Server handles the requests to the dashboard.
+type Server struct {
+	service  watchazon.Service
+	botToken string
+	botName  string
+	sessions sessions
+	mux      *http.ServeMux
+	now      func() time.Time
+}
+
+// New returns the dashboard of the Telegram bot with the given token and username,
+// whose sessions are signed with a key derived from the token.
+func New(svc watchazon.Service, botToken, botName string) *Server {
+	key := sha256.Sum256([]byte("watchazon-session:" + botToken))
+	s := &Server{
+		service:  svc,
+		botToken: botToken,
+		botName:  botName,
+		sessions: sessions{key: key[:]},
+		mux:      http.NewServeMux(),
+		now:      time.Now,
+	}
+
+	s.mux.HandleFunc(Prefix+"/", s.handleIndex)
+	s.mux.HandleFunc(Prefix+"/login", s.handleLogin)
+	s.mux.HandleFunc(Prefix+"/logout", s.form(s.handleLogout))
+	s.mux.HandleFunc(Prefix+"/watch", s.form(s.handleWatch))
+	s.mux.HandleFunc(Prefix+"/remove", s.form(s.handleRemove))
+	s.mux.HandleFunc(Prefix+"/alert", s.form(s.handleAlert))
+
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// user returns the user logged in with the request, and the value of its session cookie.
+func (s *Server) user(r *http.Request) (int64, string, bool) {
+	c, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return 0, "", false
+	}
+
+	userID, err := s.sessions.verify(c.Value, s.now())
+	if err != nil {
+		return 0, "", false
+	}
+
+	return userID, c.Value, true
+}
+
+// form only passes to h the POST requests of logged in users carrying the CSRF token of their session.
+func (s *Server) form(h func(w http.ResponseWriter, r *http.Request, userID int64)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, session, ok := s.user(r)
+		if !ok {
+			http.Redirect(w, r, Prefix+"/", http.StatusSeeOther)
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(r.PostFormValue("csrf")), []byte(s.sessions.csrfToken(session))) != 1 {
+			http.Error(w, "invalid form, reload the page", http.StatusForbidden)
+			return
+		}
+
+		h(w, r, userID)
+	}
+}
+
+func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != Prefix+"/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	userID, session, ok := s.user(r)
+	if !ok {
+		s.render(w, loginTemplate, map[string]interface{}{
+			"BotName":  s.botName,
+			"LoginURL": Prefix + "/login",
+			"Error":    r.URL.Query().Get("error"),
+		})
+		return
+	}
+
+	products, err := s.service.GetUserWatchList(r.Context(), userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	items := make([]item, 0, len(products))
+	for _, p := range products {
+		items = append(items, s.item(r.Context(), userID, p))
+	}
+
+	s.render(w, watchListTemplate, map[string]interface{}{
+		"Products": items,
+		"CSRF":     s.sessions.csrfToken(session),
+		"Error":    r.URL.Query().Get("error"),
+		"Message":  r.URL.Query().Get("message"),
+	})
+}
+
+// An item is a product of the watchlist, as shown by the dashboard.
+type item struct {
+	*watchazon.Product
+	Rule watchazon.AlertRule
+	// Chart are the points of the polyline of the price history, in a 300x60 box.
+	Chart           string
+	Lowest, Highest watchazon.Money
+}
+
+func (s *Server) item(ctx context.Context, userID int64, p *watchazon.Product) item {
+	it := item{Product: p}
+
+	rule, err := s.service.AlertRule(ctx, p.Link, userID)
+	if err != nil {
+		slog.Error("could not get alert rule", "link", p.Link, "user_id", userID, "error", err)
+	}
+	it.Rule = rule
+
+	points, err := s.service.PriceHistory(ctx, p.Link, s.now().Add(-historyWindow))
+	if err != nil {
+		slog.Error("could not get price history", "link", p.Link, "error", err)
+		return it
+	}
+	if lowest, ok := watchazon.LowestPrice(points); ok {
+		it.Lowest = lowest.Price
+	}
+	if highest, ok := watchazon.HighestPrice(points); ok {
+		it.Highest = highest.Price
+	}
+	it.Chart = chart(points, 300, 60)
+
+	return it
+}
+
+// chart returns the points of a polyline plotting the prices in a width x height box, empty if there are less than two.
+func chart(points []watchazon.PricePoint, width, height float64) string {
+	if len(points) < 2 {
+		return ""
+	}
+
+	lowest, _ := watchazon.LowestPrice(points)
+	highest, _ := watchazon.HighestPrice(points)
+	start, end := points[0].CheckedAt, points[len(points)-1].CheckedAt
+
+	span := float64(highest.Price.Amount - lowest.Price.Amount)
+	duration := float64(end.Sub(start))
+
+	coords := make([]string, 0, len(points))
+	for _, p := range points {
+		x, y := 0.0, height/2
+		if duration > 0 {
+			x = float64(p.CheckedAt.Sub(start)) / duration * width
+		}
+		if span > 0 {
+			y = height - float64(p.Price.Amount-lowest.Price.Amount)/span*height
+		}
+		coords = append(coords, fmt.Sprintf("%.1f,%.1f", x, y))
+	}
+
+	return strings.Join(coords, " ")
+}
+
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	userID, err := verifyLogin(s.botToken, r.URL.Query(), s.now())
+	if err != nil {
+		redirect(w, r, "error", err.Error())
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    s.sessions.issue(userID, s.now()),
+		Path:     Prefix,
+		Expires:  s.now().Add(sessionDuration),
+		HttpOnly: true,
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, Prefix+"/", http.StatusSeeOther)
+}
+
+func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request, _ int64) {
+	http.SetCookie(w, &http.Cookie{
+		Name:   sessionCookie,
+		Path:   Prefix,
+		MaxAge: -1,
+	})
+	http.Redirect(w, r, Prefix+"/", http.StatusSeeOther)
+}
+
+func (s *Server) handleWatch(w http.ResponseWriter, r *http.Request, userID int64) {
+	product, err := s.service.AddToWatchList(r.Context(), r.PostFormValue("link"), userID)
+	if err != nil {
+		redirect(w, r, "error", err.Error())
+		return
+	}
+
+	redirect(w, r, "message", fmt.Sprintf("✅ %s added to the watchlist!", product.Title))
+}
+
+func (s *Server) handleRemove(w http.ResponseWriter, r *http.Request, userID int64) {
+	if err := s.service.RemoveFromWatchList(r.Context(), r.PostFormValue("link"), userID); err != nil {
+		redirect(w, r, "error", err.Error())
+		return
+	}
+
+	redirect(w, r, "message", "Successfully Removed!")
+}
+
+func (s *Server) handleAlert(w http.ResponseWriter, r *http.Request, userID int64) {
+	link := r.PostFormValue("link")
+	rule, err := watchazon.ParseAlertRule(r.PostFormValue("rule"))
+	if err != nil {
+		redirect(w, r, "error", "invalid alert rule")
+		return
+	}
+
+	if rule.Kind == watchazon.AlertAnyChange {
+		err = s.service.ClearAlertRule(r.Context(), link, userID)
+	} else {
+		err = s.service.SetAlertRule(r.Context(), link, userID, rule)
+	}
+	if err != nil {
+		redirect(w, r, "error", err.Error())
+		return
+	}
+
+	redirect(w, r, "message", fmt.Sprintf("🔔 You will be notified on %s!", rule))
+}
+
+// redirect sends the user back to the watchlist, showing the message of the given kind (error or message).
+func redirect(w http.ResponseWriter, r *http.Request, kind, msg string) {
+	http.Redirect(w, r, Prefix+"/?"+url.Values{kind: {msg}}.Encode(), http.StatusSeeOther)
+}
+
+func (s *Server) render(w http.ResponseWriter, t *template.Template, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := t.ExecuteTemplate(w, "layout", data); err != nil {
+		slog.Error("could not render dashboard", "error", err)
+	}
+}
@@ -0,0 +1,192 @@
+package dashboard
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/giornetta/watchazon"
+	"github.com/giornetta/watchazon/memory"
+	"github.com/giornetta/watchazon/scraper"
+	"github.com/giornetta/watchazon/service"
+)
+
+const botToken = "123456:secret"
+
+// widgetLogin returns the query the Telegram Login Widget sends for the user, signed with botToken.
+func widgetLogin(userID int64, authDate time.Time) url.Values {
+	q := url.Values{
+		"id":         {strconv.FormatInt(userID, 10)},
+		"first_name": {"Michele"},
+		"auth_date":  {strconv.FormatInt(authDate.Unix(), 10)},
+	}
+
+	var fields []string
+	for k := range q {
+		fields = append(fields, k+"="+q.Get(k))
+	}
+	sort.Strings(fields)
+
+	key := sha256.Sum256([]byte(botToken))
+	mac := hmac.New(sha256.New, key[:])
+	mac.Write([]byte(strings.Join(fields, "\n")))
+	q.Set("hash", hex.EncodeToString(mac.Sum(nil)))
+
+	return q
+}
+
+func TestVerifyLogin(t *testing.T) {
+	now := time.Now()
+
+	tampered := widgetLogin(1, now)
+	tampered.Set("id", "2")
+
+	tests := []struct {
+		name    string
+		query   url.Values
+		want    int64
+		wantErr error
+	}{
+		{"Valid", widgetLogin(1, now), 1, nil},
+		{"Tampered", tampered, 0, errInvalidLogin},
+		{"Expired", widgetLogin(1, now.Add(-2*loginMaxAge)), 0, errExpiredLogin},
+		{"No hash", url.Values{"id": {"1"}}, 0, errInvalidLogin},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := verifyLogin(botToken, tt.query, now)
+			if err != tt.wantErr {
+				t.Fatalf("verifyLogin() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("verifyLogin() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSessions(t *testing.T) {
+	s := sessions{key: []byte("key")}
+	now := time.Now()
+	cookie := s.issue(42, now)
+
+	if got, err := s.verify(cookie, now); err != nil || got != 42 {
+		t.Errorf("verify() = %d, %v, want 42", got, err)
+	}
+	if _, err := s.verify(strings.Replace(cookie, "42", "43", 1), now); err != errInvalidSession {
+		t.Errorf("verify() of a tampered session error = %v, want %v", err, errInvalidSession)
+	}
+	if _, err := s.verify(cookie, now.Add(2*sessionDuration)); err != errInvalidSession {
+		t.Errorf("verify() of an expired session error = %v, want %v", err, errInvalidSession)
+	}
+	if _, err := (sessions{key: []byte("other")}).verify(cookie, now); err != errInvalidSession {
+		t.Errorf("verify() with another key error = %v, want %v", err, errInvalidSession)
+	}
+}
+
+func TestServer(t *testing.T) {
+	link := "https://www.amazon.it/dp/B07PHPXHQS"
+	store := memory.New()
+	if err := store.Insert(context.Background(), &watchazon.Product{Title: "Echo Dot", Link: link, Price: watchazon.Money{Amount: 4999, Currency: "EUR"}}, 1); err != nil {
+		t.Fatalf("could not insert product: %v", err)
+	}
+
+	server := httptest.NewServer(New(service.New(scraper.New(), store, 1), botToken, "watchazon_bot"))
+	defer server.Close()
+
+	client := server.Client()
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error { return http.ErrUseLastResponse }
+
+	// Anonymous users get the login widget.
+	if body := get(t, client, server.URL+Prefix+"/", ""); !strings.Contains(body, `data-telegram-login="watchazon_bot"`) {
+		t.Errorf("dashboard without session doesn't show the login widget:\n%s", body)
+	}
+
+	res, err := client.Get(server.URL + Prefix + "/login?" + widgetLogin(1, time.Now()).Encode())
+	if err != nil {
+		t.Fatalf("login error = %v", err)
+	}
+	_ = res.Body.Close()
+	var session string
+	for _, c := range res.Cookies() {
+		if c.Name == sessionCookie {
+			session = c.Value
+		}
+	}
+	if session == "" {
+		t.Fatalf("login didn't set the session cookie")
+	}
+
+	body := get(t, client, server.URL+Prefix+"/", session)
+	if !strings.Contains(body, "Echo Dot") || !strings.Contains(body, "49.99 €") {
+		t.Errorf("dashboard doesn't show the watchlist:\n%s", body)
+	}
+
+	remove := func(csrf string) int {
+		req, _ := http.NewRequest(http.MethodPost, server.URL+Prefix+"/remove", strings.NewReader(url.Values{"link": {link}, "csrf": {csrf}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(&http.Cookie{Name: sessionCookie, Value: session})
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("remove error = %v", err)
+		}
+		_ = res.Body.Close()
+		return res.StatusCode
+	}
+
+	if status := remove("forged"); status != http.StatusForbidden {
+		t.Errorf("remove with a forged csrf token got status %d, want %d", status, http.StatusForbidden)
+	}
+	if status := remove(New(nil, botToken, "").sessions.csrfToken(session)); status != http.StatusSeeOther {
+		t.Errorf("remove got status %d, want %d", status, http.StatusSeeOther)
+	}
+	if records, _ := store.GetUserWatchList(context.Background(), 1); len(records) != 0 {
+		t.Errorf("remove left the watchlist with %d products", len(records))
+	}
+}
+
+func get(t *testing.T, client *http.Client, url, session string) string {
+	t.Helper()
+
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	if session != "" {
+		req.AddCookie(&http.Cookie{Name: sessionCookie, Value: session})
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("GET %s error = %v", url, err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("GET %s error = %v", url, err)
+	}
+	return string(body)
+}
+
+func TestChart(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	points := []watchazon.PricePoint{
+		{Price: watchazon.Money{Amount: 1000}, CheckedAt: start},
+		{Price: watchazon.Money{Amount: 2000}, CheckedAt: start.Add(time.Hour)},
+		{Price: watchazon.Money{Amount: 1500}, CheckedAt: start.Add(2 * time.Hour)},
+	}
+
+	if got, want := chart(points, 300, 60), "0.0,60.0 150.0,0.0 300.0,30.0"; got != want {
+		t.Errorf("chart() = %q, want %q", got, want)
+	}
+	if got := chart(points[:1], 300, 60); got != "" {
+		t.Errorf("chart() of a single point = %q, want none", got)
+	}
+}
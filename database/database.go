@@ -2,36 +2,44 @@ package database
 
 import (
 	"bytes"
+	"context"
 	"encoding/gob"
-	"fmt"
+	"log/slog"
+	"time"
 
 	"github.com/dgraph-io/badger"
 	"github.com/giornetta/watchazon"
 )
 
+// Database is the badger implementation of watchazon.Store.
 type Database struct {
 	db *badger.DB
+	// outboxSeq assigns the IDs of the notifications.
+	outboxSeq *badger.Sequence
 }
 
-type Record struct {
-	*watchazon.Product
-	Users []int64
-}
+var _ watchazon.Store = (*Database)(nil)
 
-func (r *Record) Encode() ([]byte, error) {
+// Encode encodes a record in the current schema version.
+func Encode(r *watchazon.Record) ([]byte, error) {
 	var buf bytes.Buffer
 
 	if err := gob.NewEncoder(&buf).Encode(&r); err != nil {
 		return nil, err
 	}
 
-	return buf.Bytes(), nil
+	return wrap(buf.Bytes()), nil
 }
 
-func DecodeProduct(b []byte) (*Record, error) {
-	reader := bytes.NewReader(b)
+// DecodeProduct decodes a record, migrating it if it was stored with an older schema version.
+func DecodeProduct(b []byte) (*watchazon.Record, error) {
+	payload, err := upgrade(b, recordMigration)
+	if err != nil {
+		return nil, err
+	}
+	reader := bytes.NewReader(payload)
 
-	var r Record
+	var r watchazon.Record
 	if err := gob.NewDecoder(reader).Decode(&r); err != nil {
 		return nil, err
 	}
@@ -40,38 +48,48 @@ func DecodeProduct(b []byte) (*Record, error) {
 }
 
 func Open(path string) (*Database, error) {
-	db, err := badger.Open(badger.DefaultOptions(path))
+	db, err := badger.Open(badger.DefaultOptions(path).WithLogger(newBadgerLogger()))
+	if err != nil {
+		return nil, err
+	}
+
+	seq, err := db.GetSequence([]byte(outboxSequenceKey), 100)
 	if err != nil {
+		_ = db.Close()
 		return nil, err
 	}
 
 	return &Database{
-		db: db,
+		db:        db,
+		outboxSeq: seq,
 	}, nil
 }
 
-func (db *Database) Close() {
-	_ = db.db.Close()
+func (db *Database) Close() error {
+	if err := db.outboxSeq.Release(); err != nil {
+		_ = db.db.Close()
+		return err
+	}
+	return db.db.Close()
 }
 
-func (db *Database) Get(link string) (*Record, error) {
-	key := []byte(link)
-	var r *Record
-	err := db.db.View(func(txn *badger.Txn) error {
-		item, err := txn.Get(key)
-		if err != nil {
-			return err
-		}
-
-		err = item.Value(func(val []byte) error {
-			r, err = DecodeProduct(val)
-			return err
-		})
+// Ping writes the time of the check, which fails if the database is closed or can't be written.
+func (db *Database) Ping(ctx context.Context) error {
+	return db.db.Update(func(txn *badger.Txn) error {
+		now, err := time.Now().MarshalBinary()
 		if err != nil {
 			return err
 		}
+		return txn.Set([]byte(healthKey), now)
+	})
+}
 
-		return nil
+func (db *Database) Get(ctx context.Context, link string) (*watchazon.Record, error) {
+	var r *watchazon.Record
+	err := db.db.View(func(txn *badger.Txn) error {
+		var err error
+		r, err = getRecord(txn, []byte(link))
+		return err
 	})
 	if err != nil {
 		return nil, err
@@ -80,8 +98,8 @@ func (db *Database) Get(link string) (*Record, error) {
 	return r, nil
 }
 
-func (db *Database) GetAll() ([]*Record, error) {
-	records := make([]*Record, 0)
+func (db *Database) GetAll(ctx context.Context) ([]*watchazon.Record, error) {
+	records := make([]*watchazon.Record, 0)
 	err := db.db.View(func(txn *badger.Txn) error {
 		opts := badger.DefaultIteratorOptions
 		opts.PrefetchSize = 10
@@ -91,18 +109,24 @@ func (db *Database) GetAll() ([]*Record, error) {
 
 		for it.Rewind(); it.Valid(); it.Next() {
 			item := it.Item()
-			var rec *Record
+			if !isRecordKey(item.Key()) {
+				continue
+			}
+			var (
+				rec       *watchazon.Record
+				decodeErr error
+			)
 			err := item.Value(func(val []byte) error {
-				r, err := DecodeProduct(val)
-				if err != nil {
-					return err
-				}
-
-				rec = r
+				rec, decodeErr = DecodeProduct(val)
 				return nil
 			})
 			if err != nil {
-				return nil
+				return err
+			}
+			// A record that can't be decoded mustn't hide the others.
+			if decodeErr != nil {
+				slog.Error("could not decode product, skipping it", "link", string(item.Key()), "error", decodeErr)
+				continue
 			}
 			records = append(records, rec)
 		}
@@ -115,86 +139,67 @@ func (db *Database) GetAll() ([]*Record, error) {
 	return records, nil
 }
 
-func (db *Database) Update(product *watchazon.Product, userID int64) error {
+func (db *Database) Update(ctx context.Context, product *watchazon.Product, userID int64) error {
 	key := []byte(product.Link)
 
 	return db.db.Update(func(txn *badger.Txn) error {
-		item, err := txn.Get(key)
-		if err != nil {
-			return err
-		}
-
-		var r *Record
-		err = item.Value(func(val []byte) error {
-			r, err = DecodeProduct(val)
-			return err
-		})
+		r, err := getRecord(txn, key)
 		if err != nil {
 			return err
 		}
 
 		r.Product = product
-		if userID != 0 && !contains(r.Users, userID) {
-			r.Users = append(r.Users, userID)
-		}
-
-		b, err := r.Encode()
-		if err != nil {
-			return err
+		if userID != 0 {
+			r.Subscribe(userID)
+			if err := txn.Set(userIndexKey(userID, product.Link), nil); err != nil {
+				return err
+			}
 		}
 
-		return txn.Set(key, b)
+		return setRecord(txn, r)
 	})
 }
 
-func (db *Database) Insert(product *watchazon.Product, userID int64) error {
+func (db *Database) Insert(ctx context.Context, product *watchazon.Product, userID int64) error {
 	key := []byte(product.Link)
 
 	return db.db.Update(func(txn *badger.Txn) error {
 		_, err := txn.Get(key)
 		if err == nil {
-			return fmt.Errorf("already exists")
+			return watchazon.ErrAlreadyExists
 		}
 
-		p := &Record{
+		r := &watchazon.Record{
 			Product: product,
-			Users:   []int64{userID},
 		}
-		b, err := p.Encode()
-		if err != nil {
+		r.Subscribe(userID)
+
+		if err := txn.Set(userIndexKey(userID, product.Link), nil); err != nil {
 			return err
 		}
 
-		return txn.Set(key, b)
+		return setRecord(txn, r)
 	})
 }
 
-func (db *Database) GetUserWatchList(userID int64) ([]*Record, error) {
-	records := make([]*Record, 0)
+func (db *Database) GetUserWatchList(ctx context.Context, userID int64) ([]*watchazon.Record, error) {
+	records := make([]*watchazon.Record, 0)
 	err := db.db.View(func(txn *badger.Txn) error {
 		opts := badger.DefaultIteratorOptions
-		opts.PrefetchSize = 10
+		opts.PrefetchValues = false
 
 		it := txn.NewIterator(opts)
 		defer it.Close()
 
-		for it.Rewind(); it.Valid(); it.Next() {
-			item := it.Item()
-			var rec *Record
-			err := item.Value(func(val []byte) error {
-				r, err := DecodeProduct(val)
-				if err != nil {
-					return err
-				}
-				rec = r
-				return nil
-			})
+		prefix := userIndexKeyPrefix(userID)
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			link := it.Item().Key()[len(prefix):]
+
+			rec, err := getRecord(txn, link)
 			if err != nil {
 				continue
 			}
-			if contains(rec.Users, userID) {
-				records = append(records, rec)
-			}
+			records = append(records, rec)
 		}
 
 		return nil
@@ -206,52 +211,95 @@ func (db *Database) GetUserWatchList(userID int64) ([]*Record, error) {
 	return records, nil
 }
 
-func (db *Database) RemoveFromWatchList(link string, userID int64) error {
+func (db *Database) RemoveFromWatchList(ctx context.Context, link string, userID int64) error {
 	key := []byte(link)
 
 	return db.db.Update(func(txn *badger.Txn) error {
-		item, err := txn.Get(key)
+		r, err := getRecord(txn, key)
 		if err != nil {
 			return err
 		}
+		if !r.Watched(userID) {
+			return watchazon.ErrNotFound
+		}
 
-		var r *Record
-		err = item.Value(func(val []byte) error {
-			r, err = DecodeProduct(val)
-			if err != nil {
-				return err
-			}
+		r.Unsubscribe(userID)
 
-			return nil
-		})
-		if err != nil {
+		if err := txn.Delete(userIndexKey(userID, link)); err != nil {
 			return err
 		}
 
-		for i, u := range r.Users {
-			if u == userID {
-				r.Users = append(r.Users[:i], r.Users[i+1:]...)
-			}
-		}
-
 		if len(r.Users) == 0 {
+			if err := deleteHistory(txn, link, time.Time{}); err != nil {
+				return err
+			}
 			return txn.Delete(key)
 		}
 
-		b, err := r.Encode()
+		return setRecord(txn, r)
+	})
+}
+
+// SetAlertRule replaces the alert rule of a user watching the product, keeping the base price of the subscription.
+func (db *Database) SetAlertRule(ctx context.Context, link string, userID int64, rule watchazon.AlertRule) error {
+	key := []byte(link)
+
+	return db.db.Update(func(txn *badger.Txn) error {
+		r, err := getRecord(txn, key)
 		if err != nil {
 			return err
 		}
 
-		return txn.Set(key, b)
+		if !r.Watched(userID) {
+			return watchazon.ErrNotFound
+		}
+		r.SetRule(userID, rule)
+
+		return setRecord(txn, r)
 	})
 }
 
-func contains(slice []int64, val int64) bool {
-	for _, v := range slice {
-		if v == val {
-			return true
-		}
+// getRecord reads and decodes the record stored at key, returning watchazon.ErrNotFound if there's none.
+func getRecord(txn *badger.Txn, key []byte) (*watchazon.Record, error) {
+	item, err := txn.Get(key)
+	if err == badger.ErrKeyNotFound {
+		return nil, watchazon.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var r *watchazon.Record
+	err = item.Value(func(val []byte) error {
+		r, err = DecodeProduct(val)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// setRecord encodes and stores the record under its link.
+func setRecord(txn *badger.Txn, r *watchazon.Record) error {
+	b, err := Encode(r)
+	if err != nil {
+		return err
 	}
-	return false
+
+	return txn.Set([]byte(r.Link), b)
+}
+
+// isRecordKey reports whether key belongs to a product record rather than to auxiliary data stored under a prefix.
+func isRecordKey(key []byte) bool {
+	return !isHistoryKey(key) && !isIndexKey(key) && !isOutboxKey(key) && !isSettingsKey(key) && !isTokenKey(key) && !isHealthKey(key)
+}
+
+func isHistoryKey(key []byte) bool {
+	return bytes.HasPrefix(key, []byte(historyPrefix))
+}
+
+func isIndexKey(key []byte) bool {
+	return bytes.HasPrefix(key, []byte(userIndexPrefix))
 }
@@ -0,0 +1,26 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/giornetta/watchazon"
+	"github.com/giornetta/watchazon/storetest"
+)
+
+func openTemp(t *testing.T) *Database {
+	t.Helper()
+
+	db, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("could not open database: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	return db
+}
+
+func TestDatabase(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) watchazon.Store {
+		return openTemp(t)
+	})
+}
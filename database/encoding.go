@@ -0,0 +1,206 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/dgraph-io/badger"
+)
+
+// Records, price points, notifications and user settings are stored in a versioned envelope: a 0x00 byte,
+// which can never start a gob stream, followed by the schema version and the gob encoded payload.
+// Values without the envelope were written before versioning was introduced and are version 0.
+const envelopeMagic byte = 0x00
+
+// SchemaVersion is the version of the values written by the database.
+const SchemaVersion = 2
+
+// A migration upgrades the payloads of the previous schema version.
+// A nil function leaves that kind of payload unchanged.
+type migration struct {
+	record func(payload []byte) ([]byte, error)
+	// pricePoint also receives the key of the point, telling which product it belongs to.
+	pricePoint   func(key, payload []byte) ([]byte, error)
+	notification func(payload []byte) ([]byte, error)
+	user         func(payload []byte) ([]byte, error)
+}
+
+// migrations[v] upgrades the payloads from version v-1 to version v.
+// Every version up to SchemaVersion must be registered.
+var migrations = map[int]migration{
+	// Version 1 introduced the envelope, payloads are unchanged.
+	1: {},
+	// Version 2 replaced the float64 prices with watchazon.Money.
+	2: {record: migrateRecordMoney, pricePoint: migratePricePointMoney},
+}
+
+var errUnknownVersion = errors.New("unknown schema version")
+
+func wrap(payload []byte) []byte {
+	return append([]byte{envelopeMagic, SchemaVersion}, payload...)
+}
+
+// unwrap returns the schema version of a stored value and its payload.
+func unwrap(b []byte) (int, []byte) {
+	if len(b) < 2 || b[0] != envelopeMagic {
+		return 0, b
+	}
+
+	return int(b[1]), b[2:]
+}
+
+// upgrade returns the payload of a stored value migrated to SchemaVersion,
+// using pick to choose the function to apply for the kind of value.
+func upgrade(b []byte, pick func(m migration) func([]byte) ([]byte, error)) ([]byte, error) {
+	version, payload := unwrap(b)
+	if version > SchemaVersion {
+		return nil, fmt.Errorf("%w %d", errUnknownVersion, version)
+	}
+
+	for v := version + 1; v <= SchemaVersion; v++ {
+		m, ok := migrations[v]
+		if !ok {
+			return nil, fmt.Errorf("no migration to schema version %d", v)
+		}
+
+		fn := pick(m)
+		if fn == nil {
+			continue
+		}
+
+		var err error
+		if payload, err = fn(payload); err != nil {
+			return nil, fmt.Errorf("could not migrate to schema version %d: %w", v, err)
+		}
+	}
+
+	return payload, nil
+}
+
+func recordMigration(m migration) func([]byte) ([]byte, error) {
+	return m.record
+}
+
+func notificationMigration(m migration) func([]byte) ([]byte, error) {
+	return m.notification
+}
+
+func userMigration(m migration) func([]byte) ([]byte, error) {
+	return m.user
+}
+
+// pricePointMigration returns the function choosing the migrations of the price point stored at key.
+func pricePointMigration(key []byte) func(m migration) func([]byte) ([]byte, error) {
+	return func(m migration) func([]byte) ([]byte, error) {
+		if m.pricePoint == nil {
+			return nil
+		}
+		return func(payload []byte) ([]byte, error) {
+			return m.pricePoint(key, payload)
+		}
+	}
+}
+
+// SchemaVersions returns how many records are stored with each schema version.
+func (db *Database) SchemaVersions() (map[int]int, error) {
+	versions := make(map[int]int)
+	err := db.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			if !isRecordKey(item.Key()) {
+				continue
+			}
+
+			err := item.Value(func(val []byte) error {
+				v, _ := unwrap(val)
+				versions[v]++
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return versions, nil
+}
+
+// Migrate rewrites every value stored with an older schema version to SchemaVersion,
+// returning how many values were migrated.
+// Values are migrated lazily on read anyway, running Migrate at startup avoids paying that cost every time.
+func (db *Database) Migrate() (int, error) {
+	type outdated struct {
+		key, val []byte
+	}
+
+	values := make([]outdated, 0)
+	err := db.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			key := item.Key()
+			if !isRecordKey(key) && !isHistoryKey(key) && !isNotificationKey(key) && !isSettingsKey(key) {
+				continue
+			}
+
+			err := item.Value(func(val []byte) error {
+				if v, _ := unwrap(val); v < SchemaVersion {
+					values = append(values, outdated{key: item.KeyCopy(nil), val: append([]byte(nil), val...)})
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	wb := db.db.NewWriteBatch()
+	defer wb.Cancel()
+
+	migrated := 0
+	for _, o := range values {
+		pick := recordMigration
+		switch {
+		case isHistoryKey(o.key):
+			pick = pricePointMigration(o.key)
+		case isNotificationKey(o.key):
+			pick = notificationMigration
+		case isSettingsKey(o.key):
+			pick = userMigration
+		}
+
+		payload, err := upgrade(o.val, pick)
+		if err != nil {
+			slog.Warn("could not migrate value", "key", string(o.key), "error", err)
+			continue
+		}
+
+		if err := wb.Set(o.key, wrap(payload)); err != nil {
+			return 0, err
+		}
+		migrated++
+	}
+
+	if err := wb.Flush(); err != nil {
+		return 0, err
+	}
+
+	return migrated, nil
+}
@@ -0,0 +1,125 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger"
+	"github.com/giornetta/watchazon"
+)
+
+func TestDatabase_Migrate(t *testing.T) {
+	db := openTemp(t)
+	link := "https://www.amazon.it/dp/B07PHPXHQS"
+	ctx := context.Background()
+
+	// Values written before the envelope was introduced are bare gob streams, with float64 prices.
+	var record, point bytes.Buffer
+	legacy := &recordV1{
+		Product: &productV1{Link: link, Title: "Echo Dot", Price: 59.99},
+		Users:   []int64{1},
+		Rules:   map[int64]alertRuleV1{1: {Kind: watchazon.AlertTargetPrice, Target: 49.99, BasePrice: 59.99}},
+	}
+	if err := gob.NewEncoder(&record).Encode(&legacy); err != nil {
+		t.Fatalf("could not encode legacy record: %v", err)
+	}
+	checkedAt := time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC)
+	if err := gob.NewEncoder(&point).Encode(&pricePointV1{Price: 59.99, CheckedAt: checkedAt}); err != nil {
+		t.Fatalf("could not encode legacy price point: %v", err)
+	}
+	err := db.db.Update(func(txn *badger.Txn) error {
+		if err := txn.Set([]byte(link), record.Bytes()); err != nil {
+			return err
+		}
+		return txn.Set(historyKey(link, checkedAt), point.Bytes())
+	})
+	if err != nil {
+		t.Fatalf("could not store legacy values: %v", err)
+	}
+
+	price := watchazon.Money{Amount: 5999, Currency: "EUR"}
+	got, err := db.Get(ctx, link)
+	if err != nil {
+		t.Fatalf("could not decode legacy record: %v", err)
+	}
+	want := &watchazon.Product{Link: link, Title: "Echo Dot", Price: price}
+	if !reflect.DeepEqual(got.Product, want) {
+		t.Errorf("Get() got = %+v, want %+v", got.Product, want)
+	}
+	wantRule := watchazon.AlertRule{Kind: watchazon.AlertTargetPrice, Target: watchazon.Money{Amount: 4999, Currency: "EUR"}, BasePrice: price}
+	if r := got.Rule(1); r != wantRule {
+		t.Errorf("Rule(1) got = %+v, want %+v", r, wantRule)
+	}
+
+	history, err := db.PriceHistory(ctx, link, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("could not decode legacy price point: %v", err)
+	}
+	if len(history) != 1 || history[0].Price != price {
+		t.Errorf("PriceHistory() got = %v, want a point at %v", history, price)
+	}
+
+	assertVersions(t, db, map[int]int{0: 1})
+
+	n, err := db.Migrate()
+	if err != nil {
+		t.Fatalf("could not migrate: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("Migrate() got = %d, want 2", n)
+	}
+
+	assertVersions(t, db, map[int]int{SchemaVersion: 1})
+
+	if _, err := db.Get(ctx, link); err != nil {
+		t.Errorf("could not decode migrated record: %v", err)
+	}
+}
+
+func TestDecodeProduct_UnknownVersion(t *testing.T) {
+	b := []byte{envelopeMagic, SchemaVersion + 1}
+	if _, err := DecodeProduct(b); err == nil {
+		t.Errorf("DecodeProduct() on a newer schema version expected an error")
+	}
+}
+
+func assertVersions(t *testing.T, db *Database, want map[int]int) {
+	t.Helper()
+
+	got, err := db.SchemaVersions()
+	if err != nil {
+		t.Fatalf("could not get schema versions: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SchemaVersions() got = %v, want %v", got, want)
+	}
+}
+
+func TestDatabase_GetAll_Undecodable(t *testing.T) {
+	db := openTemp(t)
+	ctx := context.Background()
+	link := "https://www.amazon.it/dp/B07PHPXHQS"
+	if err := db.Insert(ctx, &watchazon.Product{Link: link, Title: "Echo Dot"}, 1); err != nil {
+		t.Fatalf("could not insert product: %v", err)
+	}
+
+	// A record written by a newer version can't be decoded, but doesn't hide the others.
+	err := db.db.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte("https://www.amazon.com/dp/B07GNGJK97"), []byte{envelopeMagic, SchemaVersion + 1})
+	})
+	if err != nil {
+		t.Fatalf("could not store undecodable record: %v", err)
+	}
+
+	records, err := db.GetAll(ctx)
+	if err != nil {
+		t.Fatalf("GetAll() error = %v", err)
+	}
+	if len(records) != 1 || records[0].Link != link {
+		t.Errorf("GetAll() got %d records, want only %s", len(records), link)
+	}
+}
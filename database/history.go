@@ -0,0 +1,156 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/gob"
+	"time"
+
+	"github.com/dgraph-io/badger"
+	"github.com/giornetta/watchazon"
+)
+
+// historyPrefix is prepended to the keys of price points, which are stored as
+// historyPrefix + link + 0x00 + big-endian UnixNano of the check, so that the
+// points of a product are sorted chronologically.
+const historyPrefix = "history:"
+
+func historyKeyPrefix(link string) []byte {
+	return []byte(historyPrefix + link + "\x00")
+}
+
+// linkFromHistoryKey returns the link of the product a price point key belongs to.
+func linkFromHistoryKey(key []byte) string {
+	return string(key[len(historyPrefix) : len(key)-9])
+}
+
+func historyKey(link string, t time.Time) []byte {
+	key := historyKeyPrefix(link)
+
+	var ts [8]byte
+	binary.BigEndian.PutUint64(ts[:], uint64(t.UnixNano()))
+
+	return append(key, ts[:]...)
+}
+
+func encodePricePoint(p *watchazon.PricePoint) ([]byte, error) {
+	var buf bytes.Buffer
+
+	if err := gob.NewEncoder(&buf).Encode(p); err != nil {
+		return nil, err
+	}
+
+	return wrap(buf.Bytes()), nil
+}
+
+func decodePricePoint(key, b []byte) (*watchazon.PricePoint, error) {
+	payload, err := upgrade(b, pricePointMigration(key))
+	if err != nil {
+		return nil, err
+	}
+
+	var p watchazon.PricePoint
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&p); err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+// AppendPrice stores a new price point in the history of the given product.
+func (db *Database) AppendPrice(ctx context.Context, link string, point watchazon.PricePoint) error {
+	b, err := encodePricePoint(&point)
+	if err != nil {
+		return err
+	}
+
+	return db.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(historyKey(link, point.CheckedAt), b)
+	})
+}
+
+// PriceHistory returns the price points of a product checked in the [from, to) window, oldest first.
+// A zero from or to leaves the window open on that side.
+func (db *Database) PriceHistory(ctx context.Context, link string, from, to time.Time) ([]watchazon.PricePoint, error) {
+	points := make([]watchazon.PricePoint, 0)
+	prefix := historyKeyPrefix(link)
+	end := historyKey(link, to)
+
+	start := prefix
+	if !from.IsZero() {
+		start = historyKey(link, from)
+	}
+
+	err := db.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchSize = 50
+
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Seek(start); it.ValidForPrefix(prefix); it.Next() {
+			item := it.Item()
+			if !to.IsZero() && bytes.Compare(item.Key(), end) >= 0 {
+				break
+			}
+
+			err := item.Value(func(val []byte) error {
+				p, err := decodePricePoint(item.Key(), val)
+				if err != nil {
+					return err
+				}
+
+				points = append(points, *p)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return points, nil
+}
+
+// TrimHistory deletes the price points of a product checked before the given time.
+func (db *Database) TrimHistory(ctx context.Context, link string, before time.Time) error {
+	return db.db.Update(func(txn *badger.Txn) error {
+		return deleteHistory(txn, link, before)
+	})
+}
+
+// deleteHistory deletes the price points of a product checked before the given time.
+// A zero before deletes the whole history.
+func deleteHistory(txn *badger.Txn, link string, before time.Time) error {
+	prefix := historyKeyPrefix(link)
+	end := historyKey(link, before)
+
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	keys := make([][]byte, 0)
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		key := it.Item().KeyCopy(nil)
+		if !before.IsZero() && bytes.Compare(key, end) >= 0 {
+			break
+		}
+		keys = append(keys, key)
+	}
+
+	for _, k := range keys {
+		if err := txn.Delete(k); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
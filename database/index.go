@@ -0,0 +1,68 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dgraph-io/badger"
+)
+
+// userIndexPrefix is prepended to the keys of the user index, which are stored as
+// userIndexPrefix + userID + ":" + link with an empty value, so that the watchlist of a user
+// can be read with a prefix scan.
+const userIndexPrefix = "user:"
+
+func userIndexKeyPrefix(userID int64) []byte {
+	return []byte(fmt.Sprintf("%s%d:", userIndexPrefix, userID))
+}
+
+func userIndexKey(userID int64, link string) []byte {
+	return append(userIndexKeyPrefix(userID), link...)
+}
+
+// RebuildUserIndex drops the user index and recreates it from the stored records.
+// It's meant to be run once on databases created before the index existed.
+func (db *Database) RebuildUserIndex() error {
+	stale := make([][]byte, 0)
+	err := db.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		prefix := []byte(userIndexPrefix)
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			stale = append(stale, it.Item().KeyCopy(nil))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	records, err := db.GetAll(context.Background())
+	if err != nil {
+		return err
+	}
+
+	wb := db.db.NewWriteBatch()
+	defer wb.Cancel()
+
+	for _, k := range stale {
+		if err := wb.Delete(k); err != nil {
+			return err
+		}
+	}
+
+	for _, r := range records {
+		for _, u := range r.Users {
+			if err := wb.Set(userIndexKey(u, r.Link), nil); err != nil {
+				return err
+			}
+		}
+	}
+
+	return wb.Flush()
+}
@@ -0,0 +1,73 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dgraph-io/badger"
+	"github.com/giornetta/watchazon"
+)
+
+func TestDatabase_GetUserWatchList(t *testing.T) {
+	db := openTemp(t)
+	echo := "https://www.amazon.it/dp/B07PHPXHQS"
+	band := "https://www.amazon.com/dp/B07GNGJK97"
+	ctx := context.Background()
+
+	if err := db.Insert(ctx, &watchazon.Product{Link: echo}, 1); err != nil {
+		t.Fatalf("could not insert product: %v", err)
+	}
+	if err := db.Insert(ctx, &watchazon.Product{Link: band}, 2); err != nil {
+		t.Fatalf("could not insert product: %v", err)
+	}
+	if err := db.Update(ctx, &watchazon.Product{Link: band}, 1); err != nil {
+		t.Fatalf("could not update product: %v", err)
+	}
+
+	assertWatchList(t, db, 1, echo, band)
+	assertWatchList(t, db, 2, band)
+
+	if err := db.RemoveFromWatchList(ctx, band, 1); err != nil {
+		t.Fatalf("could not remove product: %v", err)
+	}
+	assertWatchList(t, db, 1, echo)
+
+	// Simulate a database created before the index existed.
+	err := db.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(userIndexKey(2, band))
+	})
+	if err != nil {
+		t.Fatalf("could not delete index key: %v", err)
+	}
+	assertWatchList(t, db, 2)
+
+	if err := db.RebuildUserIndex(); err != nil {
+		t.Fatalf("could not rebuild index: %v", err)
+	}
+	assertWatchList(t, db, 1, echo)
+	assertWatchList(t, db, 2, band)
+}
+
+func assertWatchList(t *testing.T, db *Database, userID int64, want ...string) {
+	t.Helper()
+
+	got, err := db.GetUserWatchList(context.Background(), userID)
+	if err != nil {
+		t.Fatalf("could not get watchlist: %v", err)
+	}
+
+	links := make(map[string]bool)
+	for _, r := range got {
+		links[r.Link] = true
+	}
+
+	if len(got) != len(want) {
+		t.Errorf("GetUserWatchList(%d) got %d records, want %v", userID, len(got), want)
+		return
+	}
+	for _, l := range want {
+		if !links[l] {
+			t.Errorf("GetUserWatchList(%d) is missing %s", userID, l)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package database
+
+import (
+	"bytes"
+	"encoding/gob"
+	"math"
+	"time"
+
+	"github.com/giornetta/watchazon"
+)
+
+// The types below are the values as stored up to schema version 1, when prices were float64.
+
+type productV1 struct {
+	Title        string
+	Image        string
+	Link         string
+	Price        float64
+	Availability watchazon.Availability
+	StockLeft    int
+	CheckedAt    time.Time
+}
+
+type alertRuleV1 struct {
+	Kind      watchazon.AlertKind
+	Target    float64
+	Percent   float64
+	BasePrice float64
+}
+
+type recordV1 struct {
+	Product *productV1
+	Users   []int64
+	Rules   map[int64]alertRuleV1
+}
+
+type pricePointV1 struct {
+	Price     float64
+	CheckedAt time.Time
+}
+
+// legacyMoney converts a float64 price of the product at link, which was in the currency of its marketplace.
+func legacyMoney(price float64, link string) watchazon.Money {
+	// Only marketplaces with two digit currencies were supported when prices were float64.
+	m, _ := watchazon.MarketplaceOf(link)
+	return watchazon.Money{Amount: int64(math.Round(price * 100)), Currency: m.Currency}
+}
+
+func migrateRecordMoney(payload []byte) ([]byte, error) {
+	var old recordV1
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&old); err != nil {
+		return nil, err
+	}
+
+	r := &watchazon.Record{
+		Users: old.Users,
+	}
+	var link string
+	if p := old.Product; p != nil {
+		link = p.Link
+		r.Product = &watchazon.Product{
+			Title:        p.Title,
+			Image:        p.Image,
+			Link:         p.Link,
+			Price:        legacyMoney(p.Price, p.Link),
+			Availability: p.Availability,
+			StockLeft:    p.StockLeft,
+			CheckedAt:    p.CheckedAt,
+		}
+	}
+	if old.Rules != nil {
+		r.Rules = make(map[int64]watchazon.AlertRule, len(old.Rules))
+		for userID, rule := range old.Rules {
+			r.Rules[userID] = watchazon.AlertRule{
+				Kind:      rule.Kind,
+				Target:    legacyMoney(rule.Target, link),
+				Percent:   rule.Percent,
+				BasePrice: legacyMoney(rule.BasePrice, link),
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&r); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func migratePricePointMoney(key, payload []byte) ([]byte, error) {
+	var old pricePointV1
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&old); err != nil {
+		return nil, err
+	}
+
+	p := &watchazon.PricePoint{
+		Price:     legacyMoney(old.Price, linkFromHistoryKey(key)),
+		CheckedAt: old.CheckedAt,
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(p); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
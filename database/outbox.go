@@ -0,0 +1,148 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/gob"
+	"time"
+
+	"github.com/dgraph-io/badger"
+	"github.com/giornetta/watchazon"
+)
+
+// outboxPrefix is prepended to the keys of the notifications to deliver, which are stored as
+// outboxPrefix + big-endian ID, so that they are sorted in the order they were enqueued.
+const outboxPrefix = "outbox:"
+
+// outboxSequenceKey stores the sequence the IDs of the notifications are leased from.
+const outboxSequenceKey = "outbox-sequence"
+
+func outboxKey(id uint64) []byte {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], id)
+
+	return append([]byte(outboxPrefix), b[:]...)
+}
+
+func isNotificationKey(key []byte) bool {
+	return bytes.HasPrefix(key, []byte(outboxPrefix))
+}
+
+func isOutboxKey(key []byte) bool {
+	return isNotificationKey(key) || bytes.Equal(key, []byte(outboxSequenceKey))
+}
+
+func encodeNotification(n *watchazon.Notification) ([]byte, error) {
+	var buf bytes.Buffer
+
+	if err := gob.NewEncoder(&buf).Encode(n); err != nil {
+		return nil, err
+	}
+
+	return wrap(buf.Bytes()), nil
+}
+
+func decodeNotification(b []byte) (*watchazon.Notification, error) {
+	payload, err := upgrade(b, notificationMigration)
+	if err != nil {
+		return nil, err
+	}
+
+	var n watchazon.Notification
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&n); err != nil {
+		return nil, err
+	}
+
+	return &n, nil
+}
+
+func (db *Database) EnqueueNotification(ctx context.Context, n *watchazon.Notification) error {
+	id, err := db.outboxSeq.Next()
+	if err != nil {
+		return err
+	}
+	// Sequences start from 0, which is left for notifications not enqueued yet.
+	n.ID = id + 1
+
+	b, err := encodeNotification(n)
+	if err != nil {
+		return err
+	}
+
+	return db.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(outboxKey(n.ID), b)
+	})
+}
+
+func (db *Database) PendingNotifications(ctx context.Context, by time.Time) ([]*watchazon.Notification, error) {
+	pending := make([]*watchazon.Notification, 0)
+	err := db.db.View(func(txn *badger.Txn) error {
+		prefix := []byte(outboxPrefix)
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			err := it.Item().Value(func(val []byte) error {
+				n, err := decodeNotification(val)
+				if err != nil {
+					return err
+				}
+
+				if !n.DueAt.After(by) {
+					pending = append(pending, n)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return pending, nil
+}
+
+func (db *Database) SaveNotification(ctx context.Context, n *watchazon.Notification) error {
+	return db.db.Update(func(txn *badger.Txn) error {
+		key := outboxKey(n.ID)
+
+		item, err := txn.Get(key)
+		if err == badger.ErrKeyNotFound {
+			return watchazon.ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		var stored *watchazon.Notification
+		err = item.Value(func(val []byte) error {
+			stored, err = decodeNotification(val)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		stored.Attempts = n.Attempts
+		stored.DueAt = n.DueAt
+		stored.Delivered = n.Delivered
+
+		b, err := encodeNotification(stored)
+		if err != nil {
+			return err
+		}
+		return txn.Set(key, b)
+	})
+}
+
+func (db *Database) DeleteNotification(ctx context.Context, id uint64) error {
+	return db.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(outboxKey(id))
+	})
+}
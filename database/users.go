@@ -0,0 +1,156 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"strconv"
+
+	"github.com/dgraph-io/badger"
+	"github.com/giornetta/watchazon"
+)
+
+// settingsPrefix is prepended to the keys of the user settings, which are stored as settingsPrefix + userID.
+// It differs from userIndexPrefix so that rebuilding the index leaves the settings alone.
+const settingsPrefix = "settings:"
+
+func settingsKey(userID int64) []byte {
+	return []byte(settingsPrefix + strconv.FormatInt(userID, 10))
+}
+
+func isSettingsKey(key []byte) bool {
+	return bytes.HasPrefix(key, []byte(settingsPrefix))
+}
+
+// tokenPrefix is prepended to the API token hashes, which are stored as tokenPrefix + hash with the user ID as value.
+const tokenPrefix = "token:"
+
+func tokenKey(hash string) []byte {
+	return []byte(tokenPrefix + hash)
+}
+
+func isTokenKey(key []byte) bool {
+	return bytes.HasPrefix(key, []byte(tokenPrefix))
+}
+
+// healthKey is written by Ping, to check that the database can be written.
+const healthKey = "health"
+
+func isHealthKey(key []byte) bool {
+	return bytes.Equal(key, []byte(healthKey))
+}
+
+func encodeUser(u *watchazon.User) ([]byte, error) {
+	var buf bytes.Buffer
+
+	if err := gob.NewEncoder(&buf).Encode(u); err != nil {
+		return nil, err
+	}
+
+	return wrap(buf.Bytes()), nil
+}
+
+func decodeUser(b []byte) (*watchazon.User, error) {
+	payload, err := upgrade(b, userMigration)
+	if err != nil {
+		return nil, err
+	}
+
+	var u watchazon.User
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&u); err != nil {
+		return nil, err
+	}
+
+	return &u, nil
+}
+
+func (db *Database) GetUser(ctx context.Context, id int64) (*watchazon.User, error) {
+	var u *watchazon.User
+	err := db.db.View(func(txn *badger.Txn) error {
+		var err error
+		u, err = getUser(txn, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+func (db *Database) SaveUser(ctx context.Context, u *watchazon.User) error {
+	b, err := encodeUser(u)
+	if err != nil {
+		return err
+	}
+
+	return db.db.Update(func(txn *badger.Txn) error {
+		old, err := getUser(txn, u.ID)
+		if err != nil && err != watchazon.ErrNotFound {
+			return err
+		}
+		if old != nil && old.APIToken != "" && old.APIToken != u.APIToken {
+			if err := txn.Delete(tokenKey(old.APIToken)); err != nil {
+				return err
+			}
+		}
+		if u.APIToken != "" {
+			if err := txn.Set(tokenKey(u.APIToken), []byte(strconv.FormatInt(u.ID, 10))); err != nil {
+				return err
+			}
+		}
+
+		return txn.Set(settingsKey(u.ID), b)
+	})
+}
+
+func (db *Database) GetUserByAPIToken(ctx context.Context, hash string) (*watchazon.User, error) {
+	var u *watchazon.User
+	err := db.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(tokenKey(hash))
+		if err == badger.ErrKeyNotFound {
+			return watchazon.ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		var id int64
+		err = item.Value(func(val []byte) error {
+			id, err = strconv.ParseInt(string(val), 10, 64)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		u, err = getUser(txn, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+func getUser(txn *badger.Txn, id int64) (*watchazon.User, error) {
+	item, err := txn.Get(settingsKey(id))
+	if err == badger.ErrKeyNotFound {
+		return nil, watchazon.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var u *watchazon.User
+	err = item.Value(func(val []byte) error {
+		u, err = decodeUser(val)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
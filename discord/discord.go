@@ -0,0 +1,457 @@
+// Package discord implements the Discord front-end of watchazon, with slash commands and buttons
+// equivalent to the commands of the Telegram bot.
+package discord
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+
+	"github.com/giornetta/watchazon"
+)
+
+// Prefixes of the custom IDs of the buttons, followed by the link of the product.
+const (
+	watchButton   = "watch:"
+	deleteButton  = "delete:"
+	restockButton = "restock:"
+)
+
+// maxResults is how many search results are shown, as each needs a row of buttons and a message can have five.
+const maxResults = 5
+
+// ErrNotDiscordUser is returned when notifying a user who isn't on Discord.
+var ErrNotDiscordUser = errors.New("not a discord user")
+
+var commands = []*discordgo.ApplicationCommand{
+	{
+		Name:        "watch",
+		Description: "Add an Amazon product to your watchlist",
+		Options: []*discordgo.ApplicationCommandOption{
+			{Type: discordgo.ApplicationCommandOptionString, Name: "link", Description: "Link of the product", Required: true},
+		},
+	},
+	{
+		Name:        "list",
+		Description: "Show the products in your watchlist",
+	},
+	{
+		Name:        "search",
+		Description: "Search for products on Amazon",
+		Options: []*discordgo.ApplicationCommandOption{
+			{Type: discordgo.ApplicationCommandOptionString, Name: "query", Description: "What to look for", Required: true},
+			{Type: discordgo.ApplicationCommandOptionString, Name: "marketplace", Description: "Amazon website to search, picked from your language if missing", Choices: marketplaceChoices()},
+		},
+	},
+	{
+		Name:        "token",
+		Description: "Create a token to access the API, revoking the previous one",
+	},
+}
+
+// Bot is the Discord front-end of the service, and delivers notifications as direct messages.
+//
+// Unlike Telegram, Discord doesn't share the location of its users, so the marketplace to search
+// is chosen from their locale instead of through a watchazon.Locator.
+type Bot struct {
+	session *discordgo.Session
+	service watchazon.Service
+	// ctx is canceled by Stop, interrupting the requests to the service made by the interactions in progress.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+var _ watchazon.Notifier = (*Bot)(nil)
+
+func New(token string, svc watchazon.Service) (*Bot, error) {
+	s, err := discordgo.New("Bot " + token)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Bot{
+		session: s,
+		service: svc,
+		ctx:     ctx,
+		cancel:  cancel,
+	}, nil
+}
+
+// Run connects the bot to Discord and registers its commands, which are then handled in the background.
+func (b *Bot) Run() error {
+	b.session.AddHandler(b.handleInteraction)
+
+	if err := b.session.Open(); err != nil {
+		return fmt.Errorf("could not connect to discord: %w", err)
+	}
+
+	if _, err := b.session.ApplicationCommandBulkOverwrite(b.session.State.User.ID, "", commands); err != nil {
+		return fmt.Errorf("could not register commands: %w", err)
+	}
+
+	return nil
+}
+
+func (b *Bot) Stop() {
+	b.cancel()
+	_ = b.session.Close()
+}
+
+// Notify sends the notification to its user as a direct message.
+func (b *Bot) Notify(ctx context.Context, n *watchazon.Notification) error {
+	recipient, ok := snowflake(n.UserID)
+	if !ok {
+		return ErrNotDiscordUser
+	}
+
+	dm, err := b.session.UserChannelCreate(recipient, discordgo.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+
+	title := "🔥 A product in your watchlist has changed price!"
+	if n.BackInStock() {
+		title = "🎉 A product in your watchlist is back in stock!"
+	}
+
+	_, err = b.session.ChannelMessageSendComplex(dm.ID, &discordgo.MessageSend{
+		Content:    title,
+		Embeds:     []*discordgo.MessageEmbed{productEmbed(n.Product)},
+		Components: []discordgo.MessageComponent{discordgo.ActionsRow{Components: []discordgo.MessageComponent{amazonButton(n.Product.Link)}}},
+	}, discordgo.WithContext(ctx))
+	return err
+}
+
+func (b *Bot) handleInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	userID, err := interactionUser(i.Interaction)
+	if err != nil {
+		slog.Error("could not get the user of interaction", "interaction_id", i.ID, "error", err)
+		return
+	}
+
+	switch i.Type {
+	case discordgo.InteractionApplicationCommand:
+		data := i.ApplicationCommandData()
+		switch data.Name {
+		case "watch":
+			b.handleWatch(i.Interaction, userID, data.Options[0].StringValue())
+		case "list":
+			b.handleList(i.Interaction, userID)
+		case "search":
+			b.handleSearch(i.Interaction, userID, data)
+		case "token":
+			b.handleToken(i.Interaction, userID)
+		}
+	case discordgo.InteractionMessageComponent:
+		id := i.MessageComponentData().CustomID
+		switch {
+		case strings.HasPrefix(id, watchButton):
+			b.handleWatch(i.Interaction, userID, strings.TrimPrefix(id, watchButton))
+		case strings.HasPrefix(id, deleteButton):
+			b.handleDelete(i.Interaction, userID, strings.TrimPrefix(id, deleteButton))
+		case strings.HasPrefix(id, restockButton):
+			b.handleRestock(i.Interaction, userID, strings.TrimPrefix(id, restockButton))
+		}
+	}
+}
+
+func (b *Bot) handleWatch(i *discordgo.Interaction, userID int64, link string) {
+	// Scraping takes longer than the time Discord waits for an answer.
+	if err := b.deferAnswer(i); err != nil {
+		slog.Error("could not answer interaction", "interaction_id", i.ID, "error", err)
+		return
+	}
+
+	product, err := b.service.AddToWatchList(b.ctx, link, userID)
+	if err != nil {
+		b.edit(i, err.Error(), nil)
+		return
+	}
+	b.enableNotifications(userID)
+
+	if !product.Availability.Purchasable() {
+		b.edit(i, "✅ Product successfully added to the watchlist, but it's currently out of stock!", []discordgo.MessageComponent{
+			discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+				discordgo.Button{Label: "🔔 Notify me when back in stock", Style: discordgo.PrimaryButton, CustomID: restockButton + product.Link},
+			}},
+		})
+		return
+	}
+
+	b.edit(i, "✅ Product successfully added to the watchlist!", nil)
+}
+
+func (b *Bot) handleList(i *discordgo.Interaction, userID int64) {
+	products, err := b.service.GetUserWatchList(b.ctx, userID)
+	if err != nil {
+		b.respond(i, "An error occurred! Sorry!")
+		return
+	}
+
+	if len(products) == 0 {
+		b.respond(i, "There are no products in your watchlist!")
+		return
+	}
+
+	b.respond(i, fmt.Sprintf("📦 There are %d products in your watchlist:", len(products)))
+	for _, p := range products {
+		_, err := b.session.FollowupMessageCreate(i, false, &discordgo.WebhookParams{
+			Embeds: []*discordgo.MessageEmbed{productEmbed(p)},
+			Components: []discordgo.MessageComponent{discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+				discordgo.Button{Label: "❌ Delete!", Style: discordgo.DangerButton, CustomID: deleteButton + p.Link},
+				amazonButton(p.Link),
+			}}},
+			Flags: discordgo.MessageFlagsEphemeral,
+		})
+		if err != nil {
+			slog.Error("could not send watchlist product", "link", p.Link, "user_id", userID, "error", err)
+		}
+	}
+}
+
+func (b *Bot) handleSearch(i *discordgo.Interaction, userID int64, data discordgo.ApplicationCommandInteractionData) {
+	query := data.Options[0].StringValue()
+	domain := domainForLocale(i.Locale)
+	if len(data.Options) > 1 {
+		domain = watchazon.Domain(data.Options[1].StringValue())
+	}
+
+	if err := b.deferAnswer(i); err != nil {
+		slog.Error("could not answer interaction", "interaction_id", i.ID, "error", err)
+		return
+	}
+
+	products, err := b.service.Search(b.ctx, query, domain)
+	if err != nil {
+		b.edit(i, "An error occurred! Sorry!", nil)
+		return
+	}
+	if len(products) == 0 {
+		b.edit(i, "No products found!", nil)
+		return
+	}
+
+	var (
+		embeds []*discordgo.MessageEmbed
+		rows   []discordgo.MessageComponent
+	)
+	for n, p := range products {
+		if n == maxResults {
+			break
+		}
+
+		embeds = append(embeds, &discordgo.MessageEmbed{
+			Title:       fmt.Sprintf("%d. %s", n+1, p.Title),
+			URL:         p.Link,
+			Description: searchDescription(p),
+			Thumbnail:   &discordgo.MessageEmbedThumbnail{URL: p.Image},
+		})
+		rows = append(rows, discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.Button{Label: fmt.Sprintf("👀 Watch %d", n+1), Style: discordgo.PrimaryButton, CustomID: watchButton + p.Link},
+			amazonButton(p.Link),
+		}})
+	}
+
+	_, err = b.session.InteractionResponseEdit(i, &discordgo.WebhookEdit{Embeds: &embeds, Components: &rows})
+	if err != nil {
+		slog.Error("could not answer interaction", "interaction_id", i.ID, "error", err)
+	}
+
+	slog.Info("search results sent", "user_id", userID, "query", query, "domain", domain, "results", len(embeds))
+}
+
+func (b *Bot) handleToken(i *discordgo.Interaction, userID int64) {
+	token, err := b.service.NewAPIToken(b.ctx, userID)
+	if err != nil {
+		b.respond(i, err.Error())
+		return
+	}
+
+	b.respond(i, fmt.Sprintf("🔑 Your API token is `%s`\n\nKeep it secret, it won't be shown again! Any previous token no longer works.", token))
+}
+
+func (b *Bot) handleDelete(i *discordgo.Interaction, userID int64, link string) {
+	if err := b.service.RemoveFromWatchList(b.ctx, link, userID); err != nil {
+		slog.Error("could not remove product from watchlist", "link", link, "user_id", userID, "error", err)
+		b.respond(i, "An error occurred! Sorry!")
+		return
+	}
+
+	err := b.session.InteractionRespond(i, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Content:    "Successfully Removed!",
+			Embeds:     []*discordgo.MessageEmbed{},
+			Components: []discordgo.MessageComponent{},
+		},
+	})
+	if err != nil {
+		slog.Error("could not answer interaction", "interaction_id", i.ID, "error", err)
+	}
+}
+
+func (b *Bot) handleRestock(i *discordgo.Interaction, userID int64, link string) {
+	err := b.service.SetAlertRule(b.ctx, link, userID, watchazon.AlertRule{Kind: watchazon.AlertBackInStock})
+	if err != nil {
+		slog.Error("could not set restock alert", "link", link, "user_id", userID, "error", err)
+		b.respond(i, err.Error())
+		return
+	}
+
+	b.respond(i, "🔔 You will be notified when it's back in stock!")
+}
+
+// enableNotifications makes the notifications of users who never chose their channels come to Discord,
+// since the default channels are for the users of the Telegram bot.
+func (b *Bot) enableNotifications(userID int64) {
+	u, err := b.service.Settings(b.ctx, userID)
+	if err != nil || len(u.Channels) > 0 {
+		return
+	}
+
+	if err := b.service.SetChannels(b.ctx, userID, []string{watchazon.ChannelDiscord}); err != nil {
+		slog.Error("could not enable discord notifications", "user_id", userID, "error", err)
+	}
+}
+
+// respond answers the interaction with a message only visible to its user.
+func (b *Bot) respond(i *discordgo.Interaction, content string) {
+	err := b.session.InteractionRespond(i, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: content,
+			Flags:   discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		slog.Error("could not answer interaction", "interaction_id", i.ID, "error", err)
+	}
+}
+
+// deferAnswer tells Discord the answer to the interaction will come later with edit, only visible to its user.
+func (b *Bot) deferAnswer(i *discordgo.Interaction) error {
+	return b.session.InteractionRespond(i, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{Flags: discordgo.MessageFlagsEphemeral},
+	})
+}
+
+// edit replaces the deferred answer to the interaction.
+func (b *Bot) edit(i *discordgo.Interaction, content string, components []discordgo.MessageComponent) {
+	edit := &discordgo.WebhookEdit{Content: &content}
+	if components != nil {
+		edit.Components = &components
+	}
+
+	if _, err := b.session.InteractionResponseEdit(i, edit); err != nil {
+		slog.Error("could not answer interaction", "interaction_id", i.ID, "error", err)
+	}
+}
+
+// interactionUser returns the ID of the user of an interaction, which is set in different fields in guilds and DMs.
+func interactionUser(i *discordgo.Interaction) (int64, error) {
+	u := i.User
+	if i.Member != nil {
+		u = i.Member.User
+	}
+	if u == nil {
+		return 0, fmt.Errorf("interaction without user")
+	}
+
+	return userID(u.ID)
+}
+
+// The users of all the platforms share the IDs of the store. Telegram users are positive, so the Discord users,
+// whose snowflakes are positive as well, are stored negated.
+
+// userID returns the ID of the store of the Discord user with the given snowflake.
+func userID(snowflake string) (int64, error) {
+	id, err := strconv.ParseInt(snowflake, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if id <= 0 {
+		return 0, fmt.Errorf("invalid snowflake %s", snowflake)
+	}
+	return -id, nil
+}
+
+// snowflake returns the snowflake of the user with the given ID of the store, reporting whether it's a Discord user.
+func snowflake(userID int64) (string, bool) {
+	if userID >= 0 {
+		return "", false
+	}
+	return strconv.FormatInt(-userID, 10), true
+}
+
+func productEmbed(p *watchazon.Product) *discordgo.MessageEmbed {
+	e := &discordgo.MessageEmbed{
+		Title:     p.Title,
+		URL:       p.Link,
+		Thumbnail: &discordgo.MessageEmbedThumbnail{URL: p.Image},
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "💵 Price", Value: p.Price.String(), Inline: true},
+			{Name: "🏷 Availability", Value: p.FormattedAvailability(), Inline: true},
+			{Name: "🕛 Last check", Value: p.FormattedTime(), Inline: true},
+		},
+	}
+	if p.Failure != "" {
+		e.Fields = append(e.Fields, &discordgo.MessageEmbedField{Name: "⚠️ Last check failed", Value: p.Failure})
+	}
+
+	return e
+}
+
+func amazonButton(link string) discordgo.Button {
+	return discordgo.Button{Label: "✔️ Go to Amazon!", Style: discordgo.LinkButton, URL: link}
+}
+
+// searchDescription returns the description of a search result, showing its price or why it can't be bought.
+func searchDescription(p *watchazon.Product) string {
+	if !p.Availability.Purchasable() {
+		return p.FormattedAvailability()
+	}
+
+	return p.Price.String()
+}
+
+// localeDomains are the marketplaces of the Discord locales that don't match a single language.
+var localeDomains = map[discordgo.Locale]watchazon.Domain{
+	discordgo.EnglishUS:    "com",
+	discordgo.EnglishGB:    "co.uk",
+	discordgo.PortugueseBR: "com.br",
+	discordgo.SpanishES:    "es",
+	discordgo.SpanishLATAM: "com.mx",
+	discordgo.Hindi:        "in",
+}
+
+// domainForLocale returns the marketplace for the locale of a Discord client, e.g. it for Italian,
+// falling back to watchazon.DefaultDomain.
+func domainForLocale(l discordgo.Locale) watchazon.Domain {
+	if d, ok := localeDomains[l]; ok {
+		return d
+	}
+
+	language := strings.SplitN(string(l), "-", 2)[0]
+	for _, m := range watchazon.Marketplaces() {
+		if m.Language == language && m.Language != "en" {
+			return m.Domain
+		}
+	}
+
+	return watchazon.DefaultDomain
+}
+
+func marketplaceChoices() []*discordgo.ApplicationCommandOptionChoice {
+	var choices []*discordgo.ApplicationCommandOptionChoice
+	for _, m := range watchazon.Marketplaces() {
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: m.Host(), Value: string(m.Domain)})
+	}
+	return choices
+}
@@ -0,0 +1,51 @@
+package discord
+
+import (
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+
+	"github.com/giornetta/watchazon"
+)
+
+func TestDomainForLocale(t *testing.T) {
+	tests := []struct {
+		locale discordgo.Locale
+		want   watchazon.Domain
+	}{
+		{discordgo.Italian, "it"},
+		{discordgo.EnglishGB, "co.uk"},
+		{discordgo.SpanishLATAM, "com.mx"},
+		{discordgo.Swedish, "se"},
+		{discordgo.Japanese, "co.jp"},
+		{discordgo.Korean, watchazon.DefaultDomain},
+		{discordgo.Unknown, watchazon.DefaultDomain},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.locale), func(t *testing.T) {
+			if got := domainForLocale(tt.locale); got != tt.want {
+				t.Errorf("domainForLocale() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserID(t *testing.T) {
+	// Discord users are stored apart from the Telegram ones, which are positive.
+	id, err := userID("175928847299117063")
+	if err != nil || id != -175928847299117063 {
+		t.Fatalf("userID() got = %d, %v, want -175928847299117063", id, err)
+	}
+	if s, ok := snowflake(id); !ok || s != "175928847299117063" {
+		t.Errorf("snowflake() got = %q, %v, want the original snowflake", s, ok)
+	}
+
+	if _, ok := snowflake(123456789); ok {
+		t.Error("snowflake() of a Telegram user reported a Discord one")
+	}
+	for _, invalid := range []string{"0", "-5", "abc"} {
+		if _, err := userID(invalid); err == nil {
+			t.Errorf("userID(%q) error = nil, want one", invalid)
+		}
+	}
+}
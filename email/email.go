@@ -0,0 +1,203 @@
+// Package email delivers notifications by email through an SMTP server.
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/giornetta/watchazon"
+)
+
+//go:embed templates
+var templates embed.FS
+
+var (
+	htmlTemplate = htmltemplate.Must(htmltemplate.ParseFS(templates, "templates/notification.html"))
+	textTemplate = texttemplate.Must(texttemplate.ParseFS(templates, "templates/notification.txt"))
+)
+
+// ErrNoAddress is returned when notifying a user who didn't set an email address.
+var ErrNoAddress = errors.New("user has no email address")
+
+// Users gives access to the email addresses of the users.
+type Users interface {
+	GetUser(ctx context.Context, id int64) (*watchazon.User, error)
+}
+
+// Notifier sends the notifications to the email address of their user.
+type Notifier struct {
+	addr  string
+	host  string
+	auth  smtp.Auth
+	from  string
+	users Users
+}
+
+var _ watchazon.Notifier = (*Notifier)(nil)
+
+// New returns a Notifier sending emails from the given address through the SMTP server at addr (host:port).
+// Authentication is only used when username isn't empty.
+func New(addr, username, password, from string, users Users) *Notifier {
+	n := &Notifier{
+		addr:  addr,
+		host:  addr,
+		from:  from,
+		users: users,
+	}
+	if i := strings.LastIndex(addr, ":"); i >= 0 {
+		n.host = addr[:i]
+	}
+
+	if username != "" {
+		n.auth = smtp.PlainAuth("", username, password, n.host)
+	}
+
+	return n
+}
+
+func (e *Notifier) Notify(ctx context.Context, n *watchazon.Notification) error {
+	u, err := e.users.GetUser(ctx, n.UserID)
+	if err != nil && !errors.Is(err, watchazon.ErrNotFound) {
+		return fmt.Errorf("could not get settings of %d: %w", n.UserID, err)
+	}
+	if u == nil || u.Email == "" {
+		return ErrNoAddress
+	}
+
+	msg, err := e.message(u.Email, n)
+	if err != nil {
+		return err
+	}
+
+	return e.send(ctx, u.Email, msg)
+}
+
+// send delivers msg to the given address as smtp.SendMail does, but giving up when ctx is done.
+func (e *Notifier) send(ctx context.Context, to string, msg []byte) error {
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", e.addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return err
+		}
+	}
+	// Closing the connection interrupts the session when ctx is canceled before its deadline.
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+
+	c, err := smtp.NewClient(conn, e.host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: e.host}); err != nil {
+			return err
+		}
+	}
+	if e.auth != nil {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errors.New("smtp server doesn't support AUTH")
+		}
+		if err := c.Auth(e.auth); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mail(e.from); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
+
+// data is what the templates are executed with.
+type data struct {
+	Subject string
+	*watchazon.Notification
+}
+
+// message returns the email for the notification, with both a plain text and an HTML version.
+func (e *Notifier) message(to string, n *watchazon.Notification) ([]byte, error) {
+	d := data{Subject: subject(n), Notification: n}
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	if err := writePart(w, "text/plain", func(wr io.Writer) error { return textTemplate.Execute(wr, d) }); err != nil {
+		return nil, fmt.Errorf("could not render text email: %w", err)
+	}
+	if err := writePart(w, "text/html", func(wr io.Writer) error { return htmlTemplate.Execute(wr, d) }); err != nil {
+		return nil, fmt.Errorf("could not render html email: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", e.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", d.Subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", w.Boundary())
+	msg.Write(body.Bytes())
+
+	return msg.Bytes(), nil
+}
+
+// writePart adds a quoted-printable part of the given type to w, with the content written by render.
+func writePart(w *multipart.Writer, contentType string, render func(io.Writer) error) error {
+	part, err := w.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {contentType + "; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return err
+	}
+
+	qp := quotedprintable.NewWriter(part)
+	if err := render(qp); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+func subject(n *watchazon.Notification) string {
+	if n.BackInStock() {
+		return "🎉 A product in your watchlist is back in stock!"
+	}
+	return "🔥 A product in your watchlist has changed price!"
+}
@@ -0,0 +1,211 @@
+package email
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/giornetta/watchazon"
+	"github.com/giornetta/watchazon/memory"
+)
+
+// fakeSMTP accepts a single SMTP session on a local port, sending the received message on the returned channel.
+func fakeSMTP(t *testing.T) (string, <-chan string) {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+
+	messages := make(chan string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		reply := func(s string) { _, _ = io.WriteString(conn, s+"\r\n") }
+
+		reply("220 localhost ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+
+			switch cmd := strings.ToUpper(strings.Fields(line + " ")[0]); cmd {
+			case "EHLO", "HELO":
+				reply("250 localhost")
+			case "MAIL", "RCPT", "RSET", "NOOP":
+				reply("250 OK")
+			case "DATA":
+				reply("354 End data with <CR><LF>.<CR><LF>")
+				var msg strings.Builder
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line == ".\r\n" {
+						break
+					}
+					msg.WriteString(strings.TrimPrefix(line, "."))
+				}
+				messages <- msg.String()
+				reply("250 OK")
+			case "QUIT":
+				reply("221 Bye")
+				return
+			default:
+				reply("502 Command not implemented")
+			}
+		}
+	}()
+
+	return l.Addr().String(), messages
+}
+
+func TestNotifier_Notify(t *testing.T) {
+	addr, messages := fakeSMTP(t)
+
+	users := memory.New()
+	if err := users.SaveUser(context.Background(), &watchazon.User{ID: 1, Email: "user@example.com"}); err != nil {
+		t.Fatalf("SaveUser() error = %v", err)
+	}
+
+	n := &watchazon.Notification{
+		ID:     1,
+		UserID: 1,
+		Product: &watchazon.Product{
+			Title:        "Nintendo Switch",
+			Link:         "https://www.amazon.it/dp/B07VJRZ62R",
+			Price:        watchazon.Money{Amount: 29999, Currency: "EUR"},
+			Availability: watchazon.InStock,
+			CheckedAt:    time.Date(2024, 1, 2, 15, 4, 0, 0, time.UTC),
+		},
+		Previous: &watchazon.Product{
+			Price:        watchazon.Money{Amount: 32999, Currency: "EUR"},
+			Availability: watchazon.InStock,
+		},
+	}
+
+	e := New(addr, "", "", "watchazon@example.com", users)
+	if err := e.Notify(context.Background(), n); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+
+	var raw string
+	select {
+	case raw = <-messages:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Notify() didn't send any message")
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(raw))
+	if err != nil {
+		t.Fatalf("could not parse message: %v", err)
+	}
+	if to := msg.Header.Get("To"); to != "user@example.com" {
+		t.Errorf("Notify() sent to %q, want %q", to, "user@example.com")
+	}
+	if got, _ := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject")); got != subject(n) {
+		t.Errorf("Notify() got subject %q, want %q", got, subject(n))
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Notify() got content type %q, want multipart/alternative", msg.Header.Get("Content-Type"))
+	}
+
+	var types []string
+	parts := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := parts.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("could not read part: %v", err)
+		}
+
+		// NextPart decodes the quoted-printable parts by itself.
+		body, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatalf("could not read part: %v", err)
+		}
+
+		contentType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		types = append(types, contentType)
+		for _, want := range []string{"Nintendo Switch", "299.99 €", "329.99 €", n.Product.Link} {
+			if !strings.Contains(string(body), want) {
+				t.Errorf("Notify() %s part doesn't contain %q:\n%s", contentType, want, body)
+			}
+		}
+	}
+
+	if strings.Join(types, ",") != "text/plain,text/html" {
+		t.Errorf("Notify() got parts %v, want [text/plain text/html]", types)
+	}
+}
+
+func TestNotifier_Notify_NoAddress(t *testing.T) {
+	e := New("127.0.0.1:0", "", "", "watchazon@example.com", memory.New())
+
+	err := e.Notify(context.Background(), &watchazon.Notification{UserID: 1, Product: &watchazon.Product{}})
+	if err != ErrNoAddress {
+		t.Errorf("Notify() error = %v, want %v", err, ErrNoAddress)
+	}
+}
+
+func TestNotifier_Notify_Timeout(t *testing.T) {
+	// The server accepts the connection but never greets.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		if conn, err := l.Accept(); err == nil {
+			accepted <- conn
+		}
+	}()
+	defer func() {
+		select {
+		case conn := <-accepted:
+			_ = conn.Close()
+		default:
+		}
+	}()
+
+	users := memory.New()
+	if err := users.SaveUser(context.Background(), &watchazon.User{ID: 1, Email: "user@example.com"}); err != nil {
+		t.Fatalf("SaveUser() error = %v", err)
+	}
+	e := New(l.Addr().String(), "", "", "watchazon@example.com", users)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- e.Notify(ctx, &watchazon.Notification{UserID: 1, Product: &watchazon.Product{}}) }()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("Notify() to a stuck server error = nil, want one")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Notify() didn't give up after the deadline")
+	}
+}
@@ -0,0 +1,160 @@
+// Package health serves the liveness and readiness of the process, checking its subsystems.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// A Func checks a subsystem, returning an error if it's not working.
+// The detail is shown to operators either way, and may be nil.
+type Func func(ctx context.Context) (detail map[string]interface{}, err error)
+
+// checkTimeout bounds each check, which fails if it takes longer.
+const checkTimeout = 5 * time.Second
+
+type check struct {
+	name string
+	fn   Func
+	// live checks are part of the liveness as well as of the readiness.
+	live bool
+}
+
+// Checker runs the checks of the subsystems for the /healthz and /readyz endpoints.
+type Checker struct {
+	mu     sync.RWMutex
+	checks []check
+}
+
+func New() *Checker {
+	return &Checker{}
+}
+
+// Liveness registers a check of both /healthz and /readyz: its failure means that the process must be restarted.
+func (c *Checker) Liveness(name string, fn Func) {
+	c.add(check{name: name, fn: fn, live: true})
+}
+
+// Readiness registers a check of /readyz only: its failure means that the process can't work properly,
+// but restarting it wouldn't help.
+func (c *Checker) Readiness(name string, fn Func) {
+	c.add(check{name: name, fn: fn})
+}
+
+func (c *Checker) add(ch check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.checks = append(c.checks, ch)
+}
+
+// Healthz serves the liveness checks.
+func (c *Checker) Healthz() http.Handler {
+	return c.handler(true)
+}
+
+// Readyz serves all the checks.
+func (c *Checker) Readyz() http.Handler {
+	return c.handler(false)
+}
+
+// A Report is the outcome of the checks, served as JSON with status 200 if all passed or 503 otherwise.
+type Report struct {
+	Status string             `json:"status"`
+	Checks map[string]*Result `json:"checks"`
+}
+
+// A Result is the outcome of a check.
+type Result struct {
+	Status   string                 `json:"status"`
+	Error    string                 `json:"error,omitempty"`
+	Duration string                 `json:"duration"`
+	Detail   map[string]interface{} `json:"detail,omitempty"`
+}
+
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+func (c *Checker) handler(liveOnly bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := c.Run(r.Context(), liveOnly)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if report.Status != StatusOK {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(report)
+	})
+}
+
+// Run runs the checks concurrently, only the liveness ones if liveOnly is set.
+func (c *Checker) Run(ctx context.Context, liveOnly bool) *Report {
+	c.mu.RLock()
+	checks := make([]check, 0, len(c.checks))
+	for _, ch := range c.checks {
+		if ch.live || !liveOnly {
+			checks = append(checks, ch)
+		}
+	}
+	c.mu.RUnlock()
+
+	results := make([]*Result, len(checks))
+	var wg sync.WaitGroup
+	for i, ch := range checks {
+		wg.Add(1)
+		go func(i int, ch check) {
+			defer wg.Done()
+			results[i] = run(ctx, ch.fn)
+		}(i, ch)
+	}
+	wg.Wait()
+
+	report := &Report{Status: StatusOK, Checks: make(map[string]*Result, len(checks))}
+	for i, ch := range checks {
+		report.Checks[ch.name] = results[i]
+		if results[i].Status != StatusOK {
+			report.Status = StatusFail
+		}
+	}
+
+	return report
+}
+
+// run runs a check within checkTimeout.
+func run(ctx context.Context, fn Func) *Result {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	start := time.Now()
+	type outcome struct {
+		detail map[string]interface{}
+		err    error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		detail, err := fn(ctx)
+		done <- outcome{detail, err}
+	}()
+
+	var o outcome
+	select {
+	case o = <-done:
+	case <-ctx.Done():
+		o.err = ctx.Err()
+	}
+
+	res := &Result{Status: StatusOK, Duration: time.Since(start).String(), Detail: o.detail}
+	if o.err != nil {
+		res.Status, res.Error = StatusFail, o.err.Error()
+	}
+	return res
+}
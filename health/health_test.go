@@ -0,0 +1,71 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestChecker(t *testing.T) {
+	c := New()
+	c.Liveness("store", func(ctx context.Context) (map[string]interface{}, error) {
+		return nil, nil
+	})
+	c.Readiness("scraper", func(ctx context.Context) (map[string]interface{}, error) {
+		return map[string]interface{}{"error_rate": 0.8}, errors.New("too many errors")
+	})
+
+	tests := []struct {
+		name    string
+		handler http.Handler
+		code    int
+		checks  []string
+	}{
+		{"Healthz", c.Healthz(), http.StatusOK, []string{"store"}},
+		{"Readyz", c.Readyz(), http.StatusServiceUnavailable, []string{"store", "scraper"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			tt.handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if w.Code != tt.code {
+				t.Errorf("status = %d, want %d", w.Code, tt.code)
+			}
+			var report Report
+			if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+				t.Fatalf("could not decode report: %v", err)
+			}
+			if len(report.Checks) != len(tt.checks) {
+				t.Errorf("report has checks %v, want %v", report.Checks, tt.checks)
+			}
+			for _, name := range tt.checks {
+				if _, ok := report.Checks[name]; !ok {
+					t.Errorf("report is missing check %s", name)
+				}
+			}
+		})
+	}
+
+	report := c.Run(context.Background(), false)
+	if s := report.Checks["scraper"]; s.Status != StatusFail || s.Error != "too many errors" || s.Detail["error_rate"] != 0.8 {
+		t.Errorf("scraper check = %+v, want a failure with its detail", s)
+	}
+}
+
+func TestChecker_Timeout(t *testing.T) {
+	c := New()
+	c.Liveness("stuck", func(ctx context.Context) (map[string]interface{}, error) {
+		<-ctx.Done()
+		return nil, nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if r := c.Run(ctx, true).Checks["stuck"]; r.Status != StatusFail {
+		t.Errorf("stuck check status = %s, want %s", r.Status, StatusFail)
+	}
+}
@@ -3,7 +3,9 @@ package locator
 import (
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"time"
 
 	"github.com/giornetta/watchazon"
 )
@@ -46,27 +48,27 @@ func (s *service) Locate(lat, long float32) (watchazon.Domain, error) {
 
 	url := fmt.Sprintf("https://reverse.geocoder.api.here.com/6.2/reversegeocode.json?app_id=%s&app_code=%s&mode=trackPosition&pos=%f,%f,0&maxresults=1", s.appID, s.appCode, lat, long)
 
+	start := time.Now()
 	res, err := c.Get(url)
-	if err != nil || res.StatusCode != 200 {
+	if err != nil {
 		return "", fmt.Errorf("could not get location: %v", err)
 	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("could not get location: %s", res.Status)
+	}
 
 	var b apiResponse
 	if err := json.NewDecoder(res.Body).Decode(&b); err != nil {
 		return "", err
 	}
-
-	var domain watchazon.Domain
-	switch b.Response.View[0].Result[0].Location.Address.Country {
-	case "ITA":
-		domain = "it"
-	case "DEU":
-		domain = "de"
-	case "ESP":
-		domain = "es"
-	default:
-		domain = "com"
+	if len(b.Response.View) == 0 || len(b.Response.View[0].Result) == 0 {
+		return "", fmt.Errorf("no address found at %f,%f", lat, long)
 	}
 
+	country := b.Response.View[0].Result[0].Location.Address.Country
+	domain := watchazon.MarketplaceForCountry(country).Domain
+	slog.Debug("located user", "country", country, "domain", domain, "duration", time.Since(start))
+
 	return domain, nil
 }
@@ -0,0 +1,59 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, "json", slog.LevelWarn)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	logger.Info("dropped")
+	logger.Warn("kept", "link", "https://www.amazon.it/dp/B07PHPXHQS")
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("could not decode %q: %v", buf.String(), err)
+	}
+	if record["msg"] != "kept" || record["link"] != "https://www.amazon.it/dp/B07PHPXHQS" {
+		t.Errorf("logged %v, want the warning with its link", record)
+	}
+
+	buf.Reset()
+	var level slog.LevelVar
+	logger, err = New(&buf, "", &level)
+	if err != nil {
+		t.Fatalf("New() with defaults error = %v", err)
+	}
+	logger.Debug("dropped")
+	logger.Info("kept")
+	if got := buf.String(); strings.Contains(got, "dropped") || !strings.Contains(got, "msg=kept") {
+		t.Errorf("logged %q, want only the info record as text", got)
+	}
+
+	// The level can be lowered while the logger is in use.
+	level.Set(slog.LevelDebug)
+	logger.Debug("debugging")
+	if got := buf.String(); !strings.Contains(got, "msg=debugging") {
+		t.Errorf("logged %q, want the debug record after lowering the level", got)
+	}
+}
+
+func TestParseLevel_Invalid(t *testing.T) {
+	if _, err := New(&bytes.Buffer{}, "xml", nil); err == nil {
+		t.Errorf("New() with an invalid format expected an error")
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Errorf("ParseLevel() with an invalid level expected an error")
+	}
+	if l, err := ParseLevel("WARN"); err != nil || l != slog.LevelWarn {
+		t.Errorf("ParseLevel(WARN) = %v, %v, want %v", l, err, slog.LevelWarn)
+	}
+}
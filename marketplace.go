@@ -0,0 +1,131 @@
+package watchazon
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// A Marketplace is one of the Amazon websites, along with what's needed to scrape it.
+type Marketplace struct {
+	Domain Domain
+	// Currency is the ISO 4217 code of the currency prices are shown in.
+	Currency string
+	// DecimalSeparator separates the minor units in the prices shown by the website.
+	// Any other character of a price, such as grouping separators and symbols, is ignored.
+	DecimalSeparator rune
+	// SearchURL is the link of the search page, formatted with the escaped query.
+	SearchURL string
+	// Countries are the ISO 3166-1 alpha-3 codes of the countries served by the website.
+	Countries []string
+	// Language is the ISO 639-1 code of the main language of the website.
+	Language string
+}
+
+// marketplaces is the registry of the supported Amazon websites.
+// Adding a marketplace only requires adding an entry, and a currency format in currencyFormats if missing.
+var marketplaces = []Marketplace{
+	{Domain: "com", Currency: "USD", DecimalSeparator: '.', SearchURL: "https://www.amazon.com/s?k=%s", Countries: []string{"USA"}, Language: "en"},
+	{Domain: "ca", Currency: "CAD", DecimalSeparator: '.', SearchURL: "https://www.amazon.ca/s?k=%s", Countries: []string{"CAN"}, Language: "en"},
+	{Domain: "com.mx", Currency: "MXN", DecimalSeparator: '.', SearchURL: "https://www.amazon.com.mx/s?k=%s", Countries: []string{"MEX"}, Language: "es"},
+	{Domain: "com.br", Currency: "BRL", DecimalSeparator: ',', SearchURL: "https://www.amazon.com.br/s?k=%s", Countries: []string{"BRA"}, Language: "pt"},
+	{Domain: "co.uk", Currency: "GBP", DecimalSeparator: '.', SearchURL: "https://www.amazon.co.uk/s?k=%s", Countries: []string{"GBR", "IRL"}, Language: "en"},
+	{Domain: "de", Currency: "EUR", DecimalSeparator: ',', SearchURL: "https://www.amazon.de/s?k=%s", Countries: []string{"DEU", "AUT", "CHE", "LUX"}, Language: "de"},
+	{Domain: "fr", Currency: "EUR", DecimalSeparator: ',', SearchURL: "https://www.amazon.fr/s?k=%s", Countries: []string{"FRA", "MCO"}, Language: "fr"},
+	{Domain: "it", Currency: "EUR", DecimalSeparator: ',', SearchURL: "https://www.amazon.it/s?k=%s", Countries: []string{"ITA", "SMR", "VAT"}, Language: "it"},
+	{Domain: "es", Currency: "EUR", DecimalSeparator: ',', SearchURL: "https://www.amazon.es/s?k=%s", Countries: []string{"ESP", "AND", "PRT"}, Language: "es"},
+	{Domain: "com.be", Currency: "EUR", DecimalSeparator: ',', SearchURL: "https://www.amazon.com.be/s?k=%s", Countries: []string{"BEL"}, Language: "fr"},
+	{Domain: "nl", Currency: "EUR", DecimalSeparator: ',', SearchURL: "https://www.amazon.nl/s?k=%s", Countries: []string{"NLD"}, Language: "nl"},
+	{Domain: "se", Currency: "SEK", DecimalSeparator: ',', SearchURL: "https://www.amazon.se/s?k=%s", Countries: []string{"SWE"}, Language: "sv"},
+	{Domain: "pl", Currency: "PLN", DecimalSeparator: ',', SearchURL: "https://www.amazon.pl/s?k=%s", Countries: []string{"POL"}, Language: "pl"},
+	{Domain: "com.tr", Currency: "TRY", DecimalSeparator: ',', SearchURL: "https://www.amazon.com.tr/s?k=%s", Countries: []string{"TUR"}, Language: "tr"},
+	{Domain: "ae", Currency: "AED", DecimalSeparator: '.', SearchURL: "https://www.amazon.ae/s?k=%s", Countries: []string{"ARE"}, Language: "en"},
+	{Domain: "sa", Currency: "SAR", DecimalSeparator: '.', SearchURL: "https://www.amazon.sa/s?k=%s", Countries: []string{"SAU"}, Language: "ar"},
+	{Domain: "eg", Currency: "EGP", DecimalSeparator: '.', SearchURL: "https://www.amazon.eg/s?k=%s", Countries: []string{"EGY"}, Language: "ar"},
+	{Domain: "in", Currency: "INR", DecimalSeparator: '.', SearchURL: "https://www.amazon.in/s?k=%s", Countries: []string{"IND"}, Language: "en"},
+	{Domain: "co.jp", Currency: "JPY", DecimalSeparator: '.', SearchURL: "https://www.amazon.co.jp/s?k=%s", Countries: []string{"JPN"}, Language: "ja"},
+	{Domain: "com.au", Currency: "AUD", DecimalSeparator: '.', SearchURL: "https://www.amazon.com.au/s?k=%s", Countries: []string{"AUS", "NZL"}, Language: "en"},
+	{Domain: "sg", Currency: "SGD", DecimalSeparator: '.', SearchURL: "https://www.amazon.sg/s?k=%s", Countries: []string{"SGP"}, Language: "en"},
+}
+
+// DefaultDomain is the marketplace used when the one of the user is unknown.
+const DefaultDomain Domain = "com"
+
+// ErrUnknownMarketplace is returned for links that don't belong to a supported Amazon website.
+var ErrUnknownMarketplace = errors.New("unknown marketplace")
+
+// Marketplaces returns all the supported marketplaces.
+func Marketplaces() []Marketplace {
+	return append([]Marketplace(nil), marketplaces...)
+}
+
+// LookupMarketplace returns the marketplace of the given domain, reporting whether it's supported.
+func LookupMarketplace(d Domain) (Marketplace, bool) {
+	for _, m := range marketplaces {
+		if m.Domain == d {
+			return m, true
+		}
+	}
+	return Marketplace{}, false
+}
+
+// MarketplaceOf returns the marketplace a link belongs to, e.g. co.uk for https://www.amazon.co.uk/dp/B07PHPXHQS.
+func MarketplaceOf(link string) (Marketplace, error) {
+	u, err := url.Parse(link)
+	if err != nil {
+		return Marketplace{}, err
+	}
+
+	host := strings.ToLower(u.Hostname())
+	i := strings.Index(host, "amazon.")
+	if i < 0 || i > 0 && host[i-1] != '.' {
+		return Marketplace{}, fmt.Errorf("%w: %s", ErrUnknownMarketplace, host)
+	}
+
+	m, ok := LookupMarketplace(Domain(host[i+len("amazon."):]))
+	if !ok {
+		return Marketplace{}, fmt.Errorf("%w: %s", ErrUnknownMarketplace, host)
+	}
+
+	return m, nil
+}
+
+// MarketplaceForCountry returns the marketplace serving the country with the given ISO 3166-1 alpha-3 code,
+// falling back to the one of DefaultDomain.
+func MarketplaceForCountry(code string) Marketplace {
+	for _, m := range marketplaces {
+		for _, c := range m.Countries {
+			if c == code {
+				return m
+			}
+		}
+	}
+
+	m, _ := LookupMarketplace(DefaultDomain)
+	return m
+}
+
+// Host returns the host name of the website, e.g. www.amazon.co.uk.
+func (m Marketplace) Host() string {
+	return "www.amazon." + string(m.Domain)
+}
+
+// URL returns the link of the given path on the website.
+func (m Marketplace) URL(path string) string {
+	return "https://" + m.Host() + path
+}
+
+// SearchLink returns the link of the search page for query.
+func (m Marketplace) SearchLink(query string) string {
+	return fmt.Sprintf(m.SearchURL, url.QueryEscape(query))
+}
+
+// Hosts returns the host names of all the supported marketplaces.
+func Hosts() []string {
+	hosts := make([]string, 0, len(marketplaces))
+	for _, m := range marketplaces {
+		hosts = append(hosts, m.Host())
+	}
+	return hosts
+}
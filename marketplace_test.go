@@ -0,0 +1,67 @@
+package watchazon
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMarketplaceOf(t *testing.T) {
+	tests := []struct {
+		link    string
+		want    Domain
+		wantErr error
+	}{
+		{"https://www.amazon.com/dp/B07GNGJK97", "com", nil},
+		{"https://www.amazon.co.uk/dp/B07PJV3JPR", "co.uk", nil},
+		{"https://www.amazon.com.au/dp/B07PJV3JPR", "com.au", nil},
+		{"https://www.amazon.co.jp/dp/B07PJV3JPR", "co.jp", nil},
+		{"https://smile.amazon.de/dp/B07PJV3JPR", "de", nil},
+		{"https://amazon.it/dp/B07PHPXHQS", "it", nil},
+		{"https://www.amazon.com.be/dp/B07PHPXHQS", "com.be", nil},
+		{"https://www.amazon.eg/dp/B07PHPXHQS", "eg", nil},
+		{"https://www.amazon.xyz/dp/B07PHPXHQS", "", ErrUnknownMarketplace},
+		{"https://www.notamazon.com/dp/B07PHPXHQS", "", ErrUnknownMarketplace},
+	}
+	for _, tt := range tests {
+		t.Run(tt.link, func(t *testing.T) {
+			got, err := MarketplaceOf(tt.link)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("MarketplaceOf() error = %v, want %v", err, tt.wantErr)
+				return
+			}
+			if got.Domain != tt.want {
+				t.Errorf("MarketplaceOf() got = %v, want %v", got.Domain, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarketplaceForCountry(t *testing.T) {
+	tests := []struct {
+		country string
+		want    Domain
+	}{
+		{"ITA", "it"},
+		{"AUT", "de"},
+		{"GBR", "co.uk"},
+		{"JPN", "co.jp"},
+		{"BEL", "com.be"},
+		{"EGY", "eg"},
+		{"ATA", DefaultDomain},
+	}
+	for _, tt := range tests {
+		t.Run(tt.country, func(t *testing.T) {
+			if got := MarketplaceForCountry(tt.country).Domain; got != tt.want {
+				t.Errorf("MarketplaceForCountry() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarketplaces_Currencies(t *testing.T) {
+	for _, m := range Marketplaces() {
+		if _, ok := currencyFormats[m.Currency]; !ok {
+			t.Errorf("marketplace %s uses %s, which has no currency format", m.Domain, m.Currency)
+		}
+	}
+}
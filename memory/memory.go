@@ -0,0 +1,321 @@
+// Package memory implements a watchazon.Store that keeps everything in memory, mainly useful for tests.
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/giornetta/watchazon"
+)
+
+// Store is an in-memory watchazon.Store, safe for concurrent use.
+// Records are copied in and out, so callers can't modify the stored data.
+type Store struct {
+	mu      sync.RWMutex
+	records map[string]*watchazon.Record
+	history map[string][]watchazon.PricePoint
+	// outbox is sorted by ID, which is assigned from lastID.
+	outbox []*watchazon.Notification
+	lastID uint64
+	users  map[int64]*watchazon.User
+}
+
+var _ watchazon.Store = (*Store)(nil)
+
+func New() *Store {
+	return &Store{
+		records: make(map[string]*watchazon.Record),
+		history: make(map[string][]watchazon.PricePoint),
+		users:   make(map[int64]*watchazon.User),
+	}
+}
+
+func (s *Store) Close() error {
+	return nil
+}
+
+// Ping never fails, as the store is always open.
+func (s *Store) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (s *Store) Get(ctx context.Context, link string) (*watchazon.Record, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	r, ok := s.records[link]
+	if !ok {
+		return nil, watchazon.ErrNotFound
+	}
+
+	return copyRecord(r), nil
+}
+
+func (s *Store) GetAll(ctx context.Context) ([]*watchazon.Record, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	records := make([]*watchazon.Record, 0, len(s.records))
+	for _, r := range s.records {
+		records = append(records, copyRecord(r))
+	}
+	sortRecords(records)
+
+	return records, nil
+}
+
+func (s *Store) Insert(ctx context.Context, product *watchazon.Product, userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.records[product.Link]; ok {
+		return watchazon.ErrAlreadyExists
+	}
+
+	r := &watchazon.Record{
+		Product: copyProduct(product),
+	}
+	r.Subscribe(userID)
+	s.records[product.Link] = r
+
+	return nil
+}
+
+func (s *Store) Update(ctx context.Context, product *watchazon.Product, userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.records[product.Link]
+	if !ok {
+		return watchazon.ErrNotFound
+	}
+
+	r.Product = copyProduct(product)
+	if userID != 0 {
+		r.Subscribe(userID)
+	}
+
+	return nil
+}
+
+func (s *Store) GetUserWatchList(ctx context.Context, userID int64) ([]*watchazon.Record, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	records := make([]*watchazon.Record, 0)
+	for _, r := range s.records {
+		if r.Watched(userID) {
+			records = append(records, copyRecord(r))
+		}
+	}
+	sortRecords(records)
+
+	return records, nil
+}
+
+func (s *Store) RemoveFromWatchList(ctx context.Context, link string, userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.records[link]
+	if !ok || !r.Watched(userID) {
+		return watchazon.ErrNotFound
+	}
+
+	r.Unsubscribe(userID)
+	if len(r.Users) == 0 {
+		delete(s.records, link)
+		delete(s.history, link)
+	}
+
+	return nil
+}
+
+func (s *Store) SetAlertRule(ctx context.Context, link string, userID int64, rule watchazon.AlertRule) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.records[link]
+	if !ok || !r.Watched(userID) {
+		return watchazon.ErrNotFound
+	}
+	r.SetRule(userID, rule)
+
+	return nil
+}
+
+func (s *Store) AppendPrice(ctx context.Context, link string, point watchazon.PricePoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	points := append(s.history[link], point)
+	sort.SliceStable(points, func(i, j int) bool {
+		return points[i].CheckedAt.Before(points[j].CheckedAt)
+	})
+	s.history[link] = points
+
+	return nil
+}
+
+func (s *Store) PriceHistory(ctx context.Context, link string, from, to time.Time) ([]watchazon.PricePoint, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	points := make([]watchazon.PricePoint, 0)
+	for _, p := range s.history[link] {
+		if !from.IsZero() && p.CheckedAt.Before(from) {
+			continue
+		}
+		if !to.IsZero() && !p.CheckedAt.Before(to) {
+			break
+		}
+		points = append(points, p)
+	}
+
+	return points, nil
+}
+
+func (s *Store) TrimHistory(ctx context.Context, link string, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	points := s.history[link]
+	i := sort.Search(len(points), func(i int) bool {
+		return !points[i].CheckedAt.Before(before)
+	})
+	s.history[link] = append([]watchazon.PricePoint(nil), points[i:]...)
+
+	return nil
+}
+
+func (s *Store) EnqueueNotification(ctx context.Context, n *watchazon.Notification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastID++
+	n.ID = s.lastID
+	s.outbox = append(s.outbox, copyNotification(n))
+
+	return nil
+}
+
+func (s *Store) PendingNotifications(ctx context.Context, by time.Time) ([]*watchazon.Notification, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	pending := make([]*watchazon.Notification, 0)
+	for _, n := range s.outbox {
+		if !n.DueAt.After(by) {
+			pending = append(pending, copyNotification(n))
+		}
+	}
+
+	return pending, nil
+}
+
+func (s *Store) SaveNotification(ctx context.Context, n *watchazon.Notification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, stored := range s.outbox {
+		if stored.ID == n.ID {
+			stored.Attempts = n.Attempts
+			stored.DueAt = n.DueAt
+			stored.Delivered = append([]string(nil), n.Delivered...)
+			return nil
+		}
+	}
+
+	return watchazon.ErrNotFound
+}
+
+func (s *Store) DeleteNotification(ctx context.Context, id uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, n := range s.outbox {
+		if n.ID == id {
+			s.outbox = append(s.outbox[:i], s.outbox[i+1:]...)
+			break
+		}
+	}
+
+	return nil
+}
+
+func (s *Store) GetUser(ctx context.Context, id int64) (*watchazon.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return nil, watchazon.ErrNotFound
+	}
+
+	return copyUser(u), nil
+}
+
+func (s *Store) SaveUser(ctx context.Context, u *watchazon.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.users[u.ID] = copyUser(u)
+
+	return nil
+}
+
+func (s *Store) GetUserByAPIToken(ctx context.Context, hash string) (*watchazon.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, u := range s.users {
+		if hash != "" && u.APIToken == hash {
+			return copyUser(u), nil
+		}
+	}
+
+	return nil, watchazon.ErrNotFound
+}
+
+func copyProduct(p *watchazon.Product) *watchazon.Product {
+	c := *p
+	return &c
+}
+
+func copyRecord(r *watchazon.Record) *watchazon.Record {
+	c := &watchazon.Record{
+		Product: copyProduct(r.Product),
+		Users:   append([]int64(nil), r.Users...),
+		Rules:   make(map[int64]watchazon.AlertRule, len(r.Rules)),
+	}
+	for u, rule := range r.Rules {
+		c.Rules[u] = rule
+	}
+
+	return c
+}
+
+func copyNotification(n *watchazon.Notification) *watchazon.Notification {
+	c := *n
+	c.Delivered = append([]string(nil), n.Delivered...)
+	c.Product = copyProduct(n.Product)
+	if n.Previous != nil {
+		c.Previous = copyProduct(n.Previous)
+	}
+
+	return &c
+}
+
+func copyUser(u *watchazon.User) *watchazon.User {
+	c := *u
+	c.Channels = append([]string(nil), u.Channels...)
+	return &c
+}
+
+func sortRecords(records []*watchazon.Record) {
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Link < records[j].Link
+	})
+}
@@ -0,0 +1,14 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/giornetta/watchazon"
+	"github.com/giornetta/watchazon/storetest"
+)
+
+func TestStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) watchazon.Store {
+		return New()
+	})
+}
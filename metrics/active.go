@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/giornetta/watchazon"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// collectTimeout bounds the time taken to count the products and users at each collection.
+const collectTimeout = 10 * time.Second
+
+// Active is a prometheus.Collector counting the watched products and the users watching at least one of them.
+// They are counted from the store at each collection.
+type Active struct {
+	store    watchazon.Store
+	products *prometheus.Desc
+	users    *prometheus.Desc
+}
+
+var _ prometheus.Collector = (*Active)(nil)
+
+func NewActive(store watchazon.Store) *Active {
+	return &Active{
+		store:    store,
+		products: prometheus.NewDesc("watchazon_active_products", "Products watched by at least one user.", nil, nil),
+		users:    prometheus.NewDesc("watchazon_active_users", "Users watching at least one product.", nil, nil),
+	}
+}
+
+func (a *Active) Describe(ch chan<- *prometheus.Desc) {
+	ch <- a.products
+	ch <- a.users
+}
+
+func (a *Active) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), collectTimeout)
+	defer cancel()
+
+	records, err := a.store.GetAll(ctx)
+	if err != nil {
+		slog.Error("could not count active products and users", "error", err)
+		ch <- prometheus.NewInvalidMetric(a.products, err)
+		ch <- prometheus.NewInvalidMetric(a.users, err)
+		return
+	}
+
+	users := make(map[int64]bool)
+	for _, r := range records {
+		for _, u := range r.Users {
+			users[u] = true
+		}
+	}
+
+	ch <- prometheus.MustNewConstMetric(a.products, prometheus.GaugeValue, float64(len(records)))
+	ch <- prometheus.MustNewConstMetric(a.users, prometheus.GaugeValue, float64(len(users)))
+}
@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/giornetta/watchazon"
+	"github.com/giornetta/watchazon/memory"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestStore(t *testing.T) {
+	s := NewStore(memory.New())
+	ctx := context.Background()
+
+	if err := s.Insert(ctx, &watchazon.Product{Link: "https://www.amazon.it/dp/B07PHPXHQS"}, 1); err != nil {
+		t.Fatalf("could not insert product: %v", err)
+	}
+	if _, err := s.Get(ctx, "https://www.amazon.it/dp/B000000000"); !errors.Is(err, watchazon.ErrNotFound) {
+		t.Fatalf("Get() on missing product error = %v, want %v", err, watchazon.ErrNotFound)
+	}
+
+	for _, labels := range [][]string{{"insert", "ok"}, {"get", "not_found"}} {
+		var m dto.Metric
+		if err := storeDuration.WithLabelValues(labels...).(prometheus.Metric).Write(&m); err != nil {
+			t.Fatalf("could not read the observations of %v: %v", labels, err)
+		}
+		if n := m.GetHistogram().GetSampleCount(); n != 1 {
+			t.Errorf("observations of %v = %d, want 1", labels, n)
+		}
+	}
+}
+
+func TestActive(t *testing.T) {
+	store := memory.New()
+	ctx := context.Background()
+
+	echo := &watchazon.Product{Link: "https://www.amazon.it/dp/B07PHPXHQS"}
+	band := &watchazon.Product{Link: "https://www.amazon.com/dp/B07GNGJK97"}
+	for _, w := range []struct {
+		product *watchazon.Product
+		userID  int64
+	}{{echo, 1}, {band, 1}, {band, 2}} {
+		err := store.Insert(ctx, w.product, w.userID)
+		if errors.Is(err, watchazon.ErrAlreadyExists) {
+			err = store.Update(ctx, w.product, w.userID)
+		}
+		if err != nil {
+			t.Fatalf("could not watch %s: %v", w.product.Link, err)
+		}
+	}
+
+	want := `
+# HELP watchazon_active_products Products watched by at least one user.
+# TYPE watchazon_active_products gauge
+watchazon_active_products 2
+# HELP watchazon_active_users Users watching at least one product.
+# TYPE watchazon_active_users gauge
+watchazon_active_users 2
+`
+	if err := testutil.CollectAndCompare(NewActive(store), strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+}
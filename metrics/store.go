@@ -0,0 +1,137 @@
+// Package metrics exposes to Prometheus the state of the stored data and the latency of the store.
+// The metrics of scraping, checks and notifications are defined by the packages doing them.
+package metrics
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/giornetta/watchazon"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var storeDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: "watchazon",
+	Name:      "store_operation_duration_seconds",
+	Help:      "Time taken by the operations of the store, by operation and outcome.",
+	Buckets:   []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1},
+}, []string{"operation", "outcome"})
+
+// Store is a watchazon.Store recording the latency of the operations of the one it wraps.
+type Store struct {
+	next watchazon.Store
+}
+
+var _ watchazon.Store = (*Store)(nil)
+
+func NewStore(next watchazon.Store) *Store {
+	return &Store{next: next}
+}
+
+// observe records the duration of an operation started at start, whose error is pointed by err.
+func observe(operation string, start time.Time, err *error) {
+	outcome := "ok"
+	switch {
+	case errors.Is(*err, watchazon.ErrNotFound):
+		outcome = "not_found"
+	case *err != nil:
+		outcome = "error"
+	}
+	storeDuration.WithLabelValues(operation, outcome).Observe(time.Since(start).Seconds())
+}
+
+func (s *Store) Get(ctx context.Context, link string) (r *watchazon.Record, err error) {
+	defer observe("get", time.Now(), &err)
+	return s.next.Get(ctx, link)
+}
+
+func (s *Store) GetAll(ctx context.Context) (records []*watchazon.Record, err error) {
+	defer observe("get_all", time.Now(), &err)
+	return s.next.GetAll(ctx)
+}
+
+func (s *Store) Insert(ctx context.Context, product *watchazon.Product, userID int64) (err error) {
+	defer observe("insert", time.Now(), &err)
+	return s.next.Insert(ctx, product, userID)
+}
+
+func (s *Store) Update(ctx context.Context, product *watchazon.Product, userID int64) (err error) {
+	defer observe("update", time.Now(), &err)
+	return s.next.Update(ctx, product, userID)
+}
+
+func (s *Store) GetUserWatchList(ctx context.Context, userID int64) (records []*watchazon.Record, err error) {
+	defer observe("get_user_watch_list", time.Now(), &err)
+	return s.next.GetUserWatchList(ctx, userID)
+}
+
+func (s *Store) RemoveFromWatchList(ctx context.Context, link string, userID int64) (err error) {
+	defer observe("remove_from_watch_list", time.Now(), &err)
+	return s.next.RemoveFromWatchList(ctx, link, userID)
+}
+
+func (s *Store) SetAlertRule(ctx context.Context, link string, userID int64, rule watchazon.AlertRule) (err error) {
+	defer observe("set_alert_rule", time.Now(), &err)
+	return s.next.SetAlertRule(ctx, link, userID, rule)
+}
+
+func (s *Store) AppendPrice(ctx context.Context, link string, point watchazon.PricePoint) (err error) {
+	defer observe("append_price", time.Now(), &err)
+	return s.next.AppendPrice(ctx, link, point)
+}
+
+func (s *Store) PriceHistory(ctx context.Context, link string, from, to time.Time) (points []watchazon.PricePoint, err error) {
+	defer observe("price_history", time.Now(), &err)
+	return s.next.PriceHistory(ctx, link, from, to)
+}
+
+func (s *Store) TrimHistory(ctx context.Context, link string, before time.Time) (err error) {
+	defer observe("trim_history", time.Now(), &err)
+	return s.next.TrimHistory(ctx, link, before)
+}
+
+func (s *Store) EnqueueNotification(ctx context.Context, n *watchazon.Notification) (err error) {
+	defer observe("enqueue_notification", time.Now(), &err)
+	return s.next.EnqueueNotification(ctx, n)
+}
+
+func (s *Store) PendingNotifications(ctx context.Context, by time.Time) (pending []*watchazon.Notification, err error) {
+	defer observe("pending_notifications", time.Now(), &err)
+	return s.next.PendingNotifications(ctx, by)
+}
+
+func (s *Store) SaveNotification(ctx context.Context, n *watchazon.Notification) (err error) {
+	defer observe("save_notification", time.Now(), &err)
+	return s.next.SaveNotification(ctx, n)
+}
+
+func (s *Store) DeleteNotification(ctx context.Context, id uint64) (err error) {
+	defer observe("delete_notification", time.Now(), &err)
+	return s.next.DeleteNotification(ctx, id)
+}
+
+func (s *Store) GetUser(ctx context.Context, id int64) (u *watchazon.User, err error) {
+	defer observe("get_user", time.Now(), &err)
+	return s.next.GetUser(ctx, id)
+}
+
+func (s *Store) SaveUser(ctx context.Context, u *watchazon.User) (err error) {
+	defer observe("save_user", time.Now(), &err)
+	return s.next.SaveUser(ctx, u)
+}
+
+func (s *Store) GetUserByAPIToken(ctx context.Context, hash string) (u *watchazon.User, err error) {
+	defer observe("get_user_by_api_token", time.Now(), &err)
+	return s.next.GetUserByAPIToken(ctx, hash)
+}
+
+func (s *Store) Ping(ctx context.Context) (err error) {
+	defer observe("ping", time.Now(), &err)
+	return s.next.Ping(ctx)
+}
+
+func (s *Store) Close() error {
+	return s.next.Close()
+}
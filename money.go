@@ -0,0 +1,138 @@
+package watchazon
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Money is an amount of money expressed in the minor units (e.g. cents) of its ISO 4217 currency,
+// so that prices can be compared exactly.
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+// currencyFormat describes how amounts of a currency are displayed.
+type currencyFormat struct {
+	symbol string
+	// digits is the number of minor unit digits of the currency.
+	digits int
+	// suffix is true for currencies whose symbol follows the amount.
+	suffix bool
+}
+
+var currencyFormats = map[string]currencyFormat{
+	"USD": {symbol: "$", digits: 2},
+	"EUR": {symbol: "€", digits: 2, suffix: true},
+	"GBP": {symbol: "£", digits: 2},
+	"CAD": {symbol: "CA$", digits: 2},
+	"AUD": {symbol: "A$", digits: 2},
+	"MXN": {symbol: "MX$", digits: 2},
+	"BRL": {symbol: "R$", digits: 2},
+	"SGD": {symbol: "S$", digits: 2},
+	"INR": {symbol: "₹", digits: 2},
+	"JPY": {symbol: "¥", digits: 0},
+	"SEK": {symbol: "kr", digits: 2, suffix: true},
+	"PLN": {symbol: "zł", digits: 2, suffix: true},
+	"TRY": {symbol: "TL", digits: 2, suffix: true},
+	"AED": {symbol: "AED", digits: 2, suffix: true},
+	"SAR": {symbol: "SAR", digits: 2, suffix: true},
+	"EGP": {symbol: "EGP", digits: 2, suffix: true},
+}
+
+// defaultCurrencyFormat is used for currencies without an entry in currencyFormats, displaying their code.
+var defaultCurrencyFormat = currencyFormat{digits: 2, suffix: true}
+
+func formatOf(currency string) currencyFormat {
+	f, ok := currencyFormats[currency]
+	if !ok {
+		f = defaultCurrencyFormat
+		f.symbol = currency
+	}
+	return f
+}
+
+// ErrInvalidAmount is returned when parsing a malformed amount of money.
+var ErrInvalidAmount = errors.New("invalid amount")
+
+// ParseMoney parses an amount written with a dot as decimal separator and no grouping, such as 1099.89.
+func ParseMoney(s string, currency string) (Money, error) {
+	digits := formatOf(currency).digits
+
+	whole, frac, _ := strings.Cut(strings.TrimSpace(s), ".")
+	if whole == "" && frac == "" || len(frac) > digits {
+		return Money{}, ErrInvalidAmount
+	}
+	frac += strings.Repeat("0", digits-len(frac))
+
+	amount, err := strconv.ParseUint(whole+frac, 10, 63)
+	if err != nil {
+		return Money{}, ErrInvalidAmount
+	}
+
+	return Money{Amount: int64(amount), Currency: currency}, nil
+}
+
+// IsZero reports whether m is a zero amount, as for products without a price.
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+// Float returns the amount in major units, for presentation and statistics only.
+func (m Money) Float() float64 {
+	return float64(m.Amount) / math.Pow10(formatOf(m.Currency).digits)
+}
+
+// In returns the same amount in another currency, converting the minor units if the currencies have
+// a different number of digits. It's meant for amounts whose currency wasn't known when they were parsed.
+func (m Money) In(currency string) Money {
+	from, to := formatOf(m.Currency).digits, formatOf(currency).digits
+
+	amount := m.Amount
+	for ; from < to; from++ {
+		amount *= 10
+	}
+	for ; from > to; from-- {
+		amount /= 10
+	}
+
+	return Money{Amount: amount, Currency: currency}
+}
+
+// String returns the amount along with the currency symbol, such as $28.98 or 59.99 €.
+func (m Money) String() string {
+	f := formatOf(m.Currency)
+	amount := m.number()
+
+	if f.symbol == "" {
+		return amount
+	}
+	if f.suffix {
+		return fmt.Sprintf("%s %s", amount, f.symbol)
+	}
+	return f.symbol + amount
+}
+
+// Code returns the amount along with the ISO 4217 code of the currency, such as 59.99 EUR,
+// for outputs which can't display the currency symbols.
+func (m Money) Code() string {
+	if m.Currency == "" {
+		return m.number()
+	}
+	return m.number() + " " + m.Currency
+}
+
+// number returns the amount in major units, with the minor units of the currency as decimals.
+func (m Money) number() string {
+	digits := formatOf(m.Currency).digits
+
+	unit := int64(math.Pow10(digits))
+	amount := strconv.FormatInt(m.Amount/unit, 10)
+	if digits > 0 {
+		amount += fmt.Sprintf(".%0*d", digits, m.Amount%unit)
+	}
+	return amount
+}
@@ -0,0 +1,70 @@
+package watchazon
+
+import "testing"
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		text     string
+		currency string
+		want     Money
+		wantErr  bool
+	}{
+		{"1099.89", "EUR", Money{109989, "EUR"}, false},
+		{"12.3", "USD", Money{1230, "USD"}, false},
+		{"59.", "EUR", Money{5900, "EUR"}, false},
+		{"7", "EUR", Money{700, "EUR"}, false},
+		{"", "EUR", Money{}, true},
+		{"1.999", "EUR", Money{}, true},
+		{"-5", "EUR", Money{}, true},
+		{"12a", "EUR", Money{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			got, err := ParseMoney(tt.text, tt.currency)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseMoney() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ParseMoney() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoney_String(t *testing.T) {
+	tests := []struct {
+		money Money
+		want  string
+	}{
+		{Money{2898, "USD"}, "$28.98"},
+		{Money{109989, "EUR"}, "1099.89 €"},
+		{Money{5, "EUR"}, "0.05 €"},
+		{Money{1250, "CHF"}, "12.50 CHF"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := tt.money.String(); got != tt.want {
+				t.Errorf("String() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoney_Code(t *testing.T) {
+	tests := []struct {
+		money Money
+		want  string
+	}{
+		{Money{109989, "EUR"}, "1099.89 EUR"},
+		{Money{1500, "JPY"}, "1500 JPY"},
+		{Money{1250, ""}, "12.50"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := tt.money.Code(); got != tt.want {
+				t.Errorf("Code() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
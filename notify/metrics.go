@@ -0,0 +1,21 @@
+package notify
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	notificationsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "watchazon",
+		Name:      "notifications_total",
+		Help:      "Notifications delivered through each channel, by outcome: sent or failed.",
+	}, []string{"channel", "outcome"})
+
+	deliveryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "watchazon",
+		Name:      "notification_delivery_duration_seconds",
+		Help:      "Time taken to deliver a notification through each channel, retries included.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"channel"})
+)
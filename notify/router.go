@@ -0,0 +1,163 @@
+// Package notify routes the notifications to the channels chosen by each user.
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/giornetta/watchazon"
+)
+
+// Users gives access to the notification settings of the users.
+type Users interface {
+	GetUser(ctx context.Context, id int64) (*watchazon.User, error)
+}
+
+// DeliveryTimeout bounds the delivery of a notification through all the channels of its user.
+const DeliveryTimeout = time.Minute
+
+// ackGrace bounds the acknowledgement of a notification, which must be saved even if its delivery was canceled.
+const ackGrace = 5 * time.Second
+
+// Router is a watchazon.Notifier delivering each notification through the channels chosen by its user.
+type Router struct {
+	users Users
+
+	// mu guards notifiers, which may change while notifications are delivered.
+	mu        sync.RWMutex
+	notifiers map[string]watchazon.Notifier
+}
+
+var _ watchazon.Notifier = (*Router)(nil)
+
+func NewRouter(users Users) *Router {
+	return &Router{
+		users:     users,
+		notifiers: make(map[string]watchazon.Notifier),
+	}
+}
+
+// Register makes n deliver the notifications sent through channel, replacing its previous notifier.
+// The notifications being delivered through the previous one aren't interrupted.
+func (r *Router) Register(channel string, n watchazon.Notifier) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.notifiers[channel] = n
+}
+
+// Unregister stops delivering the notifications sent through channel.
+func (r *Router) Unregister(channel string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.notifiers, channel)
+}
+
+// notifier returns the notifier registered for channel.
+func (r *Router) notifier(channel string) (watchazon.Notifier, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	n, ok := r.notifiers[channel]
+	return n, ok
+}
+
+// Notify delivers n through every channel chosen by its user, skipping the ones without a registered notifier
+// and the ones n was already delivered through, and adding to n.Delivered the ones it's delivered through now.
+// The channels are delivered concurrently, so a slow one doesn't delay the others, and the error reports all the
+// failed ones, so that only those are retried.
+func (r *Router) Notify(ctx context.Context, n *watchazon.Notification) error {
+	channels := watchazon.DefaultChannels
+	u, err := r.users.GetUser(ctx, n.UserID)
+	switch {
+	case err == nil:
+		channels = u.NotificationChannels()
+	case !errors.Is(err, watchazon.ErrNotFound):
+		return fmt.Errorf("could not get settings of %d: %w", n.UserID, err)
+	}
+
+	// The notifiers get a copy of n, which isn't changed while they run.
+	snapshot := *n
+	attempted, errs := make([]bool, len(channels)), make([]error, len(channels))
+	var wg sync.WaitGroup
+	for i, c := range channels {
+		if delivered(n, c) {
+			continue
+		}
+		notifier, ok := r.notifier(c)
+		if !ok {
+			slog.Debug("no notifier for channel, skipping it", "channel", c, "notification_id", n.ID, "user_id", n.UserID)
+			continue
+		}
+
+		attempted[i] = true
+		wg.Add(1)
+		go func(i int, c string, notifier watchazon.Notifier) {
+			defer wg.Done()
+
+			start := time.Now()
+			errs[i] = notifier.Notify(ctx, &snapshot)
+			deliveryDuration.WithLabelValues(c).Observe(time.Since(start).Seconds())
+		}(i, c, notifier)
+	}
+	wg.Wait()
+
+	var (
+		failed   []string
+		firstErr error
+	)
+	for i, c := range channels {
+		if !attempted[i] {
+			continue
+		}
+		if err := errs[i]; err != nil {
+			slog.Warn("could not send notification", "channel", c, "notification_id", n.ID, "user_id", n.UserID, "error", err)
+			notificationsTotal.WithLabelValues(c, "failed").Inc()
+			failed = append(failed, c)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		notificationsTotal.WithLabelValues(c, "sent").Inc()
+		n.Delivered = append(n.Delivered, c)
+	}
+
+	if firstErr != nil {
+		return fmt.Errorf("could not notify through %s: %w", strings.Join(failed, ", "), firstErr)
+	}
+	return nil
+}
+
+// delivered reports whether n was already delivered through channel.
+func delivered(n *watchazon.Notification, channel string) bool {
+	for _, c := range n.Delivered {
+		if c == channel {
+			return true
+		}
+	}
+	return false
+}
+
+// Run delivers the notifications of the service as they come, acknowledging each of them.
+// The notifications are delivered one at a time: a channel that hangs delays the following ones, of every user,
+// by up to DeliveryTimeout each.
+// It returns when ctx is done, once the notification being delivered is acknowledged: its delivery is canceled,
+// and the channels it didn't get through are retried when the service runs again.
+func (r *Router) Run(ctx context.Context, svc watchazon.Service) {
+	for n := range svc.Listen(ctx) {
+		dctx, cancel := context.WithTimeout(ctx, DeliveryTimeout)
+		err := r.Notify(dctx, n)
+		cancel()
+
+		actx, cancel := context.WithTimeout(context.WithoutCancel(ctx), ackGrace)
+		svc.Ack(actx, n, err)
+		cancel()
+	}
+}
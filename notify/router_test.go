@@ -0,0 +1,149 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/giornetta/watchazon"
+	"github.com/giornetta/watchazon/memory"
+	"github.com/giornetta/watchazon/scraper"
+	"github.com/giornetta/watchazon/service"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// recorder is a notifier remembering the users it notified.
+type recorder struct {
+	users []int64
+	err   error
+}
+
+func (r *recorder) Notify(_ context.Context, n *watchazon.Notification) error {
+	r.users = append(r.users, n.UserID)
+	return r.err
+}
+
+func TestRouter_Notify(t *testing.T) {
+	store := memory.New()
+	if err := store.SaveUser(context.Background(), &watchazon.User{ID: 2, Channels: []string{watchazon.ChannelEmail, "sms"}, Email: "user@example.com"}); err != nil {
+		t.Fatalf("SaveUser() error = %v", err)
+	}
+
+	telegram, email := &recorder{}, &recorder{}
+	r := NewRouter(store)
+	r.Register(watchazon.ChannelTelegram, telegram)
+	r.Register(watchazon.ChannelEmail, email)
+
+	// User 1 has no settings and gets the default channels, user 2 only email as sms has no notifier.
+	for _, id := range []int64{1, 2} {
+		if err := r.Notify(context.Background(), &watchazon.Notification{UserID: id}); err != nil {
+			t.Errorf("Notify() for %d error = %v", id, err)
+		}
+	}
+	if len(telegram.users) != 1 || telegram.users[0] != 1 {
+		t.Errorf("Notify() sent through telegram to %v, want [1]", telegram.users)
+	}
+	if len(email.users) != 1 || email.users[0] != 2 {
+		t.Errorf("Notify() sent through email to %v, want [2]", email.users)
+	}
+
+	down := errors.New("smtp is down")
+	email.err = down
+	failed := testutil.ToFloat64(notificationsTotal.WithLabelValues(watchazon.ChannelEmail, "failed"))
+	if err := r.Notify(context.Background(), &watchazon.Notification{UserID: 2}); !errors.Is(err, down) {
+		t.Errorf("Notify() error = %v, want %v", err, down)
+	}
+	if got := testutil.ToFloat64(notificationsTotal.WithLabelValues(watchazon.ChannelEmail, "failed")); got != failed+1 {
+		t.Errorf("failed email notifications = %v, want %v", got, failed+1)
+	}
+
+	// Channels without a notifier are skipped.
+	r.Unregister(watchazon.ChannelEmail)
+	if err := r.Notify(context.Background(), &watchazon.Notification{UserID: 2}); err != nil {
+		t.Errorf("Notify() after unregistering email error = %v", err)
+	}
+	if len(email.users) != 2 {
+		t.Errorf("Notify() sent through the unregistered email notifier to %v", email.users)
+	}
+}
+
+func TestRouter_Notify_Retry(t *testing.T) {
+	store := memory.New()
+	if err := store.SaveUser(context.Background(), &watchazon.User{ID: 1, Channels: []string{watchazon.ChannelTelegram, watchazon.ChannelEmail}, Email: "user@example.com"}); err != nil {
+		t.Fatalf("SaveUser() error = %v", err)
+	}
+
+	down := errors.New("smtp is down")
+	telegram, email := &recorder{}, &recorder{err: down}
+	r := NewRouter(store)
+	r.Register(watchazon.ChannelTelegram, telegram)
+	r.Register(watchazon.ChannelEmail, email)
+
+	// The retry of a notification only goes through the channels that failed.
+	n := &watchazon.Notification{UserID: 1}
+	for i := 0; i < 2; i++ {
+		if err := r.Notify(context.Background(), n); !errors.Is(err, down) {
+			t.Errorf("Notify() error = %v, want %v", err, down)
+		}
+	}
+	if len(telegram.users) != 1 {
+		t.Errorf("Notify() sent through telegram %d times, want 1", len(telegram.users))
+	}
+	if len(email.users) != 2 {
+		t.Errorf("Notify() sent through email %d times, want 2", len(email.users))
+	}
+	if len(n.Delivered) != 1 || n.Delivered[0] != watchazon.ChannelTelegram {
+		t.Errorf("Notify() delivered = %v, want [%s]", n.Delivered, watchazon.ChannelTelegram)
+	}
+}
+
+// hanging is a notifier that never answers, until its context is done.
+type hanging struct {
+	started chan struct{}
+}
+
+func (h hanging) Notify(ctx context.Context, _ *watchazon.Notification) error {
+	close(h.started)
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestRouter_Run_Shutdown(t *testing.T) {
+	store := memory.New()
+	if err := store.EnqueueNotification(context.Background(), &watchazon.Notification{UserID: 1, Product: &watchazon.Product{}}); err != nil {
+		t.Fatalf("could not enqueue notification: %v", err)
+	}
+
+	h := hanging{started: make(chan struct{})}
+	r := NewRouter(store)
+	r.Register(watchazon.ChannelTelegram, h)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		r.Run(ctx, service.New(scraper.New(), store, 1))
+		close(done)
+	}()
+
+	select {
+	case <-h.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() didn't deliver the notification")
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() didn't cancel the delivery in progress after the shutdown")
+	}
+
+	// The canceled delivery is acknowledged as failed, and so retried later.
+	pending, err := store.PendingNotifications(context.Background(), time.Now().Add(24*time.Hour))
+	if err != nil {
+		t.Fatalf("could not get pending notifications: %v", err)
+	}
+	if len(pending) != 1 || pending[0].Attempts != 1 || len(pending[0].Delivered) != 0 {
+		t.Errorf("PendingNotifications() after the shutdown got = %+v, want one to retry", pending)
+	}
+}
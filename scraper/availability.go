@@ -0,0 +1,70 @@
+package scraper
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/giornetta/watchazon"
+)
+
+// availabilityPhrases maps the lowercase phrases shown by the Amazon websites in #availability to the stock status
+// they stand for. They're checked in order, so that more specific phrases win over the generic ones they contain.
+var availabilityPhrases = []struct {
+	phrase       string
+	availability watchazon.Availability
+}{
+	// Only N left in stock
+	{"left in stock", watchazon.LowStock},
+	{"ordina subito", watchazon.LowStock},
+	{"nur noch", watchazon.LowStock},
+	{"solo queda", watchazon.LowStock},
+
+	{"pre-order", watchazon.PreOrder},
+	{"preorder", watchazon.PreOrder},
+	{"preordin", watchazon.PreOrder},
+	{"vorbestell", watchazon.PreOrder},
+	{"reserva", watchazon.PreOrder},
+
+	{"temporarily out of stock", watchazon.OutOfStock},
+	{"temporaneamente non disponibile", watchazon.OutOfStock},
+	{"momentaneamente non disponibile", watchazon.OutOfStock},
+	{"derzeit nicht auf lager", watchazon.OutOfStock},
+	{"temporalmente sin stock", watchazon.OutOfStock},
+
+	{"currently unavailable", watchazon.Unavailable},
+	{"non disponibile", watchazon.Unavailable},
+	{"nicht verfügbar", watchazon.Unavailable},
+	{"no disponible", watchazon.Unavailable},
+
+	{"in stock", watchazon.InStock},
+	{"disponibilità immediata", watchazon.InStock},
+	{"auf lager", watchazon.InStock},
+	{"en stock", watchazon.InStock},
+}
+
+var stockLeftRegexp = regexp.MustCompile(`\d+`)
+
+// parseAvailability returns the stock status described by the text of #availability,
+// along with the number of items left for products in low stock.
+func parseAvailability(text string) (watchazon.Availability, int) {
+	text = strings.ToLower(strings.Join(strings.Fields(text), " "))
+
+	for _, p := range availabilityPhrases {
+		if !strings.Contains(text, p.phrase) {
+			continue
+		}
+
+		if p.availability == watchazon.LowStock {
+			left, err := strconv.Atoi(stockLeftRegexp.FindString(text))
+			if err != nil {
+				return watchazon.InStock, 0
+			}
+			return watchazon.LowStock, left
+		}
+
+		return p.availability, 0
+	}
+
+	return watchazon.AvailabilityUnknown, 0
+}
@@ -0,0 +1,164 @@
+package scraper
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// limiter spaces the requests made to each host, so that all the collectors of a scraper share the same rate.
+type limiter struct {
+	mu            sync.Mutex
+	delay, jitter time.Duration
+	next          map[string]time.Time
+}
+
+// configure changes the delay between the requests to the same host.
+func (l *limiter) configure(delay, jitter time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.delay, l.jitter = delay, jitter
+}
+
+// reserve returns when the next request to host can be made, and books that slot.
+func (l *limiter) reserve(host string) time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	slot := time.Now()
+	if next := l.next[host]; next.After(slot) {
+		slot = next
+	}
+
+	gap := l.delay
+	if l.jitter > 0 {
+		gap += time.Duration(rand.Int63n(int64(l.jitter)))
+	}
+	l.next[host] = slot.Add(gap)
+
+	return slot
+}
+
+// engine is the transport of the scraper: it waits for the limiter before every request,
+// and retries with exponential backoff the ones failed because of a server error or a captcha.
+type engine struct {
+	next    http.RoundTripper
+	limiter *limiter
+
+	mu      sync.Mutex
+	retries int
+	backoff time.Duration
+}
+
+// configure changes the retries of the requests made from now on.
+func (e *engine) configure(retries int, backoff time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.retries, e.backoff = retries, backoff
+}
+
+func (e *engine) RoundTrip(req *http.Request) (*http.Response, error) {
+	e.mu.Lock()
+	retries, backoff := e.retries, e.backoff
+	e.mu.Unlock()
+
+	for attempt := 0; ; attempt++ {
+		if err := sleep(req, time.Until(e.limiter.reserve(req.URL.Host))); err != nil {
+			return nil, err
+		}
+
+		res, err := e.next.RoundTrip(req)
+		retry, err := shouldRetry(res, err)
+		if !retry || attempt >= retries {
+			if err != nil {
+				return nil, err
+			}
+			return res, nil
+		}
+
+		wait := backoff << attempt
+		wait += time.Duration(rand.Int63n(int64(wait)/2 + 1))
+		if res != nil {
+			if after := retryAfter(res); after > wait {
+				wait = after
+			}
+			_ = res.Body.Close()
+		}
+
+		if err := sleep(req, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// shouldRetry reports whether a request must be retried, reading the body of successful responses
+// to find captchas and restoring it for the collector.
+func shouldRetry(res *http.Response, err error) (bool, error) {
+	if err != nil {
+		return true, err
+	}
+	if res.StatusCode >= 500 {
+		return true, nil
+	}
+	if res.StatusCode != http.StatusOK {
+		return false, nil
+	}
+
+	body, err := io.ReadAll(res.Body)
+	_ = res.Body.Close()
+	res.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return true, err
+	}
+
+	return isCaptcha(body), nil
+}
+
+// isCaptcha reports whether a page is the captcha Amazon serves to the clients it believes to be robots.
+func isCaptcha(page []byte) bool {
+	return bytes.Contains(page, []byte("/errors/validateCaptcha"))
+}
+
+// retryAfter returns the wait requested by the Retry-After header of a response, in seconds.
+func retryAfter(res *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(res.Header.Get("Retry-After"))
+	if err != nil {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// contextTransport makes the requests of a collector with its context, which colly doesn't support,
+// so that they are canceled with it.
+type contextTransport struct {
+	ctx  context.Context
+	next http.RoundTripper
+}
+
+func (t *contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.next.RoundTrip(req.WithContext(t.ctx))
+}
+
+// sleep waits for d, returning early with an error if the request is canceled.
+func sleep(req *http.Request, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-req.Context().Done():
+		return req.Context().Err()
+	}
+}
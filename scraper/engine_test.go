@@ -0,0 +1,78 @@
+package scraper
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const captchaPage = `<html><body><form method="get" action="/errors/validateCaptcha"></form></body></html>`
+
+func TestEngine_Retry(t *testing.T) {
+	tests := []struct {
+		name      string
+		failures  int
+		captcha   bool
+		retries   int
+		wantCode  int
+		wantCalls int32
+	}{
+		{"Success", 0, false, 3, http.StatusOK, 1},
+		{"Server error", 2, false, 3, http.StatusOK, 3},
+		{"Captcha", 2, true, 3, http.StatusOK, 3},
+		{"Too many failures", 5, false, 2, http.StatusServiceUnavailable, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&calls, 1) <= int32(tt.failures) {
+					if tt.captcha {
+						_, _ = io.WriteString(w, captchaPage)
+						return
+					}
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				_, _ = io.WriteString(w, "<html></html>")
+			}))
+			defer server.Close()
+
+			e := &engine{
+				next:    http.DefaultTransport,
+				limiter: &limiter{next: make(map[string]time.Time)},
+				retries: tt.retries,
+				backoff: time.Millisecond,
+			}
+
+			req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+			res, err := e.RoundTrip(req)
+			if err != nil {
+				t.Fatalf("RoundTrip() error = %v", err)
+			}
+			_ = res.Body.Close()
+
+			if res.StatusCode != tt.wantCode {
+				t.Errorf("RoundTrip() got status %d, want %d", res.StatusCode, tt.wantCode)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("RoundTrip() made %d requests, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestLimiter_Reserve(t *testing.T) {
+	l := &limiter{delay: time.Minute, next: make(map[string]time.Time)}
+
+	first := l.reserve("www.amazon.it")
+	if second := l.reserve("www.amazon.it"); second.Sub(first) != time.Minute {
+		t.Errorf("reserve() on the same host got %v after the first slot, want %v", second.Sub(first), time.Minute)
+	}
+	if other := l.reserve("www.amazon.de"); other.Sub(first) >= time.Minute {
+		t.Errorf("reserve() on another host got %v after the first slot, want no wait", other.Sub(first))
+	}
+}
@@ -0,0 +1,79 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+const (
+	// recentScrapes is how many of the latest scrapes the error rate is computed on.
+	recentScrapes = 50
+	// minScrapes is how many scrapes are needed before a high error rate is reported as unhealthy.
+	minScrapes = 10
+	// maxErrorRate is the error rate above which the scraper is reported unhealthy.
+	maxErrorRate = 0.5
+)
+
+// recent remembers whether the latest scrapes failed, its zero value is ready to use.
+type recent struct {
+	mu     sync.Mutex
+	failed [recentScrapes]bool
+	// n is how many scrapes have been recorded, the next one is stored at n % recentScrapes.
+	n int
+}
+
+// add records a scrape which ended with the outcome o. Only the outcomes hinting that Amazon is blocking
+// the scraper, or that it can't be reached, count as failures: the ones about a single product don't.
+func (r *recent) add(o string) {
+	if o == "canceled" {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch o {
+	case "captcha", "sign_in", "timeout", "error":
+		r.failed[r.n%recentScrapes] = true
+	default:
+		r.failed[r.n%recentScrapes] = false
+	}
+	r.n++
+}
+
+// rate returns how many of the latest scrapes are known, and the rate of the failed ones.
+func (r *recent) rate() (n int, rate float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n = r.n
+	if n > recentScrapes {
+		n = recentScrapes
+	}
+	if n == 0 {
+		return 0, 0
+	}
+
+	var failed int
+	for _, f := range r.failed[:n] {
+		if f {
+			failed++
+		}
+	}
+	return n, float64(failed) / float64(n)
+}
+
+// Health reports the error rate of the latest scrapes, failing when most of them failed.
+func (s *Scraper) Health(ctx context.Context) (map[string]interface{}, error) {
+	n, rate := s.recent.rate()
+	detail := map[string]interface{}{
+		"recent_scrapes": n,
+		"error_rate":     rate,
+	}
+
+	if n >= minScrapes && rate > maxErrorRate {
+		return detail, fmt.Errorf("%.0f%% of the last %d scrapes failed", rate*100, n)
+	}
+	return detail, nil
+}
@@ -0,0 +1,33 @@
+package scraper
+
+import (
+	"context"
+	"testing"
+)
+
+func TestScraper_Health(t *testing.T) {
+	s := New()
+	if _, err := s.Health(context.Background()); err != nil {
+		t.Errorf("Health() without scrapes error = %v", err)
+	}
+
+	// Products that don't exist don't make the scraper unhealthy, nor do canceled scrapes.
+	for i := 0; i < recentScrapes; i++ {
+		s.recent.add("not_found")
+		s.recent.add("canceled")
+	}
+	if _, err := s.Health(context.Background()); err != nil {
+		t.Errorf("Health() after missing products error = %v", err)
+	}
+
+	for i := 0; i < recentScrapes/2+1; i++ {
+		s.recent.add("captcha")
+	}
+	detail, err := s.Health(context.Background())
+	if err == nil {
+		t.Errorf("Health() after captchas expected an error")
+	}
+	if detail["recent_scrapes"] != recentScrapes {
+		t.Errorf("Health() recent_scrapes = %v, want %d", detail["recent_scrapes"], recentScrapes)
+	}
+}
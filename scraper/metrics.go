@@ -0,0 +1,56 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/giornetta/watchazon"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	scrapesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "watchazon",
+		Name:      "scrapes_total",
+		Help:      "Product pages scraped, by marketplace and outcome.",
+	}, []string{"domain", "outcome"})
+
+	scrapeDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "watchazon",
+		Name:      "scrape_duration_seconds",
+		Help:      "Time taken to scrape a product page, delays and retries included, by marketplace and outcome.",
+		Buckets:   []float64{0.5, 1, 2.5, 5, 10, 20, 40, 80, 120},
+	}, []string{"domain", "outcome"})
+)
+
+// observeScrape records a scrape of a page of the marketplace, which took elapsed and ended with the outcome o.
+func observeScrape(domain watchazon.Domain, o string, elapsed time.Duration) {
+	scrapesTotal.WithLabelValues(string(domain), o).Inc()
+	scrapeDuration.WithLabelValues(string(domain), o).Observe(elapsed.Seconds())
+}
+
+// outcome returns the label describing how a scrape ended.
+func outcome(err error) string {
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.Is(err, ErrCaptcha):
+		return "captcha"
+	case errors.Is(err, ErrSignIn):
+		return "sign_in"
+	case errors.Is(err, ErrNotFound):
+		return "not_found"
+	case errors.Is(err, ErrRedirected):
+		return "redirected"
+	case errors.Is(err, ErrNoProduct):
+		return "no_product"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	default:
+		return "error"
+	}
+}
@@ -1,70 +1,287 @@
 package scraper
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
-	"net/url"
-	"strconv"
+	"log/slog"
+	"net/http"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/giornetta/watchazon"
 	"github.com/gocolly/colly"
 )
 
+var (
+	// ErrCaptcha is returned when Amazon serves its robot check instead of the page.
+	ErrCaptcha = errors.New("captcha page")
+	// ErrSignIn is returned when Amazon requires to sign in to see the page.
+	ErrSignIn = errors.New("sign-in page")
+	// ErrNotFound is returned for products that don't exist, for which Amazon serves the dogs page.
+	ErrNotFound = errors.New("product not found")
+	// ErrRedirected is returned when Amazon redirects to another marketplace.
+	ErrRedirected = errors.New("redirected to another marketplace")
+	// ErrNoProduct is returned for any other page without a product.
+	ErrNoProduct = errors.New("no product in page")
+)
+
 type Scraper struct {
 	AllowedDomains []string
+	// Transport performs the HTTP requests of the scraper, http.DefaultTransport is used when nil.
+	Transport http.RoundTripper
+
+	// Delay is the minimum time between two requests to the same host, to which a random
+	// duration up to RandomDelay is added.
+	Delay       time.Duration
+	RandomDelay time.Duration
+	// Retries is how many times a request is retried after a server error or a captcha page,
+	// waiting Backoff before the first retry and doubling the wait at each attempt.
+	Retries int
+	Backoff time.Duration
+	// Timeout bounds each call to Scrape and Search, delays and retries included. There's no bound when zero.
+	Timeout time.Duration
+
+	// mu guards the fields above once the scraper is in use, when they are changed by Configure.
+	mu sync.RWMutex
+	// engine is shared by the collectors, it's created on first use from the fields above.
+	engine     *engine
+	engineOnce sync.Once
+	// recent tells how the latest scrapes went, for Health.
+	recent recent
 }
 
+// Default settings of the scraper, conservative enough not to be throttled by Amazon.
+const (
+	DefaultDelay       = 2 * time.Second
+	DefaultRandomDelay = 3 * time.Second
+	DefaultRetries     = 3
+	DefaultBackoff     = 10 * time.Second
+	DefaultTimeout     = 2 * time.Minute
+)
+
+// New returns a scraper restricted to the given hosts, or to the ones of every supported marketplace if none is given.
 func New(domains ...string) *Scraper {
+	if len(domains) == 0 {
+		domains = watchazon.Hosts()
+	}
+
 	return &Scraper{
-		domains,
+		AllowedDomains: domains,
+		Delay:          DefaultDelay,
+		RandomDelay:    DefaultRandomDelay,
+		Retries:        DefaultRetries,
+		Backoff:        DefaultBackoff,
+		Timeout:        DefaultTimeout,
+	}
+}
+
+// Settings are the settings of a scraper that can be changed while it's in use.
+type Settings struct {
+	AllowedDomains []string
+	Delay          time.Duration
+	RandomDelay    time.Duration
+	Retries        int
+	Backoff        time.Duration
+	Timeout        time.Duration
+}
+
+// Configure changes the settings of the scraper, which may be in use: the requests in progress keep the previous
+// ones, and the hosts already booked by the rate limiter are freed at the time of the previous delay.
+// No allowed domain means every supported marketplace.
+func (s *Scraper) Configure(st Settings) {
+	if len(st.AllowedDomains) == 0 {
+		st.AllowedDomains = watchazon.Hosts()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.AllowedDomains = st.AllowedDomains
+	s.Delay, s.RandomDelay = st.Delay, st.RandomDelay
+	s.Retries, s.Backoff = st.Retries, st.Backoff
+	s.Timeout = st.Timeout
+
+	if s.engine != nil {
+		s.engine.configure(s.Retries, s.Backoff)
+		s.engine.limiter.configure(s.Delay, s.RandomDelay)
+	}
+}
+
+// newCollector returns a collector restricted to the allowed domains, making its requests through the engine
+// with the given context.
+func (s *Scraper) newCollector(ctx context.Context) *colly.Collector {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	s.engineOnce.Do(func() {
+		transport := s.Transport
+		if transport == nil {
+			transport = http.DefaultTransport
+		}
+
+		s.engine = &engine{
+			next: transport,
+			limiter: &limiter{
+				delay:  s.Delay,
+				jitter: s.RandomDelay,
+				next:   make(map[string]time.Time),
+			},
+			retries: s.Retries,
+			backoff: s.Backoff,
+		}
+	})
+
+	c := colly.NewCollector(
+		colly.AllowedDomains(s.AllowedDomains...),
+	)
+	c.WithTransport(&contextTransport{ctx: ctx, next: s.engine})
+	c.RedirectHandler = checkRedirect
+
+	return c
+}
+
+// checkRedirect stops the redirects to the sign-in page and to other marketplaces.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	switch {
+	case strings.HasPrefix(req.URL.Path, "/ap/signin"):
+		return ErrSignIn
+	case req.URL.Host != via[0].URL.Host:
+		return ErrRedirected
+	case len(via) >= 10:
+		return errors.New("stopped after 10 redirects")
+	}
+
+	return nil
+}
+
+// withTimeout returns ctx bounded by the timeout of the scraper.
+func (s *Scraper) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	s.mu.RLock()
+	timeout := s.Timeout
+	s.mu.RUnlock()
+
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
 	}
+	return context.WithTimeout(ctx, timeout)
 }
 
-func (s *Scraper) Scrape(link string) (*watchazon.Product, error) {
-	domain, err := domainFrom(link)
+func (s *Scraper) Scrape(ctx context.Context, link string) (*watchazon.Product, error) {
+	market, err := watchazon.MarketplaceOf(link)
 	if err != nil {
 		return nil, err
 	}
 
+	start := time.Now()
+	product, err := s.scrape(ctx, link, market)
+	elapsed := time.Since(start)
+	o := outcome(err)
+	observeScrape(market.Domain, o, elapsed)
+	s.recent.add(o)
+	logScrape(link, market.Domain, o, elapsed, product, err)
+
+	return product, err
+}
+
+// logScrape logs a scrape of the product page at link, as a warning if Amazon may be blocking the scraper.
+func logScrape(link string, domain watchazon.Domain, o string, elapsed time.Duration, p *watchazon.Product, err error) {
+	switch o {
+	case "ok":
+		slog.Debug("scraped product", "link", link, "domain", domain, "duration", elapsed, "price", p.Price.String(), "availability", p.Availability.String())
+	case "canceled":
+		slog.Debug("scrape canceled", "link", link, "domain", domain, "duration", elapsed)
+	case "not_found", "redirected", "no_product":
+		slog.Info("could not scrape product", "link", link, "domain", domain, "duration", elapsed, "kind", o, "error", err)
+	default:
+		slog.Warn("could not scrape product", "link", link, "domain", domain, "duration", elapsed, "kind", o, "error", err)
+	}
+}
+
+// scrape scrapes the product page at link, which belongs to market.
+func (s *Scraper) scrape(ctx context.Context, link string, market watchazon.Marketplace) (*watchazon.Product, error) {
+	var err error
 	product := &watchazon.Product{
 		Link: link,
 	}
 
-	c := colly.NewCollector(
-		colly.AllowedDomains(s.AllowedDomains...),
-	)
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	c := s.newCollector(ctx)
 
 	c.OnHTML("#productTitle", func(e *colly.HTMLElement) {
 		product.Title = strings.TrimSpace(e.Text)
 	})
 
-	c.OnHTML("#corePriceDisplay_desktop_feature_div span.a-price span.a-offscreen", func(e *colly.HTMLElement) {
-		fmt.Println(e.Text)
-		product.Price, err = convertPrice(e.Text, domain)
+	// Struck-through list prices shown next to deals are a-text-price, and must be ignored
+	c.OnHTML("#corePriceDisplay_desktop_feature_div span.a-price:not(.a-text-price) span.a-offscreen", func(e *colly.HTMLElement) {
+		product.Price, err = convertPrice(e.Text, market)
 	})
 
 	// Gets correct pricing for books and items providing various buying options
 	c.OnHTML("#price", func(e *colly.HTMLElement) {
-		fmt.Println("p ", e.Text)
-		product.Price, err = convertPrice(e.Text, domain)
+		product.Price, err = convertPrice(e.Text, market)
+	})
+
+	c.OnHTML("#availability", func(e *colly.HTMLElement) {
+		product.Availability, product.StockLeft = parseAvailability(e.Text)
+	})
+
+	// pageErr is set when the page isn't the one of the product.
+	var pageErr error
+	c.OnHTML(`form[action*="validateCaptcha"]`, func(e *colly.HTMLElement) {
+		pageErr = ErrCaptcha
+	})
+	c.OnHTML(`form[name="signIn"]`, func(e *colly.HTMLElement) {
+		pageErr = ErrSignIn
+	})
+	c.OnError(func(r *colly.Response, err error) {
+		if r.StatusCode == http.StatusNotFound {
+			pageErr = ErrNotFound
+		}
 	})
 
 	if err := c.Visit(link); err != nil {
+		if pageErr != nil {
+			return nil, pageErr
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
 		return nil, err
 	}
+	if pageErr != nil {
+		return nil, pageErr
+	}
+	if product.Title == "" {
+		return nil, ErrNoProduct
+	}
+
+	// Pages without the availability box still have a price when the product can be bought.
+	if product.Availability == watchazon.AvailabilityUnknown {
+		if !product.Price.IsZero() {
+			product.Availability = watchazon.InStock
+		} else {
+			product.Availability = watchazon.Unavailable
+		}
+	}
 
 	return product, err
 }
 
-func (s *Scraper) Search(query string, domain watchazon.Domain) ([]*watchazon.Product, error) {
-	query = strings.Join(strings.Split(query, " "), "+")
-	link := fmt.Sprintf("https://www.amazon.%s/s?k=%s", domain, query)
+func (s *Scraper) Search(ctx context.Context, query string, domain watchazon.Domain) ([]*watchazon.Product, error) {
+	market, ok := watchazon.LookupMarketplace(domain)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", watchazon.ErrUnknownMarketplace, domain)
+	}
+
+	link := market.SearchLink(query)
 	products := make([]*watchazon.Product, 0)
 
-	c := colly.NewCollector(
-		colly.AllowedDomains(s.AllowedDomains...),
-	)
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	c := s.newCollector(ctx)
 
 	c.OnHTML(".s-result-item", func(e *colly.HTMLElement) {
 		// Price
@@ -75,57 +292,72 @@ func (s *Scraper) Search(query string, domain watchazon.Domain) ([]*watchazon.Pr
 			}
 			p = element.Text
 		})
-		// If the price cannot be converted, it probably is because the product is out of stock. We skip it.
-		price, err := convertPrice(p, domain)
-		if err != nil {
-			return
-		}
-
 		img := e.ChildAttr(".s-image", "src")
 		title := e.ChildText("span.a-color-base.a-text-normal")
 
 		foundUrl := e.ChildAttr("a.a-link-normal.a-text-normal", "href")
-		link := fmt.Sprintf("https://www.amazon.%s%s", domain, foundUrl)
+		// Banners and other widgets share the result class, but aren't products.
+		if title == "" || foundUrl == "" {
+			return
+		}
+		link := market.URL(foundUrl)
+
+		// If the price cannot be converted, it is because the product is out of stock.
+		availability := watchazon.InStock
+		price, err := convertPrice(p, market)
+		if err != nil {
+			price = watchazon.Money{}
+			availability = watchazon.Unavailable
+		}
 
 		products = append(products, &watchazon.Product{
-			Title: title,
-			Image: img,
-			Link:  link,
-			Price: price,
+			Title:        title,
+			Image:        img,
+			Link:         link,
+			Price:        price,
+			Availability: availability,
 		})
 	})
 
+	start := time.Now()
 	if err := c.Visit(link); err != nil {
-		log.Println(err)
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		slog.Warn("could not search", "query", query, "domain", domain, "duration", time.Since(start), "kind", outcome(err), "error", err)
 		return nil, err
 	}
+	slog.Debug("searched", "query", query, "domain", domain, "duration", time.Since(start), "results", len(products))
 
 	return products, nil
 }
 
-func convertPrice(text string, domain watchazon.Domain) (float64, error) {
-	text = strings.Replace(text, "\u00a0", "", -1)
-	text = strings.Replace(text, " ", "", -1)
+// currencySymbols maps the unambiguous symbols shown next to prices to their currency, which may differ
+// from the one of the marketplace when Amazon displays converted prices.
+var currencySymbols = map[string]string{
+	"€":   "EUR",
+	"£":   "GBP",
+	"US$": "USD",
+}
 
-	switch domain {
-	case "com":
-		text = strings.Replace(text, "$", "", 1)
-		text = strings.Replace(text, ",", "", -1)
-	case "it", "es", "de":
-		text = strings.Replace(text, "€", "", 1)
-		text = strings.Replace(text, ".", "", -1)
-		text = strings.Replace(text, ",", ".", 1)
+// convertPrice parses a price as shown by the marketplace, ignoring symbols, spaces and grouping separators.
+func convertPrice(text string, market watchazon.Marketplace) (watchazon.Money, error) {
+	currency := market.Currency
+	for symbol, c := range currencySymbols {
+		if strings.Contains(text, symbol) {
+			currency = c
+		}
 	}
 
-	return strconv.ParseFloat(text, 64)
-}
-
-func domainFrom(link string) (watchazon.Domain, error) {
-	u, err := url.Parse(link)
-	if err != nil {
-		return "", err
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == market.DecimalSeparator:
+			b.WriteRune('.')
+		}
 	}
 
-	d := strings.Split(u.Host, ".")
-	return watchazon.Domain(d[len(d)-1]), nil
+	return watchazon.ParseMoney(b.String(), currency)
 }
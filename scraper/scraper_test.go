@@ -1,9 +1,18 @@
 package scraper
 
 import (
-	"fmt"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/giornetta/watchazon"
 )
@@ -16,7 +25,7 @@ func Test_convertPrice(t *testing.T) {
 	tests := []struct {
 		name    string
 		args    args
-		want    float64
+		want    watchazon.Money
 		wantErr bool
 	}{
 		{
@@ -25,7 +34,7 @@ func Test_convertPrice(t *testing.T) {
 				text:   "",
 				domain: "",
 			},
-			want:    0,
+			want:    watchazon.Money{},
 			wantErr: true,
 		},
 		{
@@ -34,7 +43,7 @@ func Test_convertPrice(t *testing.T) {
 				text:   "12,99 €",
 				domain: "it",
 			},
-			want:    12.99,
+			want:    watchazon.Money{Amount: 1299, Currency: "EUR"},
 			wantErr: false,
 		},
 		{
@@ -43,13 +52,59 @@ func Test_convertPrice(t *testing.T) {
 				text:   "1.099,89 €",
 				domain: "es",
 			},
-			want:    1099.89,
+			want:    watchazon.Money{Amount: 109989, Currency: "EUR"},
+			wantErr: false,
+		},
+		{
+			name: "Dollars",
+			args: args{
+				text:   "$1,049.00",
+				domain: "com",
+			},
+			want:    watchazon.Money{Amount: 104900, Currency: "USD"},
+			wantErr: false,
+		},
+		{
+			name: "Pounds",
+			args: args{
+				text:   "£1,234.56",
+				domain: "co.uk",
+			},
+			want:    watchazon.Money{Amount: 123456, Currency: "GBP"},
+			wantErr: false,
+		},
+		{
+			name: "Yen",
+			args: args{
+				text:   "￥12,800",
+				domain: "co.jp",
+			},
+			want:    watchazon.Money{Amount: 12800, Currency: "JPY"},
+			wantErr: false,
+		},
+		{
+			name: "Space grouping",
+			args: args{
+				text:   "1\u202f234,56\u00a0€",
+				domain: "fr",
+			},
+			want:    watchazon.Money{Amount: 123456, Currency: "EUR"},
+			wantErr: false,
+		},
+		{
+			name: "Converted",
+			args: args{
+				text:   "US$24.99",
+				domain: "co.uk",
+			},
+			want:    watchazon.Money{Amount: 2499, Currency: "USD"},
 			wantErr: false,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := convertPrice(tt.args.text, tt.args.domain)
+			market, _ := watchazon.LookupMarketplace(tt.args.domain)
+			got, err := convertPrice(tt.args.text, market)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("convertPrice() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -61,50 +116,343 @@ func Test_convertPrice(t *testing.T) {
 	}
 }
 
-func TestScraper_Scrape(t *testing.T) {
-	type fields struct {
-		AllowedDomains []string
+// fixtureHostHeader tells the fixture server which Amazon host was requested.
+const fixtureHostHeader = "X-Fixture-Host"
+
+// fixtureTransport sends every request to the fixture server instead of Amazon.
+type fixtureTransport struct {
+	server *httptest.Server
+}
+
+func (f fixtureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	u, err := url.Parse(f.server.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	r := req.Clone(req.Context())
+	r.URL.Scheme = u.Scheme
+	r.URL.Host = u.Host
+	r.Header.Set(fixtureHostHeader, req.URL.Host)
+
+	return f.server.Client().Transport.RoundTrip(r)
+}
+
+// fixtureRedirects maps the product pages for which Amazon answers with a redirect to its location.
+var fixtureRedirects = map[string]string{
+	"www.amazon.com/dp/B0SIGNIN01": "/ap/signin?openid.return_to=https%3A%2F%2Fwww.amazon.com%2Fdp%2FB0SIGNIN01",
+	"www.amazon.it/dp/B0REGION01":  "https://www.amazon.com/dp/B0REGION01",
+}
+
+// fixtureDir holds the synthetic pages written to match the selectors of the scraper, one directory per host.
+// They aren't captures of real pages, see its README.
+var fixtureDir = filepath.Join("testdata", "selectors")
+
+// serveFixture serves the pages in fixtureDir/<host>: search pages from search.html
+// and product pages from <ASIN>.html. Missing pages are served from dog.html, if any, as Amazon does.
+func serveFixture(w http.ResponseWriter, r *http.Request) {
+	host := r.Header.Get(fixtureHostHeader)
+	if location, ok := fixtureRedirects[host+r.URL.Path]; ok {
+		http.Redirect(w, r, location, http.StatusFound)
+		return
+	}
+
+	name := "search"
+	if r.URL.Path != "/s" {
+		segments := strings.Split(r.URL.Path, "/")
+		for i, s := range segments {
+			if s == "dp" && i+1 < len(segments) {
+				name = segments[i+1]
+				break
+			}
+		}
 	}
-	itFields := fields{AllowedDomains: []string{"www.amazon.it", "www.amazon.com"}}
 
+	status := http.StatusOK
+	b, err := os.ReadFile(filepath.Join(fixtureDir, host, name+".html"))
+	if err != nil {
+		status = http.StatusNotFound
+		if b, err = os.ReadFile(filepath.Join(fixtureDir, host, "dog.html")); err != nil {
+			http.NotFound(w, r)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	_, _ = w.Write(b)
+}
+
+// newFixtureScraper returns a Scraper whose requests are served from the pages in fixtureDir.
+func newFixtureScraper(t *testing.T) *Scraper {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(serveFixture))
+	t.Cleanup(server.Close)
+
+	s := New("www.amazon.com", "www.amazon.it", "www.amazon.de", "www.amazon.es")
+	s.Transport = fixtureTransport{server: server}
+	s.Delay, s.RandomDelay = 0, 0
+	s.Backoff = time.Millisecond
+
+	return s
+}
+
+func TestScraper_Scrape(t *testing.T) {
 	tests := []struct {
 		name    string
-		fields  fields
 		arg     string
 		want    *watchazon.Product
 		wantErr bool
 	}{
 		{
-			name:   "Echo Dot",
-			fields: itFields,
-			arg:    "https://www.amazon.it/amazon-echo-dot-3-generazione-altoparlante-intelligente-con-integrazione-alexa-tessuto-antracite/dp/B07PHPXHQS?pf_rd_p=0126cc1b-63c4-49e1-9993-8a52c0ac2cfb&pd_rd_wg=enBag&pf_rd_r=KDKKPBE97TFWNZQ3KZZG&ref_=pd_gw_cr_simh&pd_rd_w=4yt8m&pd_rd_r=df8dcc6a-d24d-418c-8fae-306022d242ec",
+			name: "Echo Dot",
+			arg:  "https://www.amazon.it/amazon-echo-dot-3-generazione-altoparlante-intelligente-con-integrazione-alexa-tessuto-antracite/dp/B07PHPXHQS?pf_rd_p=0126cc1b-63c4-49e1-9993-8a52c0ac2cfb&pd_rd_wg=enBag&pf_rd_r=KDKKPBE97TFWNZQ3KZZG&ref_=pd_gw_cr_simh&pd_rd_w=4yt8m&pd_rd_r=df8dcc6a-d24d-418c-8fae-306022d242ec",
 			want: &watchazon.Product{
-				Title: "Echo Dot (3ª generazione) - Altoparlante intelligente con integrazione Alexa - Tessuto antracite",
-				Image: "",
-				Link:  "https://www.amazon.it/amazon-echo-dot-3-generazione-altoparlante-intelligente-con-integrazione-alexa-tessuto-antracite/dp/B07PHPXHQS?pf_rd_p=0126cc1b-63c4-49e1-9993-8a52c0ac2cfb&pd_rd_wg=enBag&pf_rd_r=KDKKPBE97TFWNZQ3KZZG&ref_=pd_gw_cr_simh&pd_rd_w=4yt8m&pd_rd_r=df8dcc6a-d24d-418c-8fae-306022d242ec",
-				Price: 59.99,
+				Title:        "Echo Dot (3ª generazione) - Altoparlante intelligente con integrazione Alexa - Tessuto antracite",
+				Image:        "",
+				Link:         "https://www.amazon.it/amazon-echo-dot-3-generazione-altoparlante-intelligente-con-integrazione-alexa-tessuto-antracite/dp/B07PHPXHQS?pf_rd_p=0126cc1b-63c4-49e1-9993-8a52c0ac2cfb&pd_rd_wg=enBag&pf_rd_r=KDKKPBE97TFWNZQ3KZZG&ref_=pd_gw_cr_simh&pd_rd_w=4yt8m&pd_rd_r=df8dcc6a-d24d-418c-8fae-306022d242ec",
+				Price:        watchazon.Money{Amount: 5999, Currency: "EUR"},
+				Availability: watchazon.InStock,
 			},
 			wantErr: false,
 		},
 		{
-			name:   "Mi Band 3",
-			fields: itFields,
-			arg:    "https://www.amazon.com/Activity-Waterproof-Bracelet-Wristband-Pedometer/dp/B07GNGJK97/ref=sr_1_1?keywords=mi+band&qid=1566988072&s=gateway&sr=8-1",
+			name: "Mi Band 3",
+			arg:  "https://www.amazon.com/Activity-Waterproof-Bracelet-Wristband-Pedometer/dp/B07GNGJK97/ref=sr_1_1?keywords=mi+band&qid=1566988072&s=gateway&sr=8-1",
 			want: &watchazon.Product{
-				Title: "Xiaomi Fitness Tracker, Mi Band 3 Heart Rate Monitor Activity Tracker Watch 50M Waterproof Smart Bracelet 0.78 OLED Display Weather Forecast Wristband Pedometer Calories Burned Sleep Monitor Black",
-				Image: "",
-				Link:  "https://www.amazon.com/Activity-Waterproof-Bracelet-Wristband-Pedometer/dp/B07GNGJK97/ref=sr_1_1?keywords=mi+band&qid=1566988072&s=gateway&sr=8-1",
-				Price: 28.98,
+				Title:        "Xiaomi Fitness Tracker, Mi Band 3 Heart Rate Monitor Activity Tracker Watch 50M Waterproof Smart Bracelet 0.78 OLED Display Weather Forecast Wristband Pedometer Calories Burned Sleep Monitor Black",
+				Image:        "",
+				Link:         "https://www.amazon.com/Activity-Waterproof-Bracelet-Wristband-Pedometer/dp/B07GNGJK97/ref=sr_1_1?keywords=mi+band&qid=1566988072&s=gateway&sr=8-1",
+				Price:        watchazon.Money{Amount: 2898, Currency: "USD"},
+				Availability: watchazon.InStock,
 			},
 			wantErr: false,
 		},
+		{
+			name: "Book com",
+			arg:  "https://www.amazon.com/dp/0134190440",
+			want: &watchazon.Product{
+				Title:        "The Go Programming Language (Addison-Wesley Professional Computing Series)",
+				Link:         "https://www.amazon.com/dp/0134190440",
+				Price:        watchazon.Money{Amount: 3249, Currency: "USD"},
+				Availability: watchazon.InStock,
+			},
+		},
+		{
+			name: "Book it",
+			arg:  "https://www.amazon.it/dp/8845292614",
+			want: &watchazon.Product{
+				Title:        "Il nome della rosa",
+				Link:         "https://www.amazon.it/dp/8845292614",
+				Price:        watchazon.Money{Amount: 1235, Currency: "EUR"},
+				Availability: watchazon.InStock,
+			},
+		},
+		{
+			name: "Book de",
+			arg:  "https://www.amazon.de/dp/3446444865",
+			want: &watchazon.Product{
+				Title:        "Der Process: Roman",
+				Link:         "https://www.amazon.de/dp/3446444865",
+				Price:        watchazon.Money{Amount: 990, Currency: "EUR"},
+				Availability: watchazon.InStock,
+			},
+		},
+		{
+			name: "Book es",
+			arg:  "https://www.amazon.es/dp/8497592204",
+			want: &watchazon.Product{
+				Title:        "Cien años de soledad (Contemporánea)",
+				Link:         "https://www.amazon.es/dp/8497592204",
+				Price:        watchazon.Money{Amount: 1040, Currency: "EUR"},
+				Availability: watchazon.InStock,
+			},
+		},
+		{
+			name: "Multi-offer com",
+			arg:  "https://www.amazon.com/dp/B0BSHF7WHW",
+			want: &watchazon.Product{
+				Title:        "Apple 2023 MacBook Pro Laptop M2 Pro chip with 10‑core CPU and 16‑core GPU: 14.2-inch Liquid Retina XDR Display, 16GB Unified Memory, 512GB SSD Storage. Works with iPhone/iPad; Space Gray",
+				Link:         "https://www.amazon.com/dp/B0BSHF7WHW",
+				Price:        watchazon.Money{Amount: 184900, Currency: "USD"},
+				Availability: watchazon.InStock,
+			},
+		},
+		{
+			name: "Multi-offer it",
+			arg:  "https://www.amazon.it/dp/B0BSHF9ZSF",
+			want: &watchazon.Product{
+				Title:        "Apple 2023 MacBook Pro con chip M2 Pro: display Liquid Retina XDR da 14,2\", 16GB di RAM, 512GB di archiviazione SSD. Compatibile con iPhone/iPad; Grigio siderale",
+				Link:         "https://www.amazon.it/dp/B0BSHF9ZSF",
+				Price:        watchazon.Money{Amount: 224900, Currency: "EUR"},
+				Availability: watchazon.InStock,
+			},
+		},
+		{
+			name: "Multi-offer de",
+			arg:  "https://www.amazon.de/dp/B0BSHCNGTK",
+			want: &watchazon.Product{
+				Title:        "Apple 2023 MacBook Pro Laptop mit M2 Pro Chip: 14,2\" Liquid Retina XDR Display, 16 GB RAM, 512 GB SSD Speicher. Funktioniert mit iPhone/iPad; Space Grau",
+				Link:         "https://www.amazon.de/dp/B0BSHCNGTK",
+				Price:        watchazon.Money{Amount: 239900, Currency: "EUR"},
+				Availability: watchazon.InStock,
+			},
+		},
+		{
+			name: "Multi-offer es",
+			arg:  "https://www.amazon.es/dp/B0BSHF5CJQ",
+			want: &watchazon.Product{
+				Title:        "Apple 2023 MacBook Pro con Chip M2 Pro: Pantalla Liquid Retina XDR de 14,2 Pulgadas, 16 GB de RAM, 512 GB de Almacenamiento SSD. Funciona con iPhone/iPad; Gris Espacial",
+				Link:         "https://www.amazon.es/dp/B0BSHF5CJQ",
+				Price:        watchazon.Money{Amount: 109989, Currency: "EUR"},
+				Availability: watchazon.InStock,
+			},
+		},
+		{
+			name: "Out of stock com",
+			arg:  "https://www.amazon.com/dp/B09B8V1LZ3",
+			want: &watchazon.Product{
+				Title:        "Echo Dot (5th Gen, 2022 release) | Smart speaker with Alexa | Charcoal",
+				Link:         "https://www.amazon.com/dp/B09B8V1LZ3",
+				Availability: watchazon.Unavailable,
+			},
+		},
+		{
+			name: "Out of stock it",
+			arg:  "https://www.amazon.it/dp/B09B8X9RGM",
+			want: &watchazon.Product{
+				Title:        "Echo Dot (5ª generazione, modello 2022) | Altoparlante intelligente Bluetooth con Alexa | Antracite",
+				Link:         "https://www.amazon.it/dp/B09B8X9RGM",
+				Availability: watchazon.Unavailable,
+			},
+		},
+		{
+			name: "Out of stock de",
+			arg:  "https://www.amazon.de/dp/B09B8RF4PY",
+			want: &watchazon.Product{
+				Title:        "Echo Dot (5. Gen., 2022) | Smarter WLAN- und Bluetooth-Lautsprecher mit Alexa | Anthrazit",
+				Link:         "https://www.amazon.de/dp/B09B8RF4PY",
+				Availability: watchazon.Unavailable,
+			},
+		},
+		{
+			name: "Out of stock es",
+			arg:  "https://www.amazon.es/dp/B09B8W5FW7",
+			want: &watchazon.Product{
+				Title:        "Echo Dot (5.ª generación, modelo de 2022) | Altavoz inteligente wifi y Bluetooth con Alexa | Antracita",
+				Link:         "https://www.amazon.es/dp/B09B8W5FW7",
+				Availability: watchazon.Unavailable,
+			},
+		},
+		{
+			name: "Deal com",
+			arg:  "https://www.amazon.com/dp/B09TMN58KL",
+			want: &watchazon.Product{
+				Title:        "Kindle Paperwhite (16 GB) – Now with a larger display, adjustable warm light, increased battery life, and faster page turns – Black",
+				Link:         "https://www.amazon.com/dp/B09TMN58KL",
+				Price:        watchazon.Money{Amount: 10499, Currency: "USD"},
+				Availability: watchazon.InStock,
+			},
+		},
+		{
+			name: "Deal it",
+			arg:  "https://www.amazon.it/dp/B09TMF6742",
+			want: &watchazon.Product{
+				Title:        "Kindle Paperwhite (16 GB) | Ora con schermo da 6,8\" e luce calda regolabile, con pubblicità",
+				Link:         "https://www.amazon.it/dp/B09TMF6742",
+				Price:        watchazon.Money{Amount: 11999, Currency: "EUR"},
+				Availability: watchazon.InStock,
+			},
+		},
+		{
+			name: "Deal de",
+			arg:  "https://www.amazon.de/dp/B09TMZ8T7D",
+			want: &watchazon.Product{
+				Title:        "Kindle Paperwhite (16 GB) – Jetzt mit 6,8-Zoll-Display (17,3 cm) und verstellbarer Farbtemperatur – ohne Werbung – Schwarz",
+				Link:         "https://www.amazon.de/dp/B09TMZ8T7D",
+				Price:        watchazon.Money{Amount: 12999, Currency: "EUR"},
+				Availability: watchazon.InStock,
+			},
+		},
+		{
+			name: "Deal es",
+			arg:  "https://www.amazon.es/dp/B09TMP3CHF",
+			want: &watchazon.Product{
+				Title:        "Kindle Paperwhite (16 GB) | Ahora con una pantalla de 6,8\" y luz cálida ajustable, sin publicidad, negro",
+				Link:         "https://www.amazon.es/dp/B09TMP3CHF",
+				Price:        watchazon.Money{Amount: 13499, Currency: "EUR"},
+				Availability: watchazon.InStock,
+			},
+		},
+		{
+			name: "Pre-order",
+			arg:  "https://www.amazon.com/dp/B0BX7JQ2HB",
+			want: &watchazon.Product{
+				Title:        "The Legend of Zelda: Tears of the Kingdom Collector's Edition - Nintendo Switch",
+				Link:         "https://www.amazon.com/dp/B0BX7JQ2HB",
+				Price:        watchazon.Money{Amount: 12999, Currency: "USD"},
+				Availability: watchazon.PreOrder,
+			},
+		},
+		{
+			name: "Temporarily out of stock",
+			arg:  "https://www.amazon.com/dp/B07FZ8S74R",
+			want: &watchazon.Product{
+				Title:        "Echo Dot (3rd Gen) - Smart speaker with Alexa - Charcoal",
+				Link:         "https://www.amazon.com/dp/B07FZ8S74R",
+				Availability: watchazon.OutOfStock,
+			},
+		},
+		{
+			name: "Low stock it",
+			arg:  "https://www.amazon.it/dp/B09HMKFDXC",
+			want: &watchazon.Product{
+				Title:        "Logitech MX Master 3S - Mouse wireless con scorrimento ultraveloce, Grafite",
+				Link:         "https://www.amazon.it/dp/B09HMKFDXC",
+				Price:        watchazon.Money{Amount: 8999, Currency: "EUR"},
+				Availability: watchazon.LowStock,
+				StockLeft:    2,
+			},
+		},
+		{
+			name: "Low stock de",
+			arg:  "https://www.amazon.de/dp/B09HM94VDS",
+			want: &watchazon.Product{
+				Title:        "Logitech MX Master 3S – Kabellose Performance-Maus mit Ultra-schnellem Scrollen, Graphit",
+				Link:         "https://www.amazon.de/dp/B09HM94VDS",
+				Price:        watchazon.Money{Amount: 9490, Currency: "EUR"},
+				Availability: watchazon.LowStock,
+				StockLeft:    1,
+			},
+		},
+		{
+			name: "Low stock es",
+			arg:  "https://www.amazon.es/dp/B09HMV6K1W",
+			want: &watchazon.Product{
+				Title:        "Logitech MX Master 3S - Ratón inalámbrico con desplazamiento ultrarrápido, Grafito",
+				Link:         "https://www.amazon.es/dp/B09HMV6K1W",
+				Price:        watchazon.Money{Amount: 9299, Currency: "EUR"},
+				Availability: watchazon.LowStock,
+				StockLeft:    4,
+			},
+		},
+		{
+			name:    "Missing page",
+			arg:     "https://www.amazon.it/dp/B000000000",
+			wantErr: true,
+		},
+		{
+			name:    "Domain not allowed",
+			arg:     "https://www.amazon.fr/dp/B07PHPXHQS",
+			wantErr: true,
+		},
 	}
+
+	s := newFixtureScraper(t)
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			s := &Scraper{
-				AllowedDomains: tt.fields.AllowedDomains,
-			}
-			got, err := s.Scrape(tt.arg)
+			got, err := s.Scrape(context.Background(), tt.arg)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("Scrape() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -116,15 +464,170 @@ func TestScraper_Scrape(t *testing.T) {
 	}
 }
 
+func TestScraper_Scrape_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		arg  string
+		want error
+	}{
+		{"Captcha", "https://www.amazon.com/dp/B0CAPTCHA1", ErrCaptcha},
+		{"Dog page", "https://www.amazon.it/dp/B000000000", ErrNotFound},
+		{"Sign-in redirect", "https://www.amazon.com/dp/B0SIGNIN01", ErrSignIn},
+		{"Sign-in page", "https://www.amazon.de/dp/B0SIGNIN02", ErrSignIn},
+		{"Regional redirect", "https://www.amazon.it/dp/B0REGION01", ErrRedirected},
+		{"No product", "https://www.amazon.es/s?k=Samsung+S8", ErrNoProduct},
+	}
+
+	s := newFixtureScraper(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := s.Scrape(context.Background(), tt.arg); !errors.Is(err, tt.want) {
+				t.Errorf("Scrape() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestScraper_Scrape_Timeout(t *testing.T) {
+	s := newFixtureScraper(t)
+	// The captcha is retried after a wait longer than the timeout.
+	s.Backoff, s.Timeout = time.Hour, 50*time.Millisecond
+
+	start := time.Now()
+	if _, err := s.Scrape(context.Background(), "https://www.amazon.com/dp/B0CAPTCHA1"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Scrape() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Scrape() took %v, want it to stop at the timeout", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := s.Scrape(ctx, "https://www.amazon.it/dp/B07PHPXHQS"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Scrape() with a canceled context error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestScraper_Configure(t *testing.T) {
+	s := newFixtureScraper(t)
+	echo := "https://www.amazon.it/dp/B07PHPXHQS"
+	if _, err := s.Scrape(context.Background(), echo); err != nil {
+		t.Fatalf("Scrape() error = %v", err)
+	}
+
+	// The scraper is in use, the new settings apply to the next scrapes.
+	s.Configure(Settings{AllowedDomains: []string{"www.amazon.de"}, Retries: 1, Backoff: time.Hour, Timeout: 50 * time.Millisecond})
+	if _, err := s.Scrape(context.Background(), echo); err == nil {
+		t.Errorf("Scrape() of a domain no longer allowed expected an error")
+	}
+	if _, err := s.Scrape(context.Background(), "https://www.amazon.de/dp/B0SIGNIN02"); !errors.Is(err, ErrSignIn) {
+		t.Errorf("Scrape() of an allowed domain error = %v, want %v", err, ErrSignIn)
+	}
+
+	s.Configure(Settings{Timeout: 50 * time.Millisecond, Retries: 1, Backoff: time.Hour})
+	if _, err := s.Scrape(context.Background(), "https://www.amazon.com/dp/B0CAPTCHA1"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Scrape() retrying after the new backoff error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
 func TestScraper_Search(t *testing.T) {
-	s := New("www.amazon.it", "www.amazon.com")
+	tests := []struct {
+		domain watchazon.Domain
+		want   []*watchazon.Product
+	}{
+		{
+			domain: "com",
+			want: []*watchazon.Product{
+				searchResult("com", "Samsung Galaxy S8 64GB Unlocked Phone - International Version (Midnight Black)", "B06Y14T5YW", 1, 172),
+				searchResult("com", "Spigen Rugged Armor Designed for Galaxy S8 Case (2017) - Black", "B06XRVNHSZ", 2, 11),
+				searchResult("com", "Samsung Galaxy S8 Active 64GB G892A - AT&T - Meteor Gray", "B0744NS7PQ", 3, 0),
+				searchResult("com", "Samsung Galaxy S8+ Plus 64GB SM-G955U Factory Unlocked", "B06Y16RL4W", 4, 1049),
+			},
+		},
+		{
+			domain: "it",
+			want: []*watchazon.Product{
+				searchResult("it", "Samsung Galaxy S8 Smartphone, 64 GB, Nero (Midnight Black)", "B06XZZ2C8W", 1, 299),
+				searchResult("it", "MoEx Custodia Samsung Galaxy S8, Cover in Silicone Trasparente", "B071S3PX1Q", 2, 7),
+				searchResult("it", "Samsung Galaxy S8 Active, Grigio", "B074DZ1M9F", 3, 0),
+				searchResult("it", "Samsung Galaxy S8+ 64GB, Orchid Gray, Edizione Premium", "B06XYR4BYJ", 4, 1099),
+			},
+		},
+		{
+			domain: "de",
+			want: []*watchazon.Product{
+				searchResult("de", "Samsung Galaxy S8 Smartphone (5,8 Zoll (14,7 cm) Touch-Display, 64 GB interner Speicher, Android) midnight black", "B06XZW6Q7Q", 1, 249),
+				searchResult("de", "Spigen Rugged Armor Hülle Kompatibel mit Samsung Galaxy S8", "B06XRXM4WK", 2, 12),
+				searchResult("de", "Samsung Galaxy S8+ Smartphone (6,2 Zoll) 64 GB, Orchid Gray", "B06XWN2WMZ", 3, 1049),
+			},
+		},
+		{
+			domain: "es",
+			want: []*watchazon.Product{
+				searchResult("es", "Samsung Galaxy S8 - Smartphone libre Android (5.8\", 4 GB RAM, 64 GB), color negro", "B06XZNXS5L", 1, 289),
+				searchResult("es", "Spigen Funda Samsung Galaxy S8 Rugged Armor", "B06XRW3KN5", 2, 10),
+				searchResult("es", "Samsung Galaxy S8 Active, Gris", "B074DY5YHG", 3, 0),
+			},
+		},
+	}
 
-	got, err := s.Search("Samsung S8", "it")
-	if err != nil {
-		t.Fatalf("could not search: %v", err)
+	s := newFixtureScraper(t)
+	for _, tt := range tests {
+		t.Run(string(tt.domain), func(t *testing.T) {
+			got, err := s.Search(context.Background(), "Samsung S8", tt.domain)
+			if err != nil {
+				t.Fatalf("could not search: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Search() got = %v, want %v", got, tt.want)
+			}
+		})
 	}
+}
 
-	for _, p := range got {
-		fmt.Printf("%s: %.2f\n", p.Link, p.Price)
+// searchResult returns the product expected from the search fixtures for the result at the given position.
+// Prices are in whole units, as shown in the search results, and results without a price are unavailable.
+func searchResult(domain watchazon.Domain, title, asin string, position int, price int64) *watchazon.Product {
+	slug := strings.ToLower(strings.Split(title, " ")[0])
+
+	availability := watchazon.InStock
+	market, _ := watchazon.LookupMarketplace(domain)
+	currency := market.Currency
+	if price == 0 {
+		availability = watchazon.Unavailable
+		currency = ""
+	}
+
+	return &watchazon.Product{
+		Title:        title,
+		Image:        "https://m.media-amazon.com/images/I/" + asin + "._AC_UY218_.jpg",
+		Link:         "https://www.amazon." + string(domain) + "/" + slug + "/dp/" + asin + "/ref=sr_1_" + strconv.Itoa(position),
+		Price:        watchazon.Money{Amount: price * 100, Currency: currency},
+		Availability: availability,
+	}
+}
+
+func Test_parseAvailability(t *testing.T) {
+	tests := []struct {
+		text      string
+		want      watchazon.Availability
+		wantStock int
+	}{
+		{"In Stock", watchazon.InStock, 0},
+		{"Only 3 left in stock - order soon.", watchazon.LowStock, 3},
+		{"Temporarily out of stock.", watchazon.OutOfStock, 0},
+		{"Momentaneamente non disponibile.", watchazon.OutOfStock, 0},
+		{"Non disponibile.", watchazon.Unavailable, 0},
+		{"Derzeit nicht verfügbar.", watchazon.Unavailable, 0},
+		{"Disponible para reserva.", watchazon.PreOrder, 0},
+		{"Usually ships within 6 to 10 days.", watchazon.AvailabilityUnknown, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			got, stock := parseAvailability(tt.text)
+			if got != tt.want || stock != tt.wantStock {
+				t.Errorf("parseAvailability() got = %v, %d, want %v, %d", got, stock, tt.want, tt.wantStock)
+			}
+		})
 	}
 }
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// staleAfter is how long the checks of the products can keep failing before the service is reported unhealthy.
+const staleAfter = time.Hour
+
+// checkLog remembers the outcome of the latest checks of the products.
+type checkLog struct {
+	mu sync.Mutex
+	// started is when the service was created, the reference for staleness before any successful check.
+	started     time.Time
+	lastSuccess time.Time
+	lastFailure time.Time
+	lastError   string
+	// lastUpdate is when the scheduler last completed a pass, checking all the products due.
+	lastUpdate time.Time
+}
+
+func (l *checkLog) success(at time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.lastSuccess = at
+}
+
+func (l *checkLog) failure(at time.Time, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.lastFailure, l.lastError = at, err.Error()
+}
+
+func (l *checkLog) update(at time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.lastUpdate = at
+}
+
+// Health reports when the products were last checked successfully and when the scheduler last completed a pass
+// over the products due, failing if all the checks
+// have been failing for more than staleAfter.
+func (s *Service) Health(ctx context.Context) (map[string]interface{}, error) {
+	l := s.checks
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	detail := map[string]interface{}{
+		"last_success": formatTime(l.lastSuccess),
+		"last_failure": formatTime(l.lastFailure),
+		"last_update":  formatTime(l.lastUpdate),
+	}
+	if l.lastError != "" {
+		detail["last_error"] = l.lastError
+	}
+
+	since := l.lastSuccess
+	if since.IsZero() {
+		since = l.started
+	}
+	if l.lastFailure.After(l.lastSuccess) && time.Since(since) > staleAfter {
+		return detail, fmt.Errorf("checks failing since %s", since.Format(time.RFC3339))
+	}
+
+	return detail, nil
+}
+
+// formatTime formats t for the health detail, where the zero time means never.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,40 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/giornetta/watchazon/memory"
+	"github.com/giornetta/watchazon/scraper"
+)
+
+func TestService_Health(t *testing.T) {
+	s := New(scraper.New(), memory.New(), 1)
+	now := time.Now()
+
+	if _, err := s.Health(context.Background()); err != nil {
+		t.Errorf("Health() of a new service error = %v", err)
+	}
+
+	// A recent failure isn't enough to be unhealthy.
+	s.checks.failure(now, errors.New("captcha page"))
+	if _, err := s.Health(context.Background()); err != nil {
+		t.Errorf("Health() after a failure error = %v", err)
+	}
+
+	s.checks.started = now.Add(-2 * staleAfter)
+	detail, err := s.Health(context.Background())
+	if err == nil {
+		t.Errorf("Health() after failing for %v expected an error", 2*staleAfter)
+	}
+	if detail["last_error"] != "captcha page" {
+		t.Errorf("Health() last_error = %v, want captcha page", detail["last_error"])
+	}
+
+	s.checks.success(now.Add(time.Second))
+	if _, err := s.Health(context.Background()); err != nil {
+		t.Errorf("Health() after a success error = %v", err)
+	}
+}
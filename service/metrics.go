@@ -0,0 +1,29 @@
+package service
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	updateDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "watchazon",
+		Name:      "update_duration_seconds",
+		Help:      "Time taken by a pass of the scheduler to check all the products due, from the first check to the last.",
+		Buckets:   prometheus.ExponentialBuckets(10, 2, 10),
+	})
+
+	checkLag = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "watchazon",
+		Name:      "check_lag_seconds",
+		Help:      "Time between when a product was due to be checked and when a worker started checking it.",
+		Buckets:   prometheus.ExponentialBuckets(0.1, 4, 10),
+	})
+
+	checkDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "watchazon",
+		Name:      "check_duration_seconds",
+		Help:      "Time taken to check a product, saving and notifying its changes, by outcome.",
+		Buckets:   []float64{0.5, 1, 2.5, 5, 10, 20, 40, 80, 120},
+	}, []string{"outcome"})
+)
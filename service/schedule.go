@@ -0,0 +1,312 @@
+package service
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/giornetta/watchazon"
+)
+
+// Intervals tune the wait between the checks of the products.
+type Intervals struct {
+	// Base is the wait between the checks of a product with one watcher and a price changing once a week.
+	Base time.Duration
+	// Min and Max bound the wait between the checks of a product.
+	Min time.Duration
+	Max time.Duration
+}
+
+// DefaultIntervals are the intervals of the service when none are configured.
+var DefaultIntervals = Intervals{
+	Base: 25 * time.Minute,
+	Min:  5 * time.Minute,
+	Max:  12 * time.Hour,
+}
+
+// volatilityWindow is how far back the price changes of a product are counted to tell how volatile it is.
+const volatilityWindow = 7 * 24 * time.Hour
+
+// maxFailureBackoff limits how many times the interval is doubled for the failed checks of a product.
+const maxFailureBackoff = 5
+
+// interval returns the wait before the next check of a product, given its recent prices, oldest first:
+//   - it's divided by the number of price changes, and doubled for products whose price didn't change
+//   - it's divided by the square root of the number of watchers, so popular products are checked more often
+//   - it's doubled for each failed check in a row, not to insist on products Amazon refuses to show
+func interval(iv Intervals, p *watchazon.Product, watchers int, points []watchazon.PricePoint) time.Duration {
+	d := iv.Base
+
+	changes := 0
+	for i := 1; i < len(points); i++ {
+		if points[i].Price != points[i-1].Price {
+			changes++
+		}
+	}
+	if changes == 0 {
+		d *= 2
+	} else {
+		d /= time.Duration(changes)
+	}
+
+	if watchers > 1 {
+		d = time.Duration(float64(d) / math.Sqrt(float64(watchers)))
+	}
+
+	if p.FailedChecks > 0 {
+		d <<= min(p.FailedChecks, maxFailureBackoff)
+	}
+
+	switch {
+	case d < iv.Min:
+		return iv.Min
+	case d > iv.Max:
+		return iv.Max
+	default:
+		return d
+	}
+}
+
+// SetIntervals changes how often the products are checked. The products already scheduled keep their next check,
+// the new intervals apply from the one after.
+func (s *Service) SetIntervals(iv Intervals) {
+	s.intervalsMu.Lock()
+	defer s.intervalsMu.Unlock()
+
+	s.intervals = iv
+}
+
+// nextCheck returns when the product, last checked at now, must be checked again.
+func (s *Service) nextCheck(ctx context.Context, p *watchazon.Product, watchers int, now time.Time) time.Time {
+	points, err := s.store.PriceHistory(ctx, p.Link, now.Add(-volatilityWindow), time.Time{})
+	if err != nil {
+		slog.Error("could not get price history", "link", p.Link, "error", err)
+	}
+
+	// The price just scraped may not be in the history yet.
+	if !p.Price.IsZero() && (len(points) == 0 || p.CheckedAt.After(points[len(points)-1].CheckedAt)) {
+		points = append(points, watchazon.PricePoint{Price: p.Price, CheckedAt: p.CheckedAt})
+	}
+
+	s.intervalsMu.RLock()
+	iv := s.intervals
+	s.intervalsMu.RUnlock()
+
+	return now.Add(interval(iv, p, watchers, points))
+}
+
+// retryLater schedules again a product whose check couldn't be completed because of the store, after the
+// minimum interval, so that it isn't dropped from the schedule until the next restart.
+func (s *Service) retryLater(link, msg string, err error) {
+	s.intervalsMu.RLock()
+	retry := time.Now().Add(s.intervals.Min)
+	s.intervalsMu.RUnlock()
+
+	slog.Error(msg, "link", link, "retry_at", retry, "error", err)
+	s.schedule.add(link, retry)
+}
+
+// Run checks the stored products as they become due, using the workers of the service.
+// It returns when ctx is done, once the checks in progress are canceled.
+func (s *Service) Run(ctx context.Context) {
+	for {
+		records, err := s.store.GetAll(ctx)
+		if err == nil {
+			for _, r := range records {
+				s.schedule.add(r.Link, r.NextCheckAt)
+			}
+			break
+		}
+
+		slog.Error("could not load the products to check", "error", err)
+		select {
+		case <-time.After(time.Minute):
+		case <-ctx.Done():
+			return
+		}
+	}
+
+	queue := make(chan string)
+	// done receives a value for each product taken from queue, once its check is over.
+	done := make(chan struct{})
+
+	var wg sync.WaitGroup
+	wg.Add(s.workers)
+	for i := 0; i < s.workers; i++ {
+		go func() {
+			defer wg.Done()
+			for link := range queue {
+				s.checkScheduled(ctx, link)
+				select {
+				case done <- struct{}{}:
+				case <-ctx.Done():
+				}
+			}
+		}()
+	}
+	defer wg.Wait()
+	defer close(queue)
+
+	// A pass starts when a product becomes due while none are being checked, and ends once all the products due
+	// have been checked. link is the product due that's waiting for a worker, pending the checks in progress.
+	var (
+		link      string
+		due       time.Time
+		pending   int
+		passStart time.Time
+	)
+	for {
+		if link == "" {
+			var wait time.Duration
+			link, due, wait = s.schedule.next(time.Now())
+			if link == "" {
+				if pending == 0 && !passStart.IsZero() {
+					s.checks.update(time.Now())
+					updateDuration.Observe(time.Since(passStart).Seconds())
+					passStart = time.Time{}
+				}
+
+				t := time.NewTimer(wait)
+				select {
+				case <-t.C:
+				case <-s.schedule.wake:
+					t.Stop()
+				case <-done:
+					t.Stop()
+					pending--
+				case <-ctx.Done():
+					t.Stop()
+					return
+				}
+				continue
+			}
+		}
+
+		select {
+		case queue <- link:
+			checkLag.Observe(time.Since(due).Seconds())
+			if passStart.IsZero() {
+				passStart = time.Now()
+			}
+			pending++
+			link = ""
+		case <-done:
+			pending--
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// checkScheduled checks the product whose check was due.
+func (s *Service) checkScheduled(ctx context.Context, link string) {
+	// Products nobody watches anymore are deleted, and so dropped from the schedule.
+	rec, err := s.store.Get(ctx, link)
+	if errors.Is(err, watchazon.ErrNotFound) {
+		return
+	}
+	if err != nil {
+		s.retryLater(link, "could not get product to check", err)
+		return
+	}
+	s.update(ctx, rec)
+}
+
+// A check is a product in the schedule.
+type check struct {
+	link  string
+	due   time.Time
+	index int
+}
+
+// checkQueue is a min-heap of the checks, the one due first at the top.
+type checkQueue []*check
+
+func (q checkQueue) Len() int           { return len(q) }
+func (q checkQueue) Less(i, j int) bool { return q[i].due.Before(q[j].due) }
+
+func (q checkQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index, q[j].index = i, j
+}
+
+func (q *checkQueue) Push(x interface{}) {
+	c := x.(*check)
+	c.index = len(*q)
+	*q = append(*q, c)
+}
+
+func (q *checkQueue) Pop() interface{} {
+	old := *q
+	c := old[len(old)-1]
+	old[len(old)-1] = nil
+	*q = old[:len(old)-1]
+	return c
+}
+
+// schedule keeps the products ordered by when they are due to be checked, each product at most once.
+type schedule struct {
+	mu     sync.Mutex
+	queue  checkQueue
+	checks map[string]*check
+	// wake tells Run that a product may be due earlier than what it's waiting for.
+	wake chan struct{}
+}
+
+func newSchedule() *schedule {
+	return &schedule{
+		checks: make(map[string]*check),
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// add schedules the check of the product at due, moving it if it was already scheduled.
+func (s *schedule) add(link string, due time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if c, ok := s.checks[link]; ok {
+		c.due = due
+		heap.Fix(&s.queue, c.index)
+	} else {
+		c = &check{link: link, due: due}
+		s.checks[link] = c
+		heap.Push(&s.queue, c)
+	}
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// next removes from the schedule and returns the first product due at now with when it was due,
+// or returns how long to wait for one if there are none.
+func (s *schedule) next(now time.Time) (string, time.Time, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.queue) == 0 {
+		return "", time.Time{}, time.Hour
+	}
+
+	first := s.queue[0]
+	if first.due.After(now) {
+		return "", time.Time{}, first.due.Sub(now)
+	}
+
+	heap.Pop(&s.queue)
+	delete(s.checks, first.link)
+	return first.link, first.due, 0
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
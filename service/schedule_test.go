@@ -0,0 +1,219 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/giornetta/watchazon"
+	"github.com/giornetta/watchazon/memory"
+	"github.com/giornetta/watchazon/scraper"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestInterval(t *testing.T) {
+	now := time.Now()
+	prices := func(amounts ...int64) []watchazon.PricePoint {
+		points := make([]watchazon.PricePoint, len(amounts))
+		for i, a := range amounts {
+			points[i] = watchazon.PricePoint{Price: watchazon.Money{Amount: a, Currency: "EUR"}, CheckedAt: now.Add(time.Duration(i) * time.Hour)}
+		}
+		return points
+	}
+
+	tests := []struct {
+		name     string
+		failed   int
+		watchers int
+		points   []watchazon.PricePoint
+		want     time.Duration
+	}{
+		{"Stable", 0, 1, prices(5999, 5999), 2 * DefaultIntervals.Base},
+		{"One change", 0, 1, prices(5999, 4999), DefaultIntervals.Base},
+		{"Volatile", 0, 1, prices(5999, 4999, 5999, 4999), DefaultIntervals.Base / 3},
+		{"Popular", 0, 4, prices(5999, 4999), DefaultIntervals.Base / 2},
+		{"Failing", 2, 1, prices(5999, 4999), 4 * DefaultIntervals.Base},
+		{"Lower bound", 0, 100, prices(1, 2, 3, 4, 5, 6), DefaultIntervals.Min},
+		{"Upper bound", 20, 1, nil, DefaultIntervals.Max},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &watchazon.Product{FailedChecks: tt.failed}
+			if got := interval(DefaultIntervals, p, tt.watchers, tt.points); got != tt.want {
+				t.Errorf("interval() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestService_SetIntervals(t *testing.T) {
+	s := New(scraper.New(), memory.New(), 1)
+	p := &watchazon.Product{Link: "https://www.amazon.it/dp/B07PHPXHQS"}
+	now := time.Now()
+
+	if got := s.nextCheck(context.Background(), p, 1, now); got != now.Add(2*DefaultIntervals.Base) {
+		t.Errorf("nextCheck() got = %v, want %v", got, now.Add(2*DefaultIntervals.Base))
+	}
+
+	s.SetIntervals(Intervals{Base: time.Hour, Min: time.Hour, Max: time.Hour})
+	if got := s.nextCheck(context.Background(), p, 1, now); got != now.Add(time.Hour) {
+		t.Errorf("nextCheck() after SetIntervals got = %v, want %v", got, now.Add(time.Hour))
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	now := time.Now()
+	s := newSchedule()
+
+	s.add("a", now.Add(time.Hour))
+	s.add("b", now.Add(-time.Minute))
+	s.add("c", now.Add(-time.Hour))
+	// Scheduling a product again moves it instead of adding it twice.
+	s.add("a", now.Add(-2*time.Hour))
+	s.add("b", now.Add(30*time.Minute))
+
+	for _, want := range []string{"a", "c"} {
+		if got, _, _ := s.next(now); got != want {
+			t.Fatalf("next() got = %q, want %q", got, want)
+		}
+	}
+
+	got, _, wait := s.next(now)
+	if got != "" || wait != 30*time.Minute {
+		t.Errorf("next() got = %q, %v, want to wait 30m for b", got, wait)
+	}
+}
+
+func TestService_Run_Shutdown(t *testing.T) {
+	sc := scraper.New()
+	sc.Transport = captchaTransport{}
+	// The captcha is retried long after the shutdown.
+	sc.Delay, sc.RandomDelay, sc.Retries, sc.Backoff = 0, 0, 1, time.Hour
+
+	store := memory.New()
+	link := "https://www.amazon.it/dp/B07PHPXHQS"
+	if err := store.Insert(context.Background(), &watchazon.Product{Title: "Echo Dot", Link: link}, 1); err != nil {
+		t.Fatalf("could not insert product: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		New(sc, store, 1).Run(ctx)
+		close(done)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run() didn't return after the shutdown")
+	}
+
+	rec, err := store.Get(context.Background(), link)
+	if err != nil {
+		t.Fatalf("could not get product: %v", err)
+	}
+	if rec.Failure != "" || rec.FailedChecks != 0 {
+		t.Errorf("Run() recorded failure %q after the shutdown, want none", rec.Failure)
+	}
+}
+
+// flakyStore fails the first Get of a product, as a store that is briefly unreachable.
+type flakyStore struct {
+	watchazon.Store
+	failed chan struct{}
+}
+
+func (s *flakyStore) Get(ctx context.Context, link string) (*watchazon.Record, error) {
+	select {
+	case <-s.failed:
+		return s.Store.Get(ctx, link)
+	default:
+		close(s.failed)
+		return nil, errors.New("store unreachable")
+	}
+}
+
+func TestService_Run_StoreError(t *testing.T) {
+	store := &flakyStore{Store: memory.New(), failed: make(chan struct{})}
+	link := "https://www.amazon.it/dp/B07PHPXHQS"
+	if err := store.Insert(context.Background(), &watchazon.Product{Title: "Echo Dot", Link: link}, 1); err != nil {
+		t.Fatalf("could not insert product: %v", err)
+	}
+
+	s := New(scraper.New(), store, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+
+	select {
+	case <-store.failed:
+	case <-time.After(time.Second):
+		t.Fatal("Run() didn't check the product")
+	}
+	cancel()
+	<-done
+
+	s.schedule.mu.Lock()
+	defer s.schedule.mu.Unlock()
+	c, ok := s.schedule.checks[link]
+	if !ok {
+		t.Fatal("Run() dropped the product from the schedule after a store error")
+	}
+	if wait := time.Until(c.due); wait <= 0 || wait > DefaultIntervals.Min {
+		t.Errorf("Run() scheduled the product in %v, want within %v", wait, DefaultIntervals.Min)
+	}
+}
+
+// passes returns how many passes of the scheduler were recorded.
+func passes(t *testing.T) uint64 {
+	var m dto.Metric
+	if err := updateDuration.(prometheus.Metric).Write(&m); err != nil {
+		t.Fatalf("could not read update duration: %v", err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestService_Run_Pass(t *testing.T) {
+	// The product can't be got, so its check is over at once and it's scheduled again long after.
+	store := &flakyStore{Store: memory.New(), failed: make(chan struct{})}
+	if err := store.Insert(context.Background(), &watchazon.Product{Title: "Echo Dot", Link: "https://www.amazon.it/dp/B07PHPXHQS"}, 1); err != nil {
+		t.Fatalf("could not insert product: %v", err)
+	}
+
+	before := passes(t)
+	s := New(scraper.New(), store, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for passes(t) == before {
+		if time.Now().After(deadline) {
+			t.Fatal("Run() didn't record the pass once the products due were checked")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	detail, err := s.Health(context.Background())
+	if err != nil {
+		t.Fatalf("Health() error = %v", err)
+	}
+	if detail["last_update"] == "never" {
+		t.Error("Health() last_update = never after a pass")
+	}
+}
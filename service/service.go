@@ -1,82 +1,155 @@
 package service
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"net/mail"
 	"net/url"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/giornetta/watchazon"
-	"github.com/giornetta/watchazon/database"
 	"github.com/giornetta/watchazon/scraper"
 )
 
 type Service struct {
 	scraper       *scraper.Scraper
-	database      *database.Database
+	store         watchazon.Store
 	notifications chan *watchazon.Notification
+	// wake tells the dispatcher that notifications were added to the outbox.
+	wake         chan struct{}
+	dispatchOnce sync.Once
+	// workers is how many products are updated concurrently.
+	workers int
+	// schedule orders the products by when they are due to be checked.
+	schedule *schedule
+	// checks tells how the checks of the products are going, for Health.
+	checks *checkLog
+
+	// intervals tune how often the products are checked, they may be changed by SetIntervals while the service runs.
+	intervals   Intervals
+	intervalsMu sync.RWMutex
 }
 
+// DefaultWorkers is the number of products updated concurrently when none is configured.
+const DefaultWorkers = 4
+
+// historyRetention is how long price points are kept in the history of a product.
+const historyRetention = 365 * 24 * time.Hour
+
+const (
+	// dispatchInterval is how often the outbox is checked for notifications due for a retry.
+	dispatchInterval = time.Minute
+	// ackTimeout is how long a notification waits to be acknowledged before being delivered again. The listener takes
+	// the notifications one at a time, so it must cover the delivery in progress when one is sent plus its own.
+	ackTimeout = 5 * time.Minute
+	// retryBackoff is the wait before delivering again a failed notification, doubled at each attempt.
+	retryBackoff = time.Minute
+	// maxAttempts is how many deliveries of a notification can fail before it's dropped.
+	maxAttempts = 8
+)
+
 var (
 	ErrInvalidLink = errors.New("invalid link")
 	ErrInternal    = errors.New("internal server error")
+	ErrNotWatched  = errors.New("product not in watchlist")
+	ErrInvalidRule = errors.New("invalid alert rule")
+	ErrNotFound    = errors.New("product not found on Amazon")
+	ErrBlocked     = errors.New("amazon is blocking our requests, try again later")
+
+	ErrInvalidEmail   = errors.New("invalid email address")
+	ErrInvalidChannel = errors.New("unknown notification channel")
+	ErrNoEmail        = errors.New("set an email address before enabling email notifications")
+	ErrInvalidWebhook = errors.New("invalid webhook url")
+	ErrUnauthorized   = errors.New("invalid api token")
 )
 
-func New(sc *scraper.Scraper, db *database.Database) *Service {
+// channels are the notification channels users can choose.
+var channels = map[string]bool{
+	watchazon.ChannelTelegram: true,
+	watchazon.ChannelEmail:    true,
+	watchazon.ChannelWebhook:  true,
+	watchazon.ChannelDiscord:  true,
+}
+
+// New returns a service updating up to workers products at a time, or DefaultWorkers if workers isn't positive.
+func New(sc *scraper.Scraper, store watchazon.Store, workers int) *Service {
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+
 	return &Service{
 		scraper:       sc,
-		database:      db,
+		store:         store,
 		notifications: make(chan *watchazon.Notification),
+		wake:          make(chan struct{}, 1),
+		workers:       workers,
+		schedule:      newSchedule(),
+		checks:        &checkLog{started: time.Now()},
+		intervals:     DefaultIntervals,
 	}
 }
 
-func (s *Service) AddToWatchList(link string, userID int64) error {
+func (s *Service) AddToWatchList(ctx context.Context, link string, userID int64) (*watchazon.Product, error) {
 	link, err := sanitizeURL(link)
 	if err != nil {
-		return ErrInvalidLink
+		return nil, ErrInvalidLink
 	}
 
-	scraped, err := s.scraper.Scrape(link)
+	scraped, err := s.scraper.Scrape(ctx, link)
 	if err != nil {
-		log.Printf("could not scrape %s: %v", link, err)
-		return ErrInternal
+		slog.Info("could not add product to watchlist", "link", link, "user_id", userID, "error", err)
+		switch {
+		case errors.Is(err, scraper.ErrNotFound), errors.Is(err, scraper.ErrRedirected), errors.Is(err, scraper.ErrNoProduct):
+			return nil, ErrNotFound
+		case errors.Is(err, scraper.ErrCaptcha), errors.Is(err, scraper.ErrSignIn):
+			return nil, ErrBlocked
+		}
+		return nil, ErrInternal
 	}
 	scraped.CheckedAt = time.Now()
 
-	fmt.Println(scraped.Price)
-
-	stored, err := s.database.Get(link)
+	stored, err := s.store.Get(ctx, link)
 	if err != nil {
-		err := s.database.Insert(scraped, userID)
+		scraped.NextCheckAt = s.nextCheck(ctx, scraped, 1, scraped.CheckedAt)
+		err := s.store.Insert(ctx, scraped, userID)
 		if err != nil {
-			log.Printf("could not insert product: %v", err)
-			return ErrInternal
+			slog.Error("could not insert product", "link", link, "user_id", userID, "error", err)
+			return nil, ErrInternal
 		}
-		return nil
+		s.recordPrice(ctx, scraped)
+		s.schedule.add(scraped.Link, scraped.NextCheckAt)
+		return scraped, nil
 	}
 
-	if stored.Price != scraped.Price {
-		for _, u := range stored.Users {
-			s.notify(scraped, u)
-		}
-	}
+	s.notifyWatchers(ctx, stored, scraped)
 
-	err = s.database.Update(scraped, userID)
+	watchers := len(stored.Users)
+	if !stored.Watched(userID) {
+		watchers++
+	}
+	scraped.NextCheckAt = s.nextCheck(ctx, scraped, watchers, scraped.CheckedAt)
+	err = s.store.Update(ctx, scraped, userID)
 	if err != nil {
-		log.Printf("could not update product: %v", err)
-		return ErrInternal
+		slog.Error("could not update product", "link", link, "user_id", userID, "error", err)
+		return nil, ErrInternal
 	}
+	s.recordPrice(ctx, scraped)
+	s.schedule.add(scraped.Link, scraped.NextCheckAt)
 
-	return nil
+	return scraped, nil
 }
 
-func (s *Service) GetUserWatchList(user int64) ([]*watchazon.Product, error) {
-	prods, err := s.database.GetUserWatchList(user)
+func (s *Service) GetUserWatchList(ctx context.Context, user int64) ([]*watchazon.Product, error) {
+	prods, err := s.store.GetUserWatchList(ctx, user)
 	if err != nil {
-		log.Printf("could not get watchlist")
+		slog.Error("could not get watchlist", "user_id", user, "error", err)
 		return nil, ErrInternal
 	}
 
@@ -88,15 +161,79 @@ func (s *Service) GetUserWatchList(user int64) ([]*watchazon.Product, error) {
 	return products, nil
 }
 
-func (s *Service) RemoveFromWatchList(link string, userID int64) error {
-	return s.database.RemoveFromWatchList(link, userID)
+func (s *Service) RemoveFromWatchList(ctx context.Context, link string, userID int64) error {
+	link, err := sanitizeURL(link)
+	if err != nil {
+		return ErrInvalidLink
+	}
+
+	return s.store.RemoveFromWatchList(ctx, link, userID)
+}
+
+// SetAlertRule changes which price changes of the product are notified to the user.
+func (s *Service) SetAlertRule(ctx context.Context, link string, userID int64, rule watchazon.AlertRule) error {
+	link, err := sanitizeURL(link)
+	if err != nil {
+		return ErrInvalidLink
+	}
+
+	switch rule.Kind {
+	case watchazon.AlertTargetPrice:
+		if rule.Target.Amount <= 0 {
+			return ErrInvalidRule
+		}
+	case watchazon.AlertPercentDrop:
+		if rule.Percent <= 0 || rule.Percent >= 100 {
+			return ErrInvalidRule
+		}
+	case watchazon.AlertAnyChange, watchazon.AlertAnyDecrease, watchazon.AlertBackInStock:
+	default:
+		return ErrInvalidRule
+	}
+
+	rec, err := s.store.Get(ctx, link)
+	if err != nil || !rec.Watched(userID) {
+		return ErrNotWatched
+	}
+
+	// Targets are entered without a currency, they are expressed in the one the product is sold in.
+	if rule.Kind == watchazon.AlertTargetPrice {
+		rule.Target = rule.Target.In(rec.Price.Currency)
+	}
+
+	if err := s.store.SetAlertRule(ctx, link, userID, rule); err != nil {
+		slog.Error("could not set alert rule", "link", link, "user_id", userID, "error", err)
+		return ErrInternal
+	}
+
+	return nil
+}
+
+// AlertRule returns the rule deciding which price changes of the product are notified to the user.
+func (s *Service) AlertRule(ctx context.Context, link string, userID int64) (watchazon.AlertRule, error) {
+	link, err := sanitizeURL(link)
+	if err != nil {
+		return watchazon.AlertRule{}, ErrInvalidLink
+	}
+
+	rec, err := s.store.Get(ctx, link)
+	if err != nil || !rec.Watched(userID) {
+		return watchazon.AlertRule{}, ErrNotWatched
+	}
+
+	return rec.Rule(userID), nil
+}
+
+// ClearAlertRule restores the default rule, notifying the user of any price change of the product.
+func (s *Service) ClearAlertRule(ctx context.Context, link string, userID int64) error {
+	return s.SetAlertRule(ctx, link, userID, watchazon.AlertRule{Kind: watchazon.AlertAnyChange})
 }
 
-func (s *Service) Search(query string, domain watchazon.Domain) ([]*watchazon.Product, error) {
+func (s *Service) Search(ctx context.Context, query string, domain watchazon.Domain) ([]*watchazon.Product, error) {
 	if query == "" {
 		return nil, errors.New("empty query")
 	}
-	products, err := s.scraper.Search(query, domain)
+	products, err := s.scraper.Search(ctx, query, domain)
 	if err != nil {
 		return nil, err
 	}
@@ -108,57 +245,359 @@ func (s *Service) Search(query string, domain watchazon.Domain) ([]*watchazon.Pr
 	return products, nil
 }
 
-func (s *Service) Update() error {
-	products, err := s.database.GetAll()
+// update scrapes a stored product, saving and notifying its changes.
+// When the product can't be scraped, only the reason is saved.
+func (s *Service) update(ctx context.Context, p *watchazon.Record) {
+	start := time.Now()
+
+	scraped, err := s.scraper.Scrape(ctx, p.Link)
+	if err != nil {
+		// Checks canceled by a shutdown didn't fail, and are done again at the next run.
+		if ctx.Err() != nil {
+			return
+		}
+		s.recordFailure(ctx, p, err)
+		s.checks.failure(time.Now(), err)
+		checkDuration.WithLabelValues("failed").Observe(time.Since(start).Seconds())
+		return
+	}
+	defer func() {
+		checkDuration.WithLabelValues("ok").Observe(time.Since(start).Seconds())
+	}()
+
+	scraped.CheckedAt = time.Now()
+	s.checks.success(scraped.CheckedAt)
+	scraped.NextCheckAt = s.nextCheck(ctx, scraped, len(p.Users), scraped.CheckedAt)
+	err = s.store.Update(ctx, scraped, 0)
+	if errors.Is(err, watchazon.ErrNotFound) {
+		return
+	}
+	if err != nil {
+		s.retryLater(p.Link, "could not save checked product", err)
+		return
+	}
+	s.recordPrice(ctx, scraped)
+	s.schedule.add(scraped.Link, scraped.NextCheckAt)
+
+	s.notifyWatchers(ctx, p, scraped)
+}
+
+// PriceHistory returns the prices recorded for a product since the given time, oldest first.
+func (s *Service) PriceHistory(ctx context.Context, link string, since time.Time) ([]watchazon.PricePoint, error) {
+	link, err := sanitizeURL(link)
+	if err != nil {
+		return nil, ErrInvalidLink
+	}
+
+	points, err := s.store.PriceHistory(ctx, link, since, time.Time{})
+	if err != nil {
+		slog.Error("could not get price history", "link", link, "error", err)
+		return nil, ErrInternal
+	}
+
+	return points, nil
+}
+
+// Settings returns the notification settings of the user, the default ones if they were never changed.
+func (s *Service) Settings(ctx context.Context, userID int64) (*watchazon.User, error) {
+	u, err := s.store.GetUser(ctx, userID)
+	if errors.Is(err, watchazon.ErrNotFound) {
+		return &watchazon.User{ID: userID}, nil
+	}
+	if err != nil {
+		slog.Error("could not get settings", "user_id", userID, "error", err)
+		return nil, ErrInternal
+	}
+
+	return u, nil
+}
+
+// SetEmail changes the address the email notifications of the user are sent to.
+// An empty address disables email notifications.
+func (s *Service) SetEmail(ctx context.Context, userID int64, address string) error {
+	if address != "" {
+		parsed, err := mail.ParseAddress(address)
+		if err != nil {
+			return ErrInvalidEmail
+		}
+		address = parsed.Address
+	}
+
+	u, err := s.Settings(ctx, userID)
 	if err != nil {
 		return err
 	}
 
-	var wg sync.WaitGroup
-	wg.Add(len(products))
+	u.Email = address
+	if address == "" {
+		u.Channels = without(u.NotificationChannels(), watchazon.ChannelEmail)
+	}
 
-	for _, p := range products {
-		go func(p *database.Record) {
-			defer wg.Done()
+	return s.saveSettings(ctx, u)
+}
 
-			scraped, err := s.scraper.Scrape(p.Link)
-			if err != nil {
-				return
-			}
+// SetWebhook changes the URL the webhook notifications of the user are posted to.
+// An empty URL restores the global webhook.
+func (s *Service) SetWebhook(ctx context.Context, userID int64, webhook string) error {
+	if webhook != "" {
+		u, err := url.Parse(webhook)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return ErrInvalidWebhook
+		}
+	}
 
-			scraped.CheckedAt = time.Now()
-			err = s.database.Update(scraped, 0)
-			if err != nil {
-				return
-			}
+	u, err := s.Settings(ctx, userID)
+	if err != nil {
+		return err
+	}
 
-			if p.Price == scraped.Price {
-				return
-			}
+	u.Webhook = webhook
+	return s.saveSettings(ctx, u)
+}
 
-			for _, u := range p.Users {
-				s.notify(scraped, u)
-			}
+// NewAPIToken returns a new token to access the API as the user, replacing the previous one.
+// Only the hash of the token is stored, so it can't be shown again.
+func (s *Service) NewAPIToken(ctx context.Context, userID int64) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		slog.Error("could not generate api token", "user_id", userID, "error", err)
+		return "", ErrInternal
+	}
+	token := hex.EncodeToString(b)
+
+	u, err := s.Settings(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+
+	u.APIToken = hashToken(token)
+	if err := s.saveSettings(ctx, u); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
 
-		}(p)
+// Authenticate returns the user the API token belongs to.
+func (s *Service) Authenticate(ctx context.Context, token string) (int64, error) {
+	if token == "" {
+		return 0, ErrUnauthorized
 	}
 
-	wg.Wait()
+	u, err := s.store.GetUserByAPIToken(ctx, hashToken(token))
+	if errors.Is(err, watchazon.ErrNotFound) {
+		return 0, ErrUnauthorized
+	}
+	if err != nil {
+		slog.Error("could not authenticate api token", "error", err)
+		return 0, ErrInternal
+	}
+
+	return u.ID, nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// SetChannels changes the channels the user receives notifications through, restoring the default ones if empty.
+func (s *Service) SetChannels(ctx context.Context, userID int64, chosen []string) error {
+	u, err := s.Settings(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	u.Channels = nil
+	for _, c := range chosen {
+		c = strings.ToLower(c)
+		if !channels[c] {
+			return ErrInvalidChannel
+		}
+		if c == watchazon.ChannelEmail && u.Email == "" {
+			return ErrNoEmail
+		}
+		if !contains(u.Channels, c) {
+			u.Channels = append(u.Channels, c)
+		}
+	}
+
+	return s.saveSettings(ctx, u)
+}
+
+func (s *Service) saveSettings(ctx context.Context, u *watchazon.User) error {
+	if err := s.store.SaveUser(ctx, u); err != nil {
+		slog.Error("could not save settings", "user_id", u.ID, "error", err)
+		return ErrInternal
+	}
 
 	return nil
 }
 
-func (s *Service) Listen() <-chan *watchazon.Notification {
+// recordFailure saves on the product why it couldn't be scraped, leaving everything else as it was,
+// and schedules its next check further away.
+func (s *Service) recordFailure(ctx context.Context, rec *watchazon.Record, err error) {
+	failed := *rec.Product
+	failed.Failure = err.Error()
+	failed.FailedChecks++
+	failed.NextCheckAt = s.nextCheck(ctx, &failed, len(rec.Users), time.Now())
+	if err := s.store.Update(ctx, &failed, 0); errors.Is(err, watchazon.ErrNotFound) {
+		return
+	} else if err != nil {
+		s.retryLater(rec.Link, "could not record failure", err)
+		return
+	}
+	s.schedule.add(rec.Link, failed.NextCheckAt)
+}
+
+// recordPrice appends the scraped price to the product history, dropping the points older than historyRetention.
+// Products without a price are out of stock and aren't recorded.
+func (s *Service) recordPrice(ctx context.Context, product *watchazon.Product) {
+	if product.Price.IsZero() {
+		return
+	}
+
+	err := s.store.AppendPrice(ctx, product.Link, watchazon.PricePoint{
+		Price:     product.Price,
+		CheckedAt: product.CheckedAt,
+	})
+	if err != nil {
+		slog.Error("could not record price", "link", product.Link, "error", err)
+		return
+	}
+
+	err = s.store.TrimHistory(ctx, product.Link, product.CheckedAt.Add(-historyRetention))
+	if err != nil {
+		slog.Error("could not trim price history", "link", product.Link, "error", err)
+	}
+}
+
+// Listen starts delivering the notifications in the outbox, including the ones left undelivered by a previous run.
+// The channel is closed once ctx is done: the notifications not received yet stay in the outbox for the next run.
+func (s *Service) Listen(ctx context.Context) <-chan *watchazon.Notification {
+	s.dispatchOnce.Do(func() {
+		go s.dispatch(ctx)
+	})
+
 	return s.notifications
 }
 
-func (s *Service) notify(product *watchazon.Product, userID int64) {
-	s.notifications <- &watchazon.Notification{
-		Product: product,
-		UserID:  userID,
+// Ack removes a delivered notification from the outbox, or schedules it to be delivered again if err isn't nil.
+func (s *Service) Ack(ctx context.Context, n *watchazon.Notification, err error) {
+	if err != nil {
+		n.Attempts++
+		if n.Attempts < maxAttempts {
+			n.DueAt = time.Now().Add(retryBackoff << (n.Attempts - 1))
+			if err := s.store.SaveNotification(ctx, n); err != nil {
+				slog.Error("could not reschedule notification", "notification_id", n.ID, "user_id", n.UserID, "error", err)
+			}
+			return
+		}
+
+		slog.Warn("dropping notification", "notification_id", n.ID, "user_id", n.UserID, "attempts", n.Attempts, "error", err)
+	}
+
+	if err := s.store.DeleteNotification(ctx, n.ID); err != nil {
+		slog.Error("could not delete notification", "notification_id", n.ID, "user_id", n.UserID, "error", err)
+	}
+}
+
+// dispatch sends the notifications of the outbox to the listener as they become due.
+func (s *Service) dispatch(ctx context.Context) {
+	defer close(s.notifications)
+
+	ticker := time.NewTicker(dispatchInterval)
+	defer ticker.Stop()
+
+	for {
+		s.dispatchPending(ctx)
+
+		select {
+		case <-s.wake:
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// dispatchPending sends the due notifications, leasing each of them for ackTimeout from when it's sent:
+// if it's not acknowledged by then it's sent again.
+func (s *Service) dispatchPending(ctx context.Context) {
+	pending, err := s.store.PendingNotifications(ctx, time.Now())
+	if err != nil {
+		slog.Error("could not get pending notifications", "error", err)
+		return
+	}
+
+	for _, n := range pending {
+		// Sending waits for the listener to deliver the previous notifications, so the lease can't start with the pass.
+		n.DueAt = time.Now().Add(ackTimeout)
+		if err := s.store.SaveNotification(ctx, n); err != nil {
+			slog.Error("could not lease notification", "notification_id", n.ID, "error", err)
+			continue
+		}
+
+		select {
+		case s.notifications <- n:
+		case <-ctx.Done():
+			// Give back the lease, so that the notification is delivered as soon as the service runs again.
+			n.DueAt = time.Now()
+			if err := s.store.SaveNotification(context.Background(), n); err != nil {
+				slog.Error("could not release notification", "notification_id", n.ID, "error", err)
+			}
+			return
+		}
+	}
+}
+
+// notifyWatchers notifies the users watching rec whose alert rule matches the scraped product.
+func (s *Service) notifyWatchers(ctx context.Context, rec *watchazon.Record, scraped *watchazon.Product) {
+	for _, u := range rec.Users {
+		if rec.Rule(u).Matches(rec.Product, scraped) {
+			s.notify(ctx, rec.Product, scraped, u)
+		}
+	}
+}
+
+// notify adds a notification to the outbox, waking up the dispatcher.
+func (s *Service) notify(ctx context.Context, previous, product *watchazon.Product, userID int64) {
+	n := &watchazon.Notification{
+		Product:  product,
+		Previous: previous,
+		UserID:   userID,
+	}
+	if err := s.store.EnqueueNotification(ctx, n); err != nil {
+		slog.Error("could not enqueue notification", "link", product.Link, "user_id", userID, "error", err)
+		return
+	}
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
 	}
 }
 
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+// without returns the elements of list other than s.
+func without(list []string, s string) []string {
+	var res []string
+	for _, e := range list {
+		if e != s {
+			res = append(res, e)
+		}
+	}
+	return res
+}
+
 func sanitizeURL(link string) (string, error) {
 	u, err := url.Parse(link)
 	if err != nil {
@@ -169,18 +608,27 @@ func sanitizeURL(link string) (string, error) {
 	splitPath := strings.Split(u.Path, "/")
 	for i, p := range splitPath {
 		if p == "dp" || p == "product" {
-			productID = splitPath[i+1]
+			if i+1 < len(splitPath) {
+				productID = splitPath[i+1]
+			}
 			break
 		} else if p == "gp" {
-			// TODO panics if u.Query()["url"] has len 0
-			return sanitizeURL(fmt.Sprintf("%s://%s/%s", u.Scheme, u.Host, u.Query()["url"][0]))
+			// Redirects carry the path of the product in their url parameter, the other links have it in the path,
+			// as in /gp/product/<ASIN>.
+			if target := u.Query().Get("url"); target != "" {
+				return sanitizeURL(fmt.Sprintf("%s://%s/%s", u.Scheme, u.Host, target))
+			}
 		}
 	}
 
 	if productID == "" {
-		return "", errors.New("could not find productID")
+		return "", ErrInvalidLink
+	}
+
+	market, err := watchazon.MarketplaceOf(link)
+	if err != nil {
+		return "", err
 	}
 
-	s := fmt.Sprintf("%s://%s/dp/%s", u.Scheme, u.Host, productID)
-	return s, nil
+	return market.URL("/dp/" + productID), nil
 }
@@ -1,6 +1,18 @@
 package service
 
-import "testing"
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/giornetta/watchazon"
+	"github.com/giornetta/watchazon/memory"
+	"github.com/giornetta/watchazon/scraper"
+)
 
 func TestSanitizeURL(t *testing.T) {
 	tests := []struct {
@@ -15,6 +27,38 @@ func TestSanitizeURL(t *testing.T) {
 			want:    "https://www.amazon.it/dp/B071S3PX1Q",
 			wantErr: false,
 		},
+		{
+			name:    "Second-level domain",
+			arg:     "https://amazon.co.uk/Echo-Dot-3rd-Gen-Charcoal/dp/B07PJV3JPR/ref=sr_1_1?keywords=echo+dot",
+			want:    "https://www.amazon.co.uk/dp/B07PJV3JPR",
+			wantErr: false,
+		},
+		{
+			name:    "GP product",
+			arg:     "https://www.amazon.it/gp/product/B07PHPXHQS?psc=1",
+			want:    "https://www.amazon.it/dp/B07PHPXHQS",
+			wantErr: false,
+		},
+		{
+			name:    "Path ending in dp",
+			arg:     "https://www.amazon.it/dp",
+			wantErr: true,
+		},
+		{
+			name:    "Path ending in product",
+			arg:     "https://www.amazon.it/gp/product",
+			wantErr: true,
+		},
+		{
+			name:    "GP without url",
+			arg:     "https://www.amazon.it/gp/slredirect/picassoRedirect.html",
+			wantErr: true,
+		},
+		{
+			name:    "Unknown marketplace",
+			arg:     "https://www.amazon.xyz/dp/B07PJV3JPR",
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -29,3 +73,263 @@ func TestSanitizeURL(t *testing.T) {
 		})
 	}
 }
+
+func TestService_SetAlertRule(t *testing.T) {
+	store := memory.New()
+	svc := New(scraper.New(), store, 1)
+
+	link := "https://www.amazon.it/dp/B07PHPXHQS"
+	if err := store.Insert(context.Background(), &watchazon.Product{Link: link, Price: watchazon.Money{Amount: 5999, Currency: "EUR"}}, 1); err != nil {
+		t.Fatalf("could not insert product: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		link    string
+		userID  int64
+		rule    watchazon.AlertRule
+		wantErr error
+	}{
+		{"Target", link, 1, watchazon.AlertRule{Kind: watchazon.AlertTargetPrice, Target: watchazon.Money{Amount: 4999}}, nil},
+		{"Invalid target", link, 1, watchazon.AlertRule{Kind: watchazon.AlertTargetPrice}, ErrInvalidRule},
+		{"Invalid percent", link, 1, watchazon.AlertRule{Kind: watchazon.AlertPercentDrop, Percent: 100}, ErrInvalidRule},
+		{"Not watched", link, 2, watchazon.AlertRule{Kind: watchazon.AlertAnyDecrease}, ErrNotWatched},
+		{"Invalid link", "https://www.amazon.it/", 1, watchazon.AlertRule{Kind: watchazon.AlertAnyDecrease}, ErrInvalidLink},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := svc.SetAlertRule(context.Background(), tt.link, tt.userID, tt.rule)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("SetAlertRule() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	rec, err := store.Get(context.Background(), link)
+	if err != nil {
+		t.Fatalf("could not get product: %v", err)
+	}
+	if got := rec.Rule(1); got.Kind != watchazon.AlertTargetPrice || got.Target != (watchazon.Money{Amount: 4999, Currency: "EUR"}) {
+		t.Errorf("Rule(1) got = %+v, want target 49.99", got)
+	}
+
+	// The link is sanitized as when watching the product.
+	got, err := svc.AlertRule(context.Background(), "https://amazon.it/Echo-Dot/dp/B07PHPXHQS/ref=sr_1_1?th=1", 1)
+	if err != nil || got.Kind != watchazon.AlertTargetPrice {
+		t.Errorf("AlertRule() with a long link got = %+v, %v, want the target rule", got, err)
+	}
+	if _, err := svc.AlertRule(context.Background(), "https://www.amazon.it/dp", 1); !errors.Is(err, ErrInvalidLink) {
+		t.Errorf("AlertRule() with an invalid link error = %v, want %v", err, ErrInvalidLink)
+	}
+}
+
+// captchaTransport answers every request with the robot check page of Amazon.
+type captchaTransport struct{}
+
+func (captchaTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	page := `<html><body><form method="get" action="/errors/validateCaptcha"></form></body></html>`
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"text/html"}},
+		Body:       io.NopCloser(strings.NewReader(page)),
+		Request:    req,
+	}, nil
+}
+
+func TestService_PriceHistory(t *testing.T) {
+	store := memory.New()
+	svc := New(scraper.New(), store, 1)
+
+	link := "https://www.amazon.it/dp/B07PHPXHQS"
+	price := watchazon.Money{Amount: 5999, Currency: "EUR"}
+	if err := store.Insert(context.Background(), &watchazon.Product{Link: link, Price: price}, 1); err != nil {
+		t.Fatalf("could not insert product: %v", err)
+	}
+	if err := store.AppendPrice(context.Background(), link, watchazon.PricePoint{Price: price, CheckedAt: time.Now()}); err != nil {
+		t.Fatalf("could not append price: %v", err)
+	}
+
+	// The link is sanitized as when watching the product.
+	points, err := svc.PriceHistory(context.Background(), "https://www.amazon.it/gp/product/B07PHPXHQS?psc=1", time.Time{})
+	if err != nil || len(points) != 1 {
+		t.Errorf("PriceHistory() with a long link got = %v, %v, want one point", points, err)
+	}
+	if _, err := svc.PriceHistory(context.Background(), "https://www.amazon.it/dp", time.Time{}); !errors.Is(err, ErrInvalidLink) {
+		t.Errorf("PriceHistory() with an invalid link error = %v, want %v", err, ErrInvalidLink)
+	}
+}
+
+func TestService_update_Captcha(t *testing.T) {
+	sc := scraper.New()
+	sc.Transport = captchaTransport{}
+	sc.Delay, sc.RandomDelay, sc.Retries = 0, 0, 0
+
+	store := memory.New()
+	svc := New(sc, store, 1)
+
+	link := "https://www.amazon.it/dp/B07PHPXHQS"
+	price := watchazon.Money{Amount: 5999, Currency: "EUR"}
+	if err := store.Insert(context.Background(), &watchazon.Product{Title: "Echo Dot", Link: link, Price: price}, 1); err != nil {
+		t.Fatalf("could not insert product: %v", err)
+	}
+
+	rec, err := store.Get(context.Background(), link)
+	if err != nil {
+		t.Fatalf("could not get product: %v", err)
+	}
+	svc.update(context.Background(), rec)
+
+	rec, err = store.Get(context.Background(), link)
+	if err != nil {
+		t.Fatalf("could not get product: %v", err)
+	}
+	if rec.Title != "Echo Dot" || rec.Price != price {
+		t.Errorf("update() overwrote the product with %+v", rec.Product)
+	}
+	if rec.Failure != scraper.ErrCaptcha.Error() {
+		t.Errorf("update() recorded failure %q, want %q", rec.Failure, scraper.ErrCaptcha)
+	}
+	if rec.FailedChecks != 1 || time.Until(rec.NextCheckAt) <= DefaultIntervals.Base {
+		t.Errorf("update() recorded %d failed checks, next at %v, want 1 and a longer wait", rec.FailedChecks, rec.NextCheckAt)
+	}
+
+	history, err := store.PriceHistory(context.Background(), link, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("could not get history: %v", err)
+	}
+	if len(history) != 0 {
+		t.Errorf("update() recorded prices %v, want none", history)
+	}
+
+	if pending, _ := store.PendingNotifications(context.Background(), time.Now()); len(pending) != 0 {
+		t.Errorf("update() enqueued notifications %v, want none", pending)
+	}
+}
+
+func TestService_Listen(t *testing.T) {
+	store := memory.New()
+	product := &watchazon.Product{Link: "https://www.amazon.it/dp/B07PHPXHQS", Price: watchazon.Money{Amount: 4999, Currency: "EUR"}}
+
+	// Notifications enqueued before anyone listens, as those left by a previous run, are delivered too.
+	New(scraper.New(), store, 1).notify(context.Background(), nil, product, 1)
+
+	svc := New(scraper.New(), store, 1)
+	n := receive(t, svc.Listen(context.Background()))
+	if n.UserID != 1 || n.Product.Link != product.Link {
+		t.Fatalf("Listen() got = %+v, want a notification for 1 on %s", n, product.Link)
+	}
+
+	svc.Ack(context.Background(), n, errors.New("telegram is down"))
+	pending, err := store.PendingNotifications(context.Background(), time.Now().Add(retryBackoff))
+	if err != nil {
+		t.Fatalf("could not get pending notifications: %v", err)
+	}
+	if len(pending) != 1 || pending[0].Attempts != 1 {
+		t.Errorf("PendingNotifications() after a failure got = %v, want one retry", pending)
+	}
+
+	// The second notification is left unacknowledged.
+	svc.notify(context.Background(), nil, product, 2)
+	if second := receive(t, svc.Listen(context.Background())); second.UserID != 2 {
+		t.Fatalf("Listen() got = %+v, want a notification for 2", second)
+	}
+	svc.Ack(context.Background(), n, nil)
+
+	pending, err = store.PendingNotifications(context.Background(), time.Now().Add(24*time.Hour))
+	if err != nil {
+		t.Fatalf("could not get pending notifications: %v", err)
+	}
+	if len(pending) != 1 || pending[0].UserID != 2 {
+		t.Errorf("PendingNotifications() after the acknowledgement got = %v, want only the one for 2", pending)
+	}
+}
+
+func TestService_Listen_Shutdown(t *testing.T) {
+	svc := New(scraper.New(), memory.New(), 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := svc.Listen(ctx)
+	cancel()
+
+	select {
+	case _, ok := <-ch:
+		if ok {
+			t.Error("Listen() sent a notification, want none")
+		}
+	case <-time.After(time.Second):
+		t.Error("Listen() didn't close the channel after the shutdown")
+	}
+}
+
+func receive(t *testing.T, ch <-chan *watchazon.Notification) *watchazon.Notification {
+	t.Helper()
+
+	select {
+	case n := <-ch:
+		return n
+	case <-time.After(time.Second):
+		t.Fatal("no notification received")
+		return nil
+	}
+}
+
+func TestService_SetChannels(t *testing.T) {
+	svc := New(scraper.New(), memory.New(), 1)
+
+	if err := svc.SetChannels(context.Background(), 1, []string{watchazon.ChannelEmail}); !errors.Is(err, ErrNoEmail) {
+		t.Errorf("SetChannels() without an email error = %v, want %v", err, ErrNoEmail)
+	}
+	if err := svc.SetEmail(context.Background(), 1, "not an email"); !errors.Is(err, ErrInvalidEmail) {
+		t.Errorf("SetEmail() error = %v, want %v", err, ErrInvalidEmail)
+	}
+	if err := svc.SetEmail(context.Background(), 1, "User <user@example.com>"); err != nil {
+		t.Fatalf("SetEmail() error = %v", err)
+	}
+	if err := svc.SetChannels(context.Background(), 1, []string{"Telegram", "email", "email"}); err != nil {
+		t.Fatalf("SetChannels() error = %v", err)
+	}
+	if err := svc.SetWebhook(context.Background(), 1, "ftp://example.com"); !errors.Is(err, ErrInvalidWebhook) {
+		t.Errorf("SetWebhook() error = %v, want %v", err, ErrInvalidWebhook)
+	}
+	if err := svc.SetChannels(context.Background(), 1, []string{"pigeon"}); !errors.Is(err, ErrInvalidChannel) {
+		t.Errorf("SetChannels() error = %v, want %v", err, ErrInvalidChannel)
+	}
+
+	u, err := svc.Settings(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("Settings() error = %v", err)
+	}
+	if u.Email != "user@example.com" || strings.Join(u.Channels, ",") != "telegram,email" {
+		t.Errorf("Settings() got = %+v, want telegram and email to user@example.com", u)
+	}
+
+	// Removing the address disables the email channel.
+	if err := svc.SetEmail(context.Background(), 1, ""); err != nil {
+		t.Fatalf("SetEmail() error = %v", err)
+	}
+	if u, _ := svc.Settings(context.Background(), 1); strings.Join(u.NotificationChannels(), ",") != "telegram" {
+		t.Errorf("NotificationChannels() after removing the email got = %v, want [telegram]", u.NotificationChannels())
+	}
+}
+
+func TestService_Authenticate(t *testing.T) {
+	svc := New(scraper.New(), memory.New(), 1)
+
+	first, err := svc.NewAPIToken(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("NewAPIToken() error = %v", err)
+	}
+	second, err := svc.NewAPIToken(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("NewAPIToken() error = %v", err)
+	}
+
+	if id, err := svc.Authenticate(context.Background(), second); err != nil || id != 1 {
+		t.Errorf("Authenticate() = %d, %v, want 1", id, err)
+	}
+	for _, token := range []string{first, "", "invalid"} {
+		if _, err := svc.Authenticate(context.Background(), token); !errors.Is(err, ErrUnauthorized) {
+			t.Errorf("Authenticate(%q) error = %v, want %v", token, err, ErrUnauthorized)
+		}
+	}
+}
@@ -0,0 +1,553 @@
+// Package sqlite implements a watchazon.Store backed by a SQLite database,
+// so that the stored data can be inspected and queried with the usual SQL tools.
+// The driver needs cgo: in binaries built without it, Open fails while the other stores keep working.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/giornetta/watchazon"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// migrations contains the statements that bring the schema up to date, applied in order.
+// Statements must never be changed once released: append new ones instead.
+var migrations = []string{
+	`CREATE TABLE products (
+		link       TEXT PRIMARY KEY,
+		title      TEXT NOT NULL,
+		image      TEXT NOT NULL,
+		price      REAL NOT NULL,
+		checked_at TIMESTAMP NOT NULL
+	)`,
+	`CREATE TABLE watchers (
+		link         TEXT NOT NULL,
+		user_id      INTEGER NOT NULL,
+		rule_kind    INTEGER NOT NULL DEFAULT 0,
+		rule_target  REAL NOT NULL DEFAULT 0,
+		rule_percent REAL NOT NULL DEFAULT 0,
+		base_price   REAL NOT NULL DEFAULT 0,
+		PRIMARY KEY (link, user_id)
+	)`,
+	`CREATE INDEX watchers_user_id ON watchers (user_id)`,
+	`CREATE TABLE prices (
+		link       TEXT NOT NULL,
+		checked_at TIMESTAMP NOT NULL,
+		price      REAL NOT NULL,
+		PRIMARY KEY (link, checked_at)
+	)`,
+	`ALTER TABLE products ADD COLUMN availability INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE products ADD COLUMN stock_left INTEGER NOT NULL DEFAULT 0`,
+	// Prices are stored as integer minor units of their currency, the amounts of the rules are in the
+	// currency of the product. Only amazon.com used dollars when prices were REAL.
+	`ALTER TABLE products ADD COLUMN price_amount INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE products ADD COLUMN currency TEXT NOT NULL DEFAULT ''`,
+	`UPDATE products SET price_amount = CAST(ROUND(price * 100) AS INTEGER), currency = CASE WHEN link LIKE 'https://www.amazon.com/%' THEN 'USD' ELSE 'EUR' END`,
+	`ALTER TABLE products DROP COLUMN price`,
+	`ALTER TABLE watchers ADD COLUMN rule_target_amount INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE watchers ADD COLUMN base_price_amount INTEGER NOT NULL DEFAULT 0`,
+	`UPDATE watchers SET rule_target_amount = CAST(ROUND(rule_target * 100) AS INTEGER), base_price_amount = CAST(ROUND(base_price * 100) AS INTEGER)`,
+	`ALTER TABLE watchers DROP COLUMN rule_target`,
+	`ALTER TABLE watchers DROP COLUMN base_price`,
+	`ALTER TABLE prices ADD COLUMN price_amount INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE prices ADD COLUMN currency TEXT NOT NULL DEFAULT ''`,
+	`UPDATE prices SET price_amount = CAST(ROUND(price * 100) AS INTEGER), currency = CASE WHEN link LIKE 'https://www.amazon.com/%' THEN 'USD' ELSE 'EUR' END`,
+	`ALTER TABLE prices DROP COLUMN price`,
+	`ALTER TABLE products ADD COLUMN failure TEXT NOT NULL DEFAULT ''`,
+	// Products are JSON encoded snapshots, taken when the notification was enqueued.
+	`CREATE TABLE outbox (
+		id       INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id  INTEGER NOT NULL,
+		product  TEXT NOT NULL,
+		previous TEXT,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		due_at   TIMESTAMP NOT NULL
+	)`,
+	// Channels are comma separated.
+	`CREATE TABLE users (
+		id       INTEGER PRIMARY KEY,
+		channels TEXT NOT NULL DEFAULT '',
+		email    TEXT NOT NULL DEFAULT ''
+	)`,
+	`ALTER TABLE users ADD COLUMN webhook TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE users ADD COLUMN api_token TEXT NOT NULL DEFAULT ''`,
+	`CREATE UNIQUE INDEX users_api_token ON users (api_token) WHERE api_token != ''`,
+	`ALTER TABLE products ADD COLUMN failed_checks INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE products ADD COLUMN next_check_at TIMESTAMP NOT NULL DEFAULT '0001-01-01 00:00:00+00:00'`,
+	// Ping writes its only row.
+	`CREATE TABLE health (
+		id         INTEGER PRIMARY KEY CHECK (id = 1),
+		checked_at TIMESTAMP NOT NULL
+	)`,
+	// Delivered channels are comma separated.
+	`ALTER TABLE outbox ADD COLUMN delivered TEXT NOT NULL DEFAULT ''`,
+}
+
+// Store is the SQLite implementation of watchazon.Store.
+type Store struct {
+	db *sql.DB
+}
+
+var _ watchazon.Store = (*Store)(nil)
+
+// Open opens the SQLite database at path, creating it if needed, and migrates its schema.
+func Open(path string) (*Store, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite doesn't allow concurrent writers, serializing the connections avoids "database is locked" errors.
+	db.SetMaxOpenConns(1)
+
+	s := &Store{
+		db: db,
+	}
+	if err := s.migrate(); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *Store) migrate() error {
+	_, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)`)
+	if err != nil {
+		return err
+	}
+
+	var version int
+	err = s.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+	if err != nil {
+		return err
+	}
+
+	for i := version; i < len(migrations); i++ {
+		err := s.inTx(context.Background(), func(tx *sql.Tx) error {
+			if _, err := tx.Exec(migrations[i]); err != nil {
+				return err
+			}
+
+			_, err := tx.Exec(`INSERT INTO schema_migrations (version) VALUES (?)`, i+1)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Ping writes the time of the check, which fails if the database is closed or can't be written.
+func (s *Store) Ping(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, `INSERT OR REPLACE INTO health (id, checked_at) VALUES (1, ?)`, time.Now().UTC())
+	return err
+}
+
+func (s *Store) Get(ctx context.Context, link string) (*watchazon.Record, error) {
+	var r *watchazon.Record
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		r, err = getRecord(ctx, tx, link)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (s *Store) GetAll(ctx context.Context) ([]*watchazon.Record, error) {
+	var records []*watchazon.Record
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		records, err = queryRecords(ctx, tx, `SELECT link FROM products ORDER BY link`)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+func (s *Store) Insert(ctx context.Context, product *watchazon.Product, userID int64) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		// The conflict is reported by the rows affected, as the errors of the driver depend on cgo.
+		res, err := tx.ExecContext(ctx, `INSERT INTO products (link, title, image, price_amount, currency, availability, stock_left, checked_at, failure, failed_checks, next_check_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT (link) DO NOTHING`,
+			product.Link, product.Title, product.Image, product.Price.Amount, product.Price.Currency, product.Availability, product.StockLeft, product.CheckedAt.UTC(), product.Failure, product.FailedChecks, product.NextCheckAt.UTC())
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return watchazon.ErrAlreadyExists
+		}
+
+		return subscribe(ctx, tx, product.Link, userID, product.Price)
+	})
+}
+
+func (s *Store) Update(ctx context.Context, product *watchazon.Product, userID int64) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `UPDATE products SET title = ?, image = ?, price_amount = ?, currency = ?, availability = ?, stock_left = ?, checked_at = ?, failure = ?, failed_checks = ?, next_check_at = ? WHERE link = ?`,
+			product.Title, product.Image, product.Price.Amount, product.Price.Currency, product.Availability, product.StockLeft, product.CheckedAt.UTC(), product.Failure, product.FailedChecks, product.NextCheckAt.UTC(), product.Link)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return watchazon.ErrNotFound
+		}
+
+		if userID == 0 {
+			return nil
+		}
+		return subscribe(ctx, tx, product.Link, userID, product.Price)
+	})
+}
+
+func (s *Store) GetUserWatchList(ctx context.Context, userID int64) ([]*watchazon.Record, error) {
+	var records []*watchazon.Record
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		records, err = queryRecords(ctx, tx, `SELECT link FROM watchers WHERE user_id = ? ORDER BY link`, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+func (s *Store) RemoveFromWatchList(ctx context.Context, link string, userID int64) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `DELETE FROM watchers WHERE link = ? AND user_id = ?`, link, userID)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return watchazon.ErrNotFound
+		}
+
+		var watchers int
+		if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM watchers WHERE link = ?`, link).Scan(&watchers); err != nil {
+			return err
+		}
+		if watchers > 0 {
+			return nil
+		}
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM prices WHERE link = ?`, link); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `DELETE FROM products WHERE link = ?`, link)
+		return err
+	})
+}
+
+func (s *Store) SetAlertRule(ctx context.Context, link string, userID int64, rule watchazon.AlertRule) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		r, err := getRecord(ctx, tx, link)
+		if err != nil {
+			return err
+		}
+		if !r.Watched(userID) {
+			return watchazon.ErrNotFound
+		}
+		r.SetRule(userID, rule)
+
+		rule = r.Rule(userID)
+		_, err = tx.ExecContext(ctx, `UPDATE watchers SET rule_kind = ?, rule_target_amount = ?, rule_percent = ?, base_price_amount = ? WHERE link = ? AND user_id = ?`,
+			rule.Kind, rule.Target.Amount, rule.Percent, rule.BasePrice.Amount, link, userID)
+		return err
+	})
+}
+
+func (s *Store) AppendPrice(ctx context.Context, link string, point watchazon.PricePoint) error {
+	_, err := s.db.ExecContext(ctx, `INSERT OR REPLACE INTO prices (link, checked_at, price_amount, currency) VALUES (?, ?, ?, ?)`,
+		link, point.CheckedAt.UTC(), point.Price.Amount, point.Price.Currency)
+	return err
+}
+
+func (s *Store) PriceHistory(ctx context.Context, link string, from, to time.Time) ([]watchazon.PricePoint, error) {
+	query := `SELECT checked_at, price_amount, currency FROM prices WHERE link = ?`
+	args := []interface{}{link}
+	if !from.IsZero() {
+		query += ` AND checked_at >= ?`
+		args = append(args, from.UTC())
+	}
+	if !to.IsZero() {
+		query += ` AND checked_at < ?`
+		args = append(args, to.UTC())
+	}
+	query += ` ORDER BY checked_at`
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	points := make([]watchazon.PricePoint, 0)
+	for rows.Next() {
+		var p watchazon.PricePoint
+		if err := rows.Scan(&p.CheckedAt, &p.Price.Amount, &p.Price.Currency); err != nil {
+			return nil, err
+		}
+		p.CheckedAt = p.CheckedAt.Local()
+		points = append(points, p)
+	}
+
+	return points, rows.Err()
+}
+
+func (s *Store) TrimHistory(ctx context.Context, link string, before time.Time) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM prices WHERE link = ? AND checked_at < ?`, link, before.UTC())
+	return err
+}
+
+func (s *Store) EnqueueNotification(ctx context.Context, n *watchazon.Notification) error {
+	product, err := json.Marshal(n.Product)
+	if err != nil {
+		return err
+	}
+	var previous []byte
+	if n.Previous != nil {
+		if previous, err = json.Marshal(n.Previous); err != nil {
+			return err
+		}
+	}
+
+	res, err := s.db.ExecContext(ctx, `INSERT INTO outbox (user_id, product, previous, attempts, due_at, delivered) VALUES (?, ?, ?, ?, ?, ?)`,
+		n.UserID, string(product), nullString(previous), n.Attempts, n.DueAt.UTC(), strings.Join(n.Delivered, ","))
+	if err != nil {
+		return err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	n.ID = uint64(id)
+
+	return nil
+}
+
+func (s *Store) PendingNotifications(ctx context.Context, by time.Time) ([]*watchazon.Notification, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, user_id, product, previous, attempts, due_at, delivered FROM outbox WHERE due_at <= ? ORDER BY id`, by.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pending := make([]*watchazon.Notification, 0)
+	for rows.Next() {
+		var (
+			n         watchazon.Notification
+			product   string
+			previous  sql.NullString
+			delivered string
+		)
+		if err := rows.Scan(&n.ID, &n.UserID, &product, &previous, &n.Attempts, &n.DueAt, &delivered); err != nil {
+			return nil, err
+		}
+		n.DueAt = n.DueAt.Local()
+		if delivered != "" {
+			n.Delivered = strings.Split(delivered, ",")
+		}
+
+		if err := json.Unmarshal([]byte(product), &n.Product); err != nil {
+			return nil, err
+		}
+		if previous.Valid {
+			if err := json.Unmarshal([]byte(previous.String), &n.Previous); err != nil {
+				return nil, err
+			}
+		}
+
+		pending = append(pending, &n)
+	}
+
+	return pending, rows.Err()
+}
+
+func (s *Store) SaveNotification(ctx context.Context, n *watchazon.Notification) error {
+	res, err := s.db.ExecContext(ctx, `UPDATE outbox SET attempts = ?, due_at = ?, delivered = ? WHERE id = ?`,
+		n.Attempts, n.DueAt.UTC(), strings.Join(n.Delivered, ","), n.ID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return watchazon.ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *Store) DeleteNotification(ctx context.Context, id uint64) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM outbox WHERE id = ?`, id)
+	return err
+}
+
+func (s *Store) GetUser(ctx context.Context, id int64) (*watchazon.User, error) {
+	return s.getUser(ctx, `SELECT id, channels, email, webhook, api_token FROM users WHERE id = ?`, id)
+}
+
+func (s *Store) GetUserByAPIToken(ctx context.Context, hash string) (*watchazon.User, error) {
+	// Users without a token have an empty one.
+	if hash == "" {
+		return nil, watchazon.ErrNotFound
+	}
+	return s.getUser(ctx, `SELECT id, channels, email, webhook, api_token FROM users WHERE api_token = ?`, hash)
+}
+
+func (s *Store) getUser(ctx context.Context, query string, args ...interface{}) (*watchazon.User, error) {
+	var channels string
+	u := &watchazon.User{}
+	err := s.db.QueryRowContext(ctx, query, args...).Scan(&u.ID, &channels, &u.Email, &u.Webhook, &u.APIToken)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, watchazon.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if channels != "" {
+		u.Channels = strings.Split(channels, ",")
+	}
+
+	return u, nil
+}
+
+func (s *Store) SaveUser(ctx context.Context, u *watchazon.User) error {
+	_, err := s.db.ExecContext(ctx, `INSERT OR REPLACE INTO users (id, channels, email, webhook, api_token) VALUES (?, ?, ?, ?, ?)`,
+		u.ID, strings.Join(u.Channels, ","), u.Email, u.Webhook, u.APIToken)
+	return err
+}
+
+func (s *Store) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// subscribe adds the user to the watchers of the product, unless it's already watching it.
+func subscribe(ctx context.Context, tx *sql.Tx, link string, userID int64, price watchazon.Money) error {
+	_, err := tx.ExecContext(ctx, `INSERT OR IGNORE INTO watchers (link, user_id, base_price_amount) VALUES (?, ?, ?)`, link, userID, price.Amount)
+	return err
+}
+
+// queryRecords reads the records whose links are returned by the given query.
+func queryRecords(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) ([]*watchazon.Record, error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	links := make([]string, 0)
+	for rows.Next() {
+		var link string
+		if err := rows.Scan(&link); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		links = append(links, link)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+
+	records := make([]*watchazon.Record, 0, len(links))
+	for _, l := range links {
+		r, err := getRecord(ctx, tx, l)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+
+	return records, nil
+}
+
+func getRecord(ctx context.Context, tx *sql.Tx, link string) (*watchazon.Record, error) {
+	p := &watchazon.Product{}
+	err := tx.QueryRowContext(ctx, `SELECT link, title, image, price_amount, currency, availability, stock_left, checked_at, failure, failed_checks, next_check_at FROM products WHERE link = ?`, link).
+		Scan(&p.Link, &p.Title, &p.Image, &p.Price.Amount, &p.Price.Currency, &p.Availability, &p.StockLeft, &p.CheckedAt, &p.Failure, &p.FailedChecks, &p.NextCheckAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, watchazon.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	p.CheckedAt, p.NextCheckAt = p.CheckedAt.Local(), p.NextCheckAt.Local()
+
+	rows, err := tx.QueryContext(ctx, `SELECT user_id, rule_kind, rule_target_amount, rule_percent, base_price_amount FROM watchers WHERE link = ? ORDER BY rowid`, link)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	r := &watchazon.Record{
+		Product: p,
+		Users:   make([]int64, 0),
+		Rules:   make(map[int64]watchazon.AlertRule),
+	}
+	for rows.Next() {
+		var (
+			userID       int64
+			rule         watchazon.AlertRule
+			target, base int64
+		)
+		if err := rows.Scan(&userID, &rule.Kind, &target, &rule.Percent, &base); err != nil {
+			return nil, err
+		}
+		rule.Target = productMoney(target, p)
+		rule.BasePrice = productMoney(base, p)
+
+		r.Users = append(r.Users, userID)
+		r.Rules[userID] = rule
+	}
+
+	return r, rows.Err()
+}
+
+// productMoney returns an amount in the currency of the product, or no amount at all if it's zero.
+func productMoney(amount int64, p *watchazon.Product) watchazon.Money {
+	if amount == 0 {
+		return watchazon.Money{}
+	}
+	return watchazon.Money{Amount: amount, Currency: p.Price.Currency}
+}
+
+// nullString returns b as a string, or NULL if it's nil.
+func nullString(b []byte) sql.NullString {
+	return sql.NullString{String: string(b), Valid: b != nil}
+}
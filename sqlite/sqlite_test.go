@@ -0,0 +1,90 @@
+//go:build cgo
+
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/giornetta/watchazon"
+	"github.com/giornetta/watchazon/storetest"
+)
+
+func TestStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) watchazon.Store {
+		s, err := Open(filepath.Join(t.TempDir(), "watchazon.db"))
+		if err != nil {
+			t.Fatalf("could not open database: %v", err)
+		}
+		t.Cleanup(func() { _ = s.Close() })
+
+		return s
+	})
+}
+
+func TestOpen_Reopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "watchazon.db")
+
+	for i := 0; i < 2; i++ {
+		s, err := Open(path)
+		if err != nil {
+			t.Fatalf("could not open database (attempt %d): %v", i+1, err)
+		}
+		_ = s.Close()
+	}
+}
+
+func TestOpen_MigrateMoney(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "watchazon.db")
+	link := "https://www.amazon.com/dp/B07GNGJK97"
+	ctx := context.Background()
+
+	// Set up the schema as it was when prices were REAL.
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("could not open database: %v", err)
+	}
+	statements := append([]string{`CREATE TABLE schema_migrations (version INTEGER PRIMARY KEY)`}, migrations[:6]...)
+	statements = append(statements,
+		`INSERT INTO schema_migrations (version) VALUES (6)`,
+		`INSERT INTO products (link, title, image, price, checked_at) VALUES ('`+link+`', 'Mi Band', '', 28.98, '2022-09-01 12:00:00')`,
+		`INSERT INTO watchers (link, user_id, rule_kind, rule_target, base_price) VALUES ('`+link+`', 1, 1, 24.99, 28.98)`,
+		`INSERT INTO prices (link, checked_at, price) VALUES ('`+link+`', '2022-09-01 12:00:00', 28.98)`,
+	)
+	for _, stmt := range statements {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("could not set up legacy schema: %v", err)
+		}
+	}
+	_ = db.Close()
+
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("could not migrate database: %v", err)
+	}
+	defer s.Close()
+
+	price := watchazon.Money{Amount: 2898, Currency: "USD"}
+	r, err := s.Get(ctx, link)
+	if err != nil {
+		t.Fatalf("could not get product: %v", err)
+	}
+	if r.Price != price {
+		t.Errorf("Get() got price = %v, want %v", r.Price, price)
+	}
+	want := watchazon.AlertRule{Kind: watchazon.AlertTargetPrice, Target: watchazon.Money{Amount: 2499, Currency: "USD"}, BasePrice: price}
+	if got := r.Rule(1); got != want {
+		t.Errorf("Rule(1) got = %+v, want %+v", got, want)
+	}
+
+	history, err := s.PriceHistory(ctx, link, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("could not get history: %v", err)
+	}
+	if len(history) != 1 || history[0].Price != price {
+		t.Errorf("PriceHistory() got = %v, want a point at %v", history, price)
+	}
+}
@@ -0,0 +1,113 @@
+package watchazon
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned by a Store when the requested product is not stored.
+	ErrNotFound = errors.New("not found")
+	// ErrAlreadyExists is returned by a Store when inserting a product that is already stored.
+	ErrAlreadyExists = errors.New("already exists")
+)
+
+// A Record is a Product stored along with the users watching it and their alert rules.
+type Record struct {
+	*Product
+	Users []int64
+	Rules map[int64]AlertRule
+}
+
+// Rule returns the alert rule the given user has set on the product.
+func (r *Record) Rule(userID int64) AlertRule {
+	return r.Rules[userID]
+}
+
+// Watched reports whether the given user is watching the product.
+func (r *Record) Watched(userID int64) bool {
+	for _, u := range r.Users {
+		if u == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// Subscribe adds the user to the watchers of the product, remembering its current price as base for the alert rule.
+// It reports whether the user was added.
+func (r *Record) Subscribe(userID int64) bool {
+	if r.Watched(userID) {
+		return false
+	}
+
+	r.Users = append(r.Users, userID)
+	if r.Rules == nil {
+		r.Rules = make(map[int64]AlertRule)
+	}
+	r.Rules[userID] = AlertRule{BasePrice: r.Price}
+
+	return true
+}
+
+// Unsubscribe removes the user from the watchers of the product.
+func (r *Record) Unsubscribe(userID int64) {
+	for i, u := range r.Users {
+		if u == userID {
+			r.Users = append(r.Users[:i], r.Users[i+1:]...)
+			break
+		}
+	}
+	delete(r.Rules, userID)
+}
+
+// SetRule replaces the alert rule of a user watching the product, keeping the base price of the subscription.
+func (r *Record) SetRule(userID int64, rule AlertRule) {
+	rule.BasePrice = r.Rules[userID].BasePrice
+	if rule.BasePrice.IsZero() {
+		rule.BasePrice = r.Price
+	}
+
+	if r.Rules == nil {
+		r.Rules = make(map[int64]AlertRule)
+	}
+	r.Rules[userID] = rule
+}
+
+// Store persists the watched products, the users watching them and their price history.
+// The context of each operation may cancel it, depending on the implementation.
+type Store interface {
+	Get(ctx context.Context, link string) (*Record, error)
+	GetAll(ctx context.Context) ([]*Record, error)
+	Insert(ctx context.Context, product *Product, userID int64) error
+	Update(ctx context.Context, product *Product, userID int64) error
+	GetUserWatchList(ctx context.Context, userID int64) ([]*Record, error)
+	// RemoveFromWatchList stops the user from watching the product, deleting it with its history when nobody else
+	// watches it. It returns ErrNotFound if the user doesn't watch the product.
+	RemoveFromWatchList(ctx context.Context, link string, userID int64) error
+	SetAlertRule(ctx context.Context, link string, userID int64, rule AlertRule) error
+
+	AppendPrice(ctx context.Context, link string, point PricePoint) error
+	PriceHistory(ctx context.Context, link string, from, to time.Time) ([]PricePoint, error)
+	TrimHistory(ctx context.Context, link string, before time.Time) error
+
+	// EnqueueNotification adds a notification to the outbox, assigning its ID.
+	EnqueueNotification(ctx context.Context, n *Notification) error
+	// PendingNotifications returns the notifications of the outbox due by the given time, in the order they were enqueued.
+	PendingNotifications(ctx context.Context, by time.Time) ([]*Notification, error)
+	// SaveNotification updates the attempts, the due time and the delivered channels of a notification in the outbox.
+	SaveNotification(ctx context.Context, n *Notification) error
+	// DeleteNotification removes a notification from the outbox, it's a no-op if it's not there.
+	DeleteNotification(ctx context.Context, id uint64) error
+
+	// GetUser returns the settings of a user, or ErrNotFound if they were never saved.
+	GetUser(ctx context.Context, id int64) (*User, error)
+	SaveUser(ctx context.Context, u *User) error
+	// GetUserByAPIToken returns the user with the given APIToken hash, ErrNotFound if there's none.
+	GetUserByAPIToken(ctx context.Context, hash string) (*User, error)
+
+	// Ping checks that the store is open and can be written.
+	Ping(ctx context.Context) error
+	Close() error
+}
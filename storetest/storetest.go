@@ -0,0 +1,403 @@
+// Package storetest provides a test suite shared by the watchazon.Store implementations.
+package storetest
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/giornetta/watchazon"
+)
+
+// Run runs the store test suite, calling open to get a new empty store for each test.
+func Run(t *testing.T, open func(t *testing.T) watchazon.Store) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s watchazon.Store)
+	}{
+		{"InsertGet", testInsertGet},
+		{"Update", testUpdate},
+		{"WatchList", testWatchList},
+		{"RemoveNotWatched", testRemoveNotWatched},
+		{"AlertRule", testAlertRule},
+		{"PriceHistory", testPriceHistory},
+		{"Outbox", testOutbox},
+		{"User", testUser},
+		{"Ping", testPing},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, open(t))
+		})
+	}
+}
+
+const (
+	echoDot = "https://www.amazon.it/dp/B07PHPXHQS"
+	miBand  = "https://www.amazon.com/dp/B07GNGJK97"
+)
+
+var checkedAt = time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC)
+
+func product(link string, price int64) *watchazon.Product {
+	return &watchazon.Product{
+		Title:        "Product " + link,
+		Image:        "https://m.media-amazon.com/images/I/product.jpg",
+		Link:         link,
+		Price:        eur(price),
+		Availability: watchazon.LowStock,
+		StockLeft:    3,
+		CheckedAt:    checkedAt,
+	}
+}
+
+func eur(amount int64) watchazon.Money {
+	return watchazon.Money{Amount: amount, Currency: "EUR"}
+}
+
+func testInsertGet(t *testing.T, s watchazon.Store) {
+	ctx := context.Background()
+
+	if _, err := s.Get(ctx, echoDot); !errors.Is(err, watchazon.ErrNotFound) {
+		t.Errorf("Get() on missing product error = %v, want %v", err, watchazon.ErrNotFound)
+	}
+
+	want := product(echoDot, 5999)
+	if err := s.Insert(ctx, want, 1); err != nil {
+		t.Fatalf("could not insert product: %v", err)
+	}
+	if err := s.Insert(ctx, want, 2); !errors.Is(err, watchazon.ErrAlreadyExists) {
+		t.Errorf("Insert() on existing product error = %v, want %v", err, watchazon.ErrAlreadyExists)
+	}
+
+	got, err := s.Get(ctx, echoDot)
+	if err != nil {
+		t.Fatalf("could not get product: %v", err)
+	}
+	if got.Title != want.Title || got.Image != want.Image || got.Price != want.Price ||
+		got.Availability != want.Availability || got.StockLeft != want.StockLeft || !got.CheckedAt.Equal(want.CheckedAt) {
+		t.Errorf("Get() got = %+v, want %+v", got.Product, want)
+	}
+	if len(got.Users) != 1 || got.Users[0] != 1 {
+		t.Errorf("Get() got users = %v, want [1]", got.Users)
+	}
+}
+
+func testUpdate(t *testing.T, s watchazon.Store) {
+	ctx := context.Background()
+
+	if err := s.Update(ctx, product(echoDot, 5999), 1); !errors.Is(err, watchazon.ErrNotFound) {
+		t.Errorf("Update() on missing product error = %v, want %v", err, watchazon.ErrNotFound)
+	}
+
+	if err := s.Insert(ctx, product(echoDot, 5999), 1); err != nil {
+		t.Fatalf("could not insert product: %v", err)
+	}
+	if err := s.Update(ctx, product(echoDot, 4999), 0); err != nil {
+		t.Fatalf("could not update product: %v", err)
+	}
+	failed := product(echoDot, 3999)
+	failed.Failure = "captcha page"
+	failed.FailedChecks = 2
+	failed.NextCheckAt = checkedAt.Add(time.Hour)
+	if err := s.Update(ctx, failed, 2); err != nil {
+		t.Fatalf("could not update product: %v", err)
+	}
+
+	got, err := s.Get(ctx, echoDot)
+	if err != nil {
+		t.Fatalf("could not get product: %v", err)
+	}
+	if got.Price != eur(3999) || got.Failure != failed.Failure || got.FailedChecks != 2 || !got.NextCheckAt.Equal(failed.NextCheckAt) {
+		t.Errorf("Get() got price = %v, failure %q after %d checks and next check at %v, want 39.99 €, %q after 2 and %v",
+			got.Price, got.Failure, got.FailedChecks, got.NextCheckAt, failed.Failure, failed.NextCheckAt)
+	}
+	if len(got.Users) != 2 || got.Users[0] != 1 || got.Users[1] != 2 {
+		t.Errorf("Get() got users = %v, want [1 2]", got.Users)
+	}
+
+	all, err := s.GetAll(ctx)
+	if err != nil {
+		t.Fatalf("could not get all products: %v", err)
+	}
+	if len(all) != 1 {
+		t.Errorf("GetAll() got %d records, want 1", len(all))
+	}
+}
+
+func testWatchList(t *testing.T, s watchazon.Store) {
+	ctx := context.Background()
+
+	if err := s.Insert(ctx, product(echoDot, 5999), 1); err != nil {
+		t.Fatalf("could not insert product: %v", err)
+	}
+	if err := s.Insert(ctx, product(miBand, 2898), 1); err != nil {
+		t.Fatalf("could not insert product: %v", err)
+	}
+	if err := s.Update(ctx, product(miBand, 2898), 2); err != nil {
+		t.Fatalf("could not update product: %v", err)
+	}
+
+	assertWatchList(t, s, 1, echoDot, miBand)
+	assertWatchList(t, s, 2, miBand)
+
+	if err := s.RemoveFromWatchList(ctx, miBand, 1); err != nil {
+		t.Fatalf("could not remove product: %v", err)
+	}
+	assertWatchList(t, s, 1, echoDot)
+	assertWatchList(t, s, 2, miBand)
+
+	if err := s.RemoveFromWatchList(ctx, miBand, 2); err != nil {
+		t.Fatalf("could not remove product: %v", err)
+	}
+	if _, err := s.Get(ctx, miBand); !errors.Is(err, watchazon.ErrNotFound) {
+		t.Errorf("Get() on unwatched product error = %v, want %v", err, watchazon.ErrNotFound)
+	}
+}
+
+func testRemoveNotWatched(t *testing.T, s watchazon.Store) {
+	ctx := context.Background()
+
+	if err := s.Insert(ctx, product(echoDot, 5999), 1); err != nil {
+		t.Fatalf("could not insert product: %v", err)
+	}
+
+	if err := s.RemoveFromWatchList(ctx, echoDot, 2); !errors.Is(err, watchazon.ErrNotFound) {
+		t.Errorf("RemoveFromWatchList() of a product the user doesn't watch error = %v, want %v", err, watchazon.ErrNotFound)
+	}
+	if err := s.RemoveFromWatchList(ctx, miBand, 1); !errors.Is(err, watchazon.ErrNotFound) {
+		t.Errorf("RemoveFromWatchList() of a missing product error = %v, want %v", err, watchazon.ErrNotFound)
+	}
+	assertWatchList(t, s, 1, echoDot)
+}
+
+func testAlertRule(t *testing.T, s watchazon.Store) {
+	ctx := context.Background()
+
+	if err := s.Insert(ctx, product(echoDot, 6000), 1); err != nil {
+		t.Fatalf("could not insert product: %v", err)
+	}
+	if err := s.Update(ctx, product(echoDot, 5000), 2); err != nil {
+		t.Fatalf("could not update product: %v", err)
+	}
+
+	rule := watchazon.AlertRule{Kind: watchazon.AlertPercentDrop, Percent: 10}
+	if err := s.SetAlertRule(ctx, echoDot, 2, rule); err != nil {
+		t.Fatalf("could not set alert rule: %v", err)
+	}
+	if err := s.SetAlertRule(ctx, echoDot, 3, rule); !errors.Is(err, watchazon.ErrNotFound) {
+		t.Errorf("SetAlertRule() for a user not watching error = %v, want %v", err, watchazon.ErrNotFound)
+	}
+
+	got, err := s.Get(ctx, echoDot)
+	if err != nil {
+		t.Fatalf("could not get product: %v", err)
+	}
+	if r := got.Rule(1); r.Kind != watchazon.AlertAnyChange || r.BasePrice != eur(6000) {
+		t.Errorf("Rule(1) got = %+v, want default rule with base price 60", r)
+	}
+	if r := got.Rule(2); r.Kind != watchazon.AlertPercentDrop || r.Percent != 10 || r.BasePrice != eur(5000) {
+		t.Errorf("Rule(2) got = %+v, want 10%% drop from 50", r)
+	}
+}
+
+func testPriceHistory(t *testing.T, s watchazon.Store) {
+	ctx := context.Background()
+
+	if err := s.Insert(ctx, product(echoDot, 1000), 1); err != nil {
+		t.Fatalf("could not insert product: %v", err)
+	}
+	for i := 4; i >= 0; i-- {
+		err := s.AppendPrice(ctx, echoDot, watchazon.PricePoint{
+			Price:     eur(int64(1000 + 100*i)),
+			CheckedAt: checkedAt.Add(time.Duration(i) * time.Hour),
+		})
+		if err != nil {
+			t.Fatalf("could not append price: %v", err)
+		}
+	}
+
+	got, err := s.PriceHistory(ctx, echoDot, checkedAt.Add(time.Hour), checkedAt.Add(3*time.Hour))
+	if err != nil {
+		t.Fatalf("could not get history: %v", err)
+	}
+	if len(got) != 2 || got[0].Price != eur(1100) || got[1].Price != eur(1200) || !got[0].CheckedAt.Equal(checkedAt.Add(time.Hour)) {
+		t.Errorf("PriceHistory() got = %v, want prices 11 and 12", got)
+	}
+
+	if err := s.TrimHistory(ctx, echoDot, checkedAt.Add(2*time.Hour)); err != nil {
+		t.Fatalf("could not trim history: %v", err)
+	}
+	got, err = s.PriceHistory(ctx, echoDot, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("could not get history: %v", err)
+	}
+	if len(got) != 3 || got[0].Price != eur(1200) {
+		t.Errorf("PriceHistory() after trim got = %v, want 3 points starting at 12", got)
+	}
+
+	if err := s.RemoveFromWatchList(ctx, echoDot, 1); err != nil {
+		t.Fatalf("could not remove product: %v", err)
+	}
+	got, err = s.PriceHistory(ctx, echoDot, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("could not get history: %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("PriceHistory() after removal got = %v, want none", got)
+	}
+}
+
+func testOutbox(t *testing.T, s watchazon.Store) {
+	ctx := context.Background()
+
+	first := &watchazon.Notification{Product: product(echoDot, 4999), Previous: product(echoDot, 5999), UserID: 1}
+	second := &watchazon.Notification{Product: product(miBand, 2898), UserID: 2}
+	for _, n := range []*watchazon.Notification{first, second} {
+		if err := s.EnqueueNotification(ctx, n); err != nil {
+			t.Fatalf("could not enqueue notification: %v", err)
+		}
+	}
+	if first.ID == 0 || second.ID == 0 || first.ID == second.ID {
+		t.Fatalf("EnqueueNotification() assigned IDs %d and %d, want distinct non-zero ones", first.ID, second.ID)
+	}
+
+	got, err := s.PendingNotifications(ctx, checkedAt)
+	if err != nil {
+		t.Fatalf("could not get pending notifications: %v", err)
+	}
+	if len(got) != 2 || got[0].ID != first.ID || got[1].ID != second.ID {
+		t.Fatalf("PendingNotifications() got = %v, want %d and %d", got, first.ID, second.ID)
+	}
+	if got[0].UserID != 1 || got[0].Product.Price != eur(4999) || got[0].Previous == nil || got[0].Previous.Price != eur(5999) {
+		t.Errorf("PendingNotifications() got = %+v, want %+v", got[0], first)
+	}
+	if got[1].Previous != nil {
+		t.Errorf("PendingNotifications() got previous = %+v, want none", got[1].Previous)
+	}
+
+	first.Attempts = 1
+	first.DueAt = checkedAt.Add(time.Hour)
+	first.Delivered = []string{watchazon.ChannelTelegram}
+	if err := s.SaveNotification(ctx, first); err != nil {
+		t.Fatalf("could not save notification: %v", err)
+	}
+	if err := s.DeleteNotification(ctx, second.ID); err != nil {
+		t.Fatalf("could not delete notification: %v", err)
+	}
+
+	got, err = s.PendingNotifications(ctx, checkedAt)
+	if err != nil {
+		t.Fatalf("could not get pending notifications: %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("PendingNotifications() before the retry got = %v, want none", got)
+	}
+
+	got, err = s.PendingNotifications(ctx, checkedAt.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("could not get pending notifications: %v", err)
+	}
+	if len(got) != 1 || got[0].ID != first.ID || got[0].Attempts != 1 || !got[0].DueAt.Equal(first.DueAt) {
+		t.Fatalf("PendingNotifications() at the retry got = %v, want %+v", got, first)
+	}
+	if !reflect.DeepEqual(got[0].Delivered, first.Delivered) {
+		t.Errorf("PendingNotifications() at the retry got delivered = %v, want %v", got[0].Delivered, first.Delivered)
+	}
+}
+
+func testUser(t *testing.T, s watchazon.Store) {
+	ctx := context.Background()
+
+	if _, err := s.GetUser(ctx, 1); !errors.Is(err, watchazon.ErrNotFound) {
+		t.Errorf("GetUser() on missing user error = %v, want %v", err, watchazon.ErrNotFound)
+	}
+
+	want := &watchazon.User{ID: 1, Channels: []string{watchazon.ChannelTelegram, watchazon.ChannelEmail}, Email: "user@example.com", Webhook: "https://example.com/hook"}
+	if err := s.SaveUser(ctx, want); err != nil {
+		t.Fatalf("could not save user: %v", err)
+	}
+	got, err := s.GetUser(ctx, 1)
+	if err != nil {
+		t.Fatalf("could not get user: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetUser() got = %+v, want %+v", got, want)
+	}
+
+	want.Channels = []string{watchazon.ChannelEmail}
+	if err := s.SaveUser(ctx, want); err != nil {
+		t.Fatalf("could not save user: %v", err)
+	}
+	got, err = s.GetUser(ctx, 1)
+	if err != nil {
+		t.Fatalf("could not get user: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetUser() after update got = %+v, want %+v", got, want)
+	}
+
+	if _, err := s.GetUserByAPIToken(ctx, ""); !errors.Is(err, watchazon.ErrNotFound) {
+		t.Errorf("GetUserByAPIToken() without a token error = %v, want %v", err, watchazon.ErrNotFound)
+	}
+
+	want.APIToken = "first"
+	if err := s.SaveUser(ctx, want); err != nil {
+		t.Fatalf("could not save user: %v", err)
+	}
+	want.APIToken = "second"
+	if err := s.SaveUser(ctx, want); err != nil {
+		t.Fatalf("could not save user: %v", err)
+	}
+	if _, err := s.GetUserByAPIToken(ctx, "first"); !errors.Is(err, watchazon.ErrNotFound) {
+		t.Errorf("GetUserByAPIToken() with a replaced token error = %v, want %v", err, watchazon.ErrNotFound)
+	}
+	got, err = s.GetUserByAPIToken(ctx, "second")
+	if err != nil {
+		t.Fatalf("could not get user by token: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetUserByAPIToken() got = %+v, want %+v", got, want)
+	}
+}
+
+func assertWatchList(t *testing.T, s watchazon.Store, userID int64, want ...string) {
+	ctx := context.Background()
+
+	t.Helper()
+
+	got, err := s.GetUserWatchList(ctx, userID)
+	if err != nil {
+		t.Fatalf("could not get watchlist: %v", err)
+	}
+
+	if len(got) != len(want) {
+		t.Errorf("GetUserWatchList(%d) got %d records, want %v", userID, len(got), want)
+		return
+	}
+
+	links := make(map[string]bool)
+	for _, r := range got {
+		links[r.Link] = true
+	}
+	for _, l := range want {
+		if !links[l] {
+			t.Errorf("GetUserWatchList(%d) is missing %s", userID, l)
+		}
+	}
+}
+
+func testPing(t *testing.T, s watchazon.Store) {
+	ctx := context.Background()
+
+	if err := s.Ping(ctx); err != nil {
+		t.Fatalf("Ping() error = %v", err)
+	}
+
+	// Pinging leaves no trace among the records.
+	if records, err := s.GetAll(ctx); err != nil || len(records) != 0 {
+		t.Errorf("GetAll() after Ping() = %v, %v, want no records", records, err)
+	}
+}
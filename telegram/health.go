@@ -0,0 +1,71 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pollTimeout is how long each request for updates waits for one to arrive.
+const pollTimeout = 10 * time.Second
+
+// pollTransport makes the requests to the Bot API, remembering how the latest requests for updates went.
+type pollTransport struct {
+	next http.RoundTripper
+
+	mu sync.Mutex
+	// since is when polling is known to be down from, the creation of the bot before any request.
+	since   time.Time
+	lastOK  time.Time
+	lastErr string
+}
+
+func (t *pollTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if !strings.HasSuffix(req.URL.Path, "/getUpdates") {
+		return resp, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch {
+	case err != nil:
+		t.lastErr = err.Error()
+	case resp.StatusCode >= http.StatusMultipleChoices:
+		t.lastErr = resp.Status
+	default:
+		t.lastOK, t.lastErr = time.Now(), ""
+	}
+	return resp, err
+}
+
+// Health reports whether the bot is receiving the updates from Telegram, failing when no request for them
+// succeeded for a few poll timeouts.
+func (b *Bot) Health(ctx context.Context) (map[string]interface{}, error) {
+	t := b.poll
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	detail := map[string]interface{}{
+		"username": b.Username(),
+	}
+	if !t.lastOK.IsZero() {
+		detail["last_poll"] = t.lastOK.Format(time.RFC3339)
+	}
+	if t.lastErr != "" {
+		detail["last_error"] = t.lastErr
+	}
+
+	since := t.lastOK
+	if since.IsZero() {
+		since = t.since
+	}
+	if time.Since(since) > 3*pollTimeout {
+		return detail, fmt.Errorf("no updates received since %s", since.Format(time.RFC3339))
+	}
+	return detail, nil
+}
@@ -1,13 +1,18 @@
 package telegram
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/giornetta/watchazon"
+	"github.com/giornetta/watchazon/chart"
 
 	telebot "gopkg.in/telebot.v3"
 )
@@ -16,31 +21,63 @@ type Bot struct {
 	telegram *telebot.Bot
 	service  watchazon.Service
 	locator  watchazon.Locator
+	// ctx is canceled by Stop, interrupting the requests to the service made by the updates in progress.
+	ctx    context.Context
+	cancel context.CancelFunc
+	// poll tells whether the updates are being received, for Health.
+	poll *pollTransport
 }
 
 func New(token string, svc watchazon.Service, loc watchazon.Locator) (*Bot, error) {
+	poll := &pollTransport{next: http.DefaultTransport, since: time.Now()}
 	b, err := telebot.NewBot(telebot.Settings{
-		Token:  token,
-		Poller: &telebot.LongPoller{Timeout: 10 * time.Second},
+		Token:   token,
+		Poller:  &telebot.LongPoller{Timeout: pollTimeout},
+		Client:  &http.Client{Timeout: time.Minute, Transport: poll},
+		OnError: onError,
 	})
 	if err != nil {
 		return nil, err
 	}
 
+	ctx, cancel := context.WithCancel(context.Background())
 	return &Bot{
 		telegram: b,
 		service:  svc,
 		locator:  loc,
+		ctx:      ctx,
+		cancel:   cancel,
+		poll:     poll,
 	}, nil
 }
 
+// onError logs the errors returned by the handlers, and the ones of the poller for which c is nil.
+func onError(err error, c telebot.Context) {
+	if c == nil || c.Sender() == nil {
+		slog.Error("telegram error", "error", err)
+		return
+	}
+	slog.Error("could not handle update", "user_id", c.Sender().ID, "update_id", c.Update().ID, "error", err)
+}
+
+// Username returns the username of the bot, without the @.
+func (b *Bot) Username() string {
+	return b.telegram.Me.Username
+}
+
 func (b *Bot) Stop() {
+	b.cancel()
 	b.telegram.Stop()
 }
 
 func (b *Bot) Run() {
 	b.telegram.Handle("/start", b.handleStart)
 	b.telegram.Handle("/list", b.handleList)
+	b.telegram.Handle("/alert", b.handleAlert)
+	b.telegram.Handle("/email", b.handleEmail)
+	b.telegram.Handle("/notify", b.handleNotify)
+	b.telegram.Handle("/webhook", b.handleWebhook)
+	b.telegram.Handle("/token", b.handleToken)
 	b.telegram.Handle(telebot.OnText, b.handleWatch)
 
 	b.telegram.Handle(telebot.OnCallback, telebot.HandlerFunc(func(ctx telebot.Context) error {
@@ -49,7 +86,7 @@ func (b *Bot) Run() {
 		if strings.Contains(data, "DELETE") {
 			link := data[8:]
 
-			err := b.service.RemoveFromWatchList(link, ctx.Sender().ID)
+			err := b.service.RemoveFromWatchList(b.ctx, link, ctx.Sender().ID)
 			if err != nil {
 				return fmt.Errorf("could not remove user %d from product %s: %v", ctx.Sender().ID, link, err)
 			}
@@ -59,8 +96,19 @@ func (b *Bot) Run() {
 			_ = ctx.Respond(&telebot.CallbackResponse{
 				Text: "Successfully Removed!",
 			})
-		} else if strings.Contains(data, "OPEN") {
-			fmt.Println("ciao")
+		} else if strings.Contains(data, "HISTORY") {
+			return b.handleHistory(ctx, data[9:])
+		} else if strings.Contains(data, "RESTOCK") {
+			link := data[9:]
+
+			err := b.service.SetAlertRule(b.ctx, link, ctx.Sender().ID, watchazon.AlertRule{Kind: watchazon.AlertBackInStock})
+			if err != nil {
+				return fmt.Errorf("could not set restock alert for user %d on product %s: %v", ctx.Sender().ID, link, err)
+			}
+
+			return ctx.Respond(&telebot.CallbackResponse{
+				Text: "🔔 You will be notified when it's back in stock!",
+			})
 		}
 
 		return ctx.Respond(&telebot.CallbackResponse{})
@@ -68,25 +116,79 @@ func (b *Bot) Run() {
 
 	b.telegram.Handle(telebot.OnQuery, b.handleQuery)
 
-	go b.telegram.Start()
+	b.telegram.Start()
+}
 
-	format := "🔥 A product in your watchlist has changed price!\n\n<b>📦 Product:</b> %s\n<b>💵 Price:</b> %.2f €\n<b>🕛 Last check:</b> %s"
-	for n := range b.service.Listen() {
-		msg := fmt.Sprintf(format, n.Product.Title, n.Product.Price, n.Product.FormattedTime())
-		_, _ = b.telegram.Send(sendableUser(n.UserID), msg, &telebot.SendOptions{
-			ReplyMarkup: &telebot.ReplyMarkup{
-				InlineKeyboard: [][]telebot.InlineButton{
-					{
-						telebot.InlineButton{
-							Text: "✔️ Go to Amazon! ✔️",
-							URL:  n.Product.Link,
-						},
+var _ watchazon.Notifier = (*Bot)(nil)
+
+// ErrNotTelegramUser is returned when notifying a user who isn't on Telegram.
+var ErrNotTelegramUser = errors.New("not a telegram user")
+
+// Notify sends the notification to its user as a Telegram message.
+func (b *Bot) Notify(ctx context.Context, n *watchazon.Notification) error {
+	// The users of the other platforms are stored with IDs that aren't positive.
+	if n.UserID <= 0 {
+		return ErrNotTelegramUser
+	}
+
+	title := "🔥 A product in your watchlist has changed price!"
+	if n.BackInStock() {
+		title = "🎉 A product in your watchlist is back in stock!"
+	}
+
+	format := "%s\n\n<b>📦 Product:</b> %s\n<b>💵 Price:</b> %s\n<b>🏷 Availability:</b> %s\n<b>🕛 Last check:</b> %s"
+	text := fmt.Sprintf(format, title, n.Product.Title, n.Product.Price, n.Product.FormattedAvailability(), n.Product.FormattedTime())
+
+	// The chart is only worth sending if it shows a change.
+	var msg interface{} = text
+	if png, points, err := b.historyChart(ctx, n.Product.Link); err == nil && points > 1 {
+		msg = &telebot.Photo{File: telebot.FromReader(bytes.NewReader(png)), Caption: text}
+	}
+
+	_, err := b.telegram.Send(sendableUser(n.UserID), msg, &telebot.SendOptions{
+		ReplyMarkup: &telebot.ReplyMarkup{
+			InlineKeyboard: [][]telebot.InlineButton{
+				{
+					telebot.InlineButton{
+						Text: "✔️ Go to Amazon! ✔️",
+						URL:  n.Product.Link,
 					},
 				},
 			},
-			ParseMode: "HTML",
-		})
+		},
+		ParseMode: "HTML",
+	})
+	return err
+}
+
+// chartWindow is how far back the history charts go.
+const chartWindow = 90 * 24 * time.Hour
+
+// historyChart returns the chart of the recent prices of the product, along with how many prices it shows.
+func (b *Bot) historyChart(ctx context.Context, link string) ([]byte, int, error) {
+	points, err := b.service.PriceHistory(ctx, link, time.Now().Add(-chartWindow))
+	if err != nil {
+		return nil, 0, err
 	}
+
+	png, err := chart.Render(points, chart.DefaultWidth, chart.DefaultHeight)
+	return png, len(points), err
+}
+
+func (b *Bot) handleHistory(ctx telebot.Context, link string) error {
+	png, _, err := b.historyChart(b.ctx, link)
+	if errors.Is(err, chart.ErrNoHistory) {
+		return ctx.Respond(&telebot.CallbackResponse{Text: "There's no price history yet!"})
+	}
+	if err != nil {
+		return fmt.Errorf("could not render history of %s: %v", link, err)
+	}
+
+	_ = ctx.Respond(&telebot.CallbackResponse{})
+	return ctx.Send(&telebot.Photo{
+		File:    telebot.FromReader(bytes.NewReader(png)),
+		Caption: fmt.Sprintf("📈 Price history of the last %d days", chartWindow/(24*time.Hour)),
+	})
 }
 
 func (b *Bot) handleStart(ctx telebot.Context) error {
@@ -119,16 +221,30 @@ func (b *Bot) handleWatch(ctx telebot.Context) error {
 
 	_ = ctx.Send("🔄 Adding your product...")
 
-	err := b.service.AddToWatchList(ctx.Text(), ctx.Sender().ID)
+	product, err := b.service.AddToWatchList(b.ctx, ctx.Text(), ctx.Sender().ID)
 	if err != nil {
 		return ctx.Send(err.Error())
 	}
 
+	if !product.Availability.Purchasable() {
+		return ctx.Send("✅ Product successfully added to the watchlist, but it's currently out of stock!", &telebot.ReplyMarkup{
+			InlineKeyboard: [][]telebot.InlineButton{
+				{
+					{
+						Unique: "RESTOCK",
+						Text:   "🔔 Notify me when back in stock",
+						Data:   product.Link,
+					},
+				},
+			},
+		})
+	}
+
 	return ctx.Send("✅ Product successfully added to the watchlist!")
 }
 
 func (b *Bot) handleList(ctx telebot.Context) error {
-	products, err := b.service.GetUserWatchList(ctx.Sender().ID)
+	products, err := b.service.GetUserWatchList(b.ctx, ctx.Sender().ID)
 	if err != nil {
 		return ctx.Send("An error occurred! Sorry!")
 	}
@@ -137,9 +253,14 @@ func (b *Bot) handleList(ctx telebot.Context) error {
 		return ctx.Send("There are no products in your watchlist!")
 	}
 
-	msgFormat := "<b>📦 Product:</b> %s\n<b>💵 Price:</b> %.2f €\n<b>🕛 Last check:</b> %s"
+	msgFormat := "<b>📦 Product:</b> %s\n<b>💵 Price:</b> %s\n<b>🏷 Availability:</b> %s\n<b>🕛 Last check:</b> %s"
 	for _, p := range products {
-		err := ctx.Send(fmt.Sprintf(msgFormat, p.Title, p.Price, p.FormattedTime()), &telebot.SendOptions{
+		msg := fmt.Sprintf(msgFormat, p.Title, p.Price, p.FormattedAvailability(), p.FormattedTime())
+		if p.Failure != "" {
+			msg += fmt.Sprintf("\n<b>⚠️ Last check failed:</b> %s", p.Failure)
+		}
+
+		err := ctx.Send(msg, &telebot.SendOptions{
 			ReplyMarkup: &telebot.ReplyMarkup{
 				InlineKeyboard: [][]telebot.InlineButton{
 					{
@@ -148,6 +269,11 @@ func (b *Bot) handleList(ctx telebot.Context) error {
 							Text:   "❌ Delete! ❌",
 							Data:   p.Link,
 						},
+						telebot.InlineButton{
+							Unique: "HISTORY",
+							Text:   "📈 History",
+							Data:   p.Link,
+						},
 					},
 					{
 						telebot.InlineButton{
@@ -160,13 +286,135 @@ func (b *Bot) handleList(ctx telebot.Context) error {
 			ParseMode: "HTML",
 		})
 		if err != nil {
-			log.Println(err)
+			slog.Error("could not send watchlist product", "link", p.Link, "user_id", ctx.Sender().ID, "error", err)
 		}
 	}
 
 	return nil
 }
 
+const alertUsage = `Usage: /alert <link> <rule>
+
+Rules:
+<b>any</b> - notify every price change
+<b>down</b> - notify only when the price decreases
+<b>49.99</b> - notify when the price drops to 49.99 or less
+<b>-10%</b> - notify when the price drops by 10% from when you started watching
+<b>stock</b> - notify only when the product is back in stock
+<b>off</b> - same as <b>any</b>`
+
+func (b *Bot) handleAlert(ctx telebot.Context) error {
+	args := ctx.Args()
+	if len(args) != 2 {
+		return ctx.Send(alertUsage, telebot.ModeHTML)
+	}
+
+	rule, err := watchazon.ParseAlertRule(args[1])
+	if err != nil {
+		return ctx.Send(alertUsage, telebot.ModeHTML)
+	}
+
+	if rule.Kind == watchazon.AlertAnyChange {
+		err = b.service.ClearAlertRule(b.ctx, args[0], ctx.Sender().ID)
+	} else {
+		err = b.service.SetAlertRule(b.ctx, args[0], ctx.Sender().ID, rule)
+	}
+	if err != nil {
+		return ctx.Send(err.Error())
+	}
+
+	return ctx.Send(fmt.Sprintf("🔔 You will be notified on %s!", rule))
+}
+
+const emailUsage = `Usage: /email <address>
+
+Sets the address email notifications are sent to, enable them with /notify.
+Use <b>/email off</b> to remove it.`
+
+func (b *Bot) handleEmail(ctx telebot.Context) error {
+	args := ctx.Args()
+	if len(args) != 1 {
+		return ctx.Send(emailUsage, telebot.ModeHTML)
+	}
+
+	address := args[0]
+	if strings.ToLower(address) == "off" {
+		address = ""
+	}
+
+	if err := b.service.SetEmail(b.ctx, ctx.Sender().ID, address); err != nil {
+		return ctx.Send(err.Error())
+	}
+
+	if address == "" {
+		return ctx.Send("📭 Email address removed!")
+	}
+	return ctx.Send(fmt.Sprintf("📬 Email address set to %s! Use /notify to receive notifications there.", address))
+}
+
+const webhookUsage = `Usage: /webhook <url>
+
+Sets the URL webhook notifications are posted to, enable them with /notify.
+Use <b>/webhook off</b> to remove it.`
+
+func (b *Bot) handleWebhook(ctx telebot.Context) error {
+	args := ctx.Args()
+	if len(args) != 1 {
+		return ctx.Send(webhookUsage, telebot.ModeHTML)
+	}
+
+	url := args[0]
+	if strings.ToLower(url) == "off" {
+		url = ""
+	}
+
+	if err := b.service.SetWebhook(b.ctx, ctx.Sender().ID, url); err != nil {
+		return ctx.Send(err.Error())
+	}
+
+	if url == "" {
+		return ctx.Send("🔌 Webhook removed!")
+	}
+	return ctx.Send(fmt.Sprintf("🔌 Webhook set to %s! Use /notify to receive notifications there.", url))
+}
+
+func (b *Bot) handleToken(ctx telebot.Context) error {
+	token, err := b.service.NewAPIToken(b.ctx, ctx.Sender().ID)
+	if err != nil {
+		return ctx.Send(err.Error())
+	}
+
+	return ctx.Send(fmt.Sprintf("🔑 Your API token is <code>%s</code>\n\nKeep it secret, it won't be shown again! Any previous token no longer works.", token), telebot.ModeHTML)
+}
+
+const notifyUsage = `Usage: /notify <channel>...
+
+Channels:
+<b>telegram</b> - notifications are sent here
+<b>email</b> - notifications are sent to the address set with /email
+<b>webhook</b> - notifications are posted to the URL set with /webhook
+<b>discord</b> - notifications are sent as direct messages by the Discord bot
+
+Currently: <b>%s</b>`
+
+func (b *Bot) handleNotify(ctx telebot.Context) error {
+	u, err := b.service.Settings(b.ctx, ctx.Sender().ID)
+	if err != nil {
+		return ctx.Send(err.Error())
+	}
+
+	args := ctx.Args()
+	if len(args) == 0 {
+		return ctx.Send(fmt.Sprintf(notifyUsage, strings.Join(u.NotificationChannels(), ", ")), telebot.ModeHTML)
+	}
+
+	if err := b.service.SetChannels(b.ctx, ctx.Sender().ID, args); err != nil {
+		return ctx.Send(err.Error())
+	}
+
+	return ctx.Send(fmt.Sprintf("🔔 You will be notified through %s!", strings.Join(args, ", ")))
+}
+
 func (b *Bot) handleQuery(ctx telebot.Context) error {
 	q := ctx.Query()
 
@@ -176,16 +424,14 @@ func (b *Bot) handleQuery(ctx telebot.Context) error {
 	if q.Location != nil {
 		loc, err = b.locator.Locate(q.Location.Lat, q.Location.Lng)
 	} else {
-		loc = "com"
+		loc = watchazon.DefaultDomain
 	}
 	if err != nil {
-		log.Println(err)
-		loc = "com"
+		slog.Warn("could not locate user, searching the default marketplace", "user_id", q.Sender.ID, "error", err)
+		loc = watchazon.DefaultDomain
 	}
-	fmt.Println(loc)
-	products, err := b.service.Search(q.Text, loc)
+	products, err := b.service.Search(b.ctx, q.Text, loc)
 	if err != nil {
-		log.Println(err)
 		return err
 	}
 
@@ -201,7 +447,7 @@ func (b *Bot) handleQuery(ctx telebot.Context) error {
 			Text:        p.Link,
 			URL:         p.Link,
 			HideURL:     false,
-			Description: fmt.Sprintf("%.2f€", p.Price),
+			Description: searchDescription(p),
 			ThumbURL:    p.Image,
 		}
 
@@ -213,14 +459,22 @@ func (b *Bot) handleQuery(ctx telebot.Context) error {
 		Results:   tgRes,
 		CacheTime: 60, // a minute
 	}); err != nil {
-		fmt.Println(err)
 		return err
 	}
 
-	log.Printf("User %d looked for %s: %d results sent", q.Sender.ID, q.Text, l)
+	slog.Info("search results sent", "user_id", q.Sender.ID, "query", q.Text, "domain", loc, "results", l)
 	return nil
 }
 
+// searchDescription returns the description of a search result, showing its price or why it can't be bought.
+func searchDescription(p *watchazon.Product) string {
+	if !p.Availability.Purchasable() {
+		return p.FormattedAvailability()
+	}
+
+	return p.Price.String()
+}
+
 type recipient int
 
 func (r recipient) Recipient() string {
@@ -0,0 +1,42 @@
+package watchazon
+
+import "context"
+
+// Channels through which notifications can be delivered.
+const (
+	ChannelTelegram = "telegram"
+	ChannelEmail    = "email"
+	ChannelWebhook  = "webhook"
+	ChannelDiscord  = "discord"
+)
+
+// DefaultChannels are the channels of the users who didn't choose any.
+var DefaultChannels = []string{ChannelTelegram}
+
+// A User contains the notification settings of a user.
+type User struct {
+	// ID is the one of the Telegram user, positive, or the negated snowflake of the Discord user,
+	// so that the users of the two platforms can't collide.
+	ID int64
+	// Channels are the ones the user receives notifications through, DefaultChannels if empty.
+	Channels []string
+	// Email is the address notifications are sent to through ChannelEmail.
+	Email string
+	// Webhook is the URL notifications are posted to through ChannelWebhook, the global one is used if empty.
+	Webhook string
+	// APIToken is the SHA-256 hash, hex encoded, of the token the user authenticates to the API with.
+	APIToken string
+}
+
+// NotificationChannels returns the channels the user receives notifications through.
+func (u *User) NotificationChannels() []string {
+	if len(u.Channels) == 0 {
+		return DefaultChannels
+	}
+	return u.Channels
+}
+
+// Notifier delivers notifications to users through a channel.
+type Notifier interface {
+	Notify(ctx context.Context, n *Notification) error
+}
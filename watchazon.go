@@ -1,17 +1,81 @@
 package watchazon
 
-import "time"
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
 
-// A Domain represents a top-level-domain (e.g. com, es, it...) for an Amazon website.
+// A Domain is the host suffix of an Amazon website following "amazon." (e.g. com, it, co.uk...).
 type Domain string
 
+// Availability is the stock status of a product.
+type Availability int
+
+const (
+	// AvailabilityUnknown is used for products whose stock status could not be parsed.
+	AvailabilityUnknown Availability = iota
+	InStock
+	// LowStock means only Product.StockLeft items can still be bought.
+	LowStock
+	PreOrder
+	// OutOfStock means the product is temporarily out of stock, but will be restocked.
+	OutOfStock
+	// Unavailable means the product can't be bought and it's unknown if it will ever be back.
+	Unavailable
+)
+
+// Purchasable reports whether a product with the availability can be bought.
+// Products whose availability is unknown are considered purchasable.
+func (a Availability) Purchasable() bool {
+	return a != OutOfStock && a != Unavailable
+}
+
+func (a Availability) String() string {
+	switch a {
+	case InStock:
+		return "In stock"
+	case LowStock:
+		return "Low stock"
+	case PreOrder:
+		return "Pre-order"
+	case OutOfStock:
+		return "Out of stock"
+	case Unavailable:
+		return "Unavailable"
+	default:
+		return "Unknown"
+	}
+}
+
 // A Product represents the data collected for each Amazon product.
 type Product struct {
-	Title     string
-	Image     string
-	Link      string
-	Price     float64
+	Title        string
+	Image        string
+	Link         string
+	Price        Money
+	Availability Availability
+	// StockLeft is the number of items left when Availability is LowStock.
+	StockLeft int
+	// CheckedAt is the time of the last successful check of the product.
 	CheckedAt time.Time
+	// Failure is why the last check of the product failed, and it's empty if it succeeded.
+	Failure string
+	// FailedChecks is how many checks in a row failed.
+	FailedChecks int
+	// NextCheckAt is when the product is due to be checked again, zero if it was never scheduled.
+	NextCheckAt time.Time
+}
+
+// FormattedAvailability returns the stock status of the product in a human readable way.
+func (p Product) FormattedAvailability() string {
+	if p.Availability == LowStock {
+		return fmt.Sprintf("Only %d left", p.StockLeft)
+	}
+
+	return p.Availability.String()
 }
 
 // Formatted time returns the time of the last check for the product, formatted in a nice way.
@@ -19,20 +83,194 @@ func (p Product) FormattedTime() string {
 	return p.CheckedAt.Format("2 Jan 2006 at 15:04")
 }
 
+// A PricePoint is the price of a product observed at a given time.
+type PricePoint struct {
+	Price     Money
+	CheckedAt time.Time
+}
+
+// LowestPrice returns the point with the lowest price among the given ones, and false if there are none.
+func LowestPrice(points []PricePoint) (PricePoint, bool) {
+	if len(points) == 0 {
+		return PricePoint{}, false
+	}
+
+	lowest := points[0]
+	for _, p := range points[1:] {
+		if p.Price.Amount < lowest.Price.Amount {
+			lowest = p
+		}
+	}
+
+	return lowest, true
+}
+
+// HighestPrice returns the point with the highest price among the given ones, and false if there are none.
+func HighestPrice(points []PricePoint) (PricePoint, bool) {
+	if len(points) == 0 {
+		return PricePoint{}, false
+	}
+
+	highest := points[0]
+	for _, p := range points[1:] {
+		if p.Price.Amount > highest.Price.Amount {
+			highest = p
+		}
+	}
+
+	return highest, true
+}
+
+// AlertKind defines which price changes of a product are notified to a user.
+type AlertKind int
+
+const (
+	// AlertAnyChange notifies every price change, it's the rule used when none has been set.
+	AlertAnyChange AlertKind = iota
+	// AlertTargetPrice notifies when the price changes to a value lower or equal to AlertRule.Target.
+	AlertTargetPrice
+	// AlertPercentDrop notifies when the price drops by at least AlertRule.Percent from AlertRule.BasePrice.
+	AlertPercentDrop
+	// AlertAnyDecrease notifies every price decrease, ignoring increases.
+	AlertAnyDecrease
+	// AlertBackInStock notifies when the product can be bought again after being out of stock or unavailable.
+	AlertBackInStock
+)
+
+// An AlertRule is attached to each user watching a product and decides whether a price change must be notified.
+type AlertRule struct {
+	Kind    AlertKind
+	Target  Money
+	Percent float64
+	// BasePrice is the price of the product when the user subscribed to it.
+	BasePrice Money
+}
+
+// Matches reports whether the change from old to new must be notified according to the rule.
+func (r AlertRule) Matches(old, new *Product) bool {
+	if r.Kind == AlertBackInStock {
+		return BackInStock(old, new)
+	}
+
+	// Products without a price are out of stock, their price is meaningless.
+	if new.Price.IsZero() || old.Price == new.Price {
+		return false
+	}
+
+	switch r.Kind {
+	case AlertTargetPrice:
+		return new.Price.Amount <= r.Target.Amount
+	case AlertPercentDrop:
+		base := r.BasePrice
+		if base.IsZero() {
+			base = old.Price
+		}
+		return float64(new.Price.Amount) <= float64(base.Amount)*(1-r.Percent/100)
+	case AlertAnyDecrease:
+		return new.Price.Amount < old.Price.Amount
+	default:
+		return true
+	}
+}
+
+// String returns a human readable description of the rule.
+func (r AlertRule) String() string {
+	switch r.Kind {
+	case AlertTargetPrice:
+		return fmt.Sprintf("price at or below %s", r.Target)
+	case AlertPercentDrop:
+		return fmt.Sprintf("price dropped by %.0f%%", r.Percent)
+	case AlertAnyDecrease:
+		return "any price decrease"
+	case AlertBackInStock:
+		return "product back in stock"
+	default:
+		return "any price change"
+	}
+}
+
+// ParseAlertRule parses a rule as written by users: any, down, stock, a target price (e.g. 49.99)
+// or a percent drop (e.g. -10%). Off is the same as any.
+// The currency of target prices is left empty, it's the one of the product the rule is set on.
+func ParseAlertRule(s string) (AlertRule, error) {
+	switch strings.ToLower(s) {
+	case "any", "off":
+		return AlertRule{Kind: AlertAnyChange}, nil
+	case "down":
+		return AlertRule{Kind: AlertAnyDecrease}, nil
+	case "stock":
+		return AlertRule{Kind: AlertBackInStock}, nil
+	}
+
+	if strings.HasPrefix(s, "-") && strings.HasSuffix(s, "%") {
+		percent, err := strconv.ParseFloat(strings.Trim(s, "-%"), 64)
+		if err != nil {
+			return AlertRule{}, err
+		}
+		return AlertRule{Kind: AlertPercentDrop, Percent: percent}, nil
+	}
+
+	target, err := ParseMoney(strings.Replace(s, ",", ".", 1), "")
+	if err != nil {
+		return AlertRule{}, err
+	}
+	return AlertRule{Kind: AlertTargetPrice, Target: target}, nil
+}
+
+// BackInStock reports whether the product can be bought again after being out of stock or unavailable.
+func BackInStock(old, new *Product) bool {
+	return !old.Availability.Purchasable() && new.Availability.Purchasable()
+}
+
 // Notification is used to represent which user has to receive a notification on a specific product.
 type Notification struct {
+	// ID identifies the notification in the outbox, it's assigned when the notification is enqueued.
+	ID      uint64
 	Product *Product
-	UserID  int64
+	// Previous is the product as it was before the change that caused the notification.
+	Previous *Product
+	UserID   int64
+
+	// Attempts is how many deliveries of the notification failed.
+	Attempts int
+	// Delivered are the channels the notification was already delivered through, which its retries skip.
+	Delivered []string
+	// DueAt is when the notification has to be delivered (again), it's zero for new ones.
+	DueAt time.Time
+}
+
+// BackInStock reports whether the notification is about the product being purchasable again.
+func (n *Notification) BackInStock() bool {
+	return n.Previous != nil && BackInStock(n.Previous, n.Product)
 }
 
 // Service defines the required methods of the Bot.
 type Service interface {
-	AddToWatchList(link string, userID int64) error
-	RemoveFromWatchList(link string, userID int64) error
-	GetUserWatchList(user int64) ([]*Product, error)
-	Search(query string, domain Domain) ([]*Product, error)
-	Update() error
-	Listen() <-chan *Notification
+	AddToWatchList(ctx context.Context, link string, userID int64) (*Product, error)
+	RemoveFromWatchList(ctx context.Context, link string, userID int64) error
+	SetAlertRule(ctx context.Context, link string, userID int64, rule AlertRule) error
+	ClearAlertRule(ctx context.Context, link string, userID int64) error
+	AlertRule(ctx context.Context, link string, userID int64) (AlertRule, error)
+	GetUserWatchList(ctx context.Context, user int64) ([]*Product, error)
+	Search(ctx context.Context, query string, domain Domain) ([]*Product, error)
+	PriceHistory(ctx context.Context, link string, since time.Time) ([]PricePoint, error)
+	// Settings returns the notification settings of the user.
+	Settings(ctx context.Context, userID int64) (*User, error)
+	// SetEmail changes the address email notifications are sent to, disabling them if empty.
+	SetEmail(ctx context.Context, userID int64, address string) error
+	// SetChannels changes the channels the user receives notifications through.
+	SetChannels(ctx context.Context, userID int64, channels []string) error
+	// SetWebhook changes the URL webhook notifications are posted to, using the global one if empty.
+	SetWebhook(ctx context.Context, userID int64, url string) error
+	// NewAPIToken returns a new token to access the API as the user, revoking the previous one.
+	NewAPIToken(ctx context.Context, userID int64) (string, error)
+	// Authenticate returns the user an API token belongs to.
+	Authenticate(ctx context.Context, token string) (int64, error)
+	// Listen returns the notifications to deliver, each of which must be acknowledged with Ack.
+	// The channel is closed once ctx is done.
+	Listen(ctx context.Context) <-chan *Notification
+	// Ack reports the outcome of the delivery of a notification: failed ones are delivered again later.
+	Ack(ctx context.Context, n *Notification, err error)
 }
 
 // Locator is used to decide which local version of the Amazon website must be scraped based on the user's location.
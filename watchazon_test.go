@@ -0,0 +1,86 @@
+package watchazon
+
+import "testing"
+
+func TestAlertRule_Matches(t *testing.T) {
+	tests := []struct {
+		name string
+		rule AlertRule
+		old  int64
+		new  int64
+		want bool
+	}{
+		{"Any change", AlertRule{}, 1000, 1001, true},
+		{"Any change, same price", AlertRule{}, 1000, 1000, false},
+		{"Decrease", AlertRule{Kind: AlertAnyDecrease}, 1000, 999, true},
+		{"Decrease, increased", AlertRule{Kind: AlertAnyDecrease}, 1000, 1001, false},
+		{"Target reached", AlertRule{Kind: AlertTargetPrice, Target: eur(5000)}, 5500, 5000, true},
+		{"Target not reached", AlertRule{Kind: AlertTargetPrice, Target: eur(5000)}, 5500, 5001, false},
+		{"Percent reached", AlertRule{Kind: AlertPercentDrop, Percent: 10, BasePrice: eur(10000)}, 9500, 9000, true},
+		{"Percent not reached", AlertRule{Kind: AlertPercentDrop, Percent: 10, BasePrice: eur(10000)}, 9500, 9001, false},
+		{"Percent without base", AlertRule{Kind: AlertPercentDrop, Percent: 10}, 10000, 9000, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.rule.Matches(&Product{Price: eur(tt.old)}, &Product{Price: eur(tt.new)})
+			if got != tt.want {
+				t.Errorf("Matches() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAlertRule_Matches_Availability(t *testing.T) {
+	outOfStock := &Product{Availability: OutOfStock}
+	inStock := &Product{Price: eur(1000), Availability: InStock}
+
+	tests := []struct {
+		name     string
+		rule     AlertRule
+		old, new *Product
+		want     bool
+	}{
+		{"Back in stock", AlertRule{Kind: AlertBackInStock}, outOfStock, inStock, true},
+		{"Still in stock", AlertRule{Kind: AlertBackInStock}, inStock, &Product{Price: eur(900), Availability: InStock}, false},
+		{"Gone out of stock", AlertRule{Kind: AlertBackInStock}, inStock, outOfStock, false},
+		{"Price rule, gone out of stock", AlertRule{}, inStock, outOfStock, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rule.Matches(tt.old, tt.new); got != tt.want {
+				t.Errorf("Matches() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func eur(amount int64) Money {
+	return Money{Amount: amount, Currency: "EUR"}
+}
+
+func TestParseAlertRule(t *testing.T) {
+	tests := []struct {
+		arg     string
+		want    AlertRule
+		wantErr bool
+	}{
+		{"off", AlertRule{Kind: AlertAnyChange}, false},
+		{"DOWN", AlertRule{Kind: AlertAnyDecrease}, false},
+		{"stock", AlertRule{Kind: AlertBackInStock}, false},
+		{"-10%", AlertRule{Kind: AlertPercentDrop, Percent: 10}, false},
+		{"49,99", AlertRule{Kind: AlertTargetPrice, Target: Money{Amount: 4999}}, false},
+		{"-x%", AlertRule{}, true},
+		{"cheap", AlertRule{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			got, err := ParseAlertRule(tt.arg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseAlertRule() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseAlertRule() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
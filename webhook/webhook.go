@@ -0,0 +1,261 @@
+// Package webhook delivers notifications as signed JSON payloads posted to a URL.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/giornetta/watchazon"
+)
+
+// SignatureHeader carries the hex encoded HMAC-SHA256 of the body, keyed with the secret and prefixed by "sha256=".
+const SignatureHeader = "X-Watchazon-Signature"
+
+// DeliveryHeader carries the ID of the notification, which is the same across retries.
+const DeliveryHeader = "X-Watchazon-Delivery"
+
+const (
+	// DefaultRetries is how many times a failed delivery is retried.
+	DefaultRetries = 3
+	// DefaultBackoff is the wait before the first retry, doubled at each one.
+	DefaultBackoff = 5 * time.Second
+)
+
+// ErrNoURL is returned when notifying a user without a webhook if there's no global one either.
+var ErrNoURL = errors.New("no webhook url")
+
+// Users gives access to the webhooks of the users.
+type Users interface {
+	GetUser(ctx context.Context, id int64) (*watchazon.User, error)
+}
+
+// A Payload is the body posted for each notification.
+type Payload struct {
+	ID          uint64    `json:"id"`
+	UserID      int64     `json:"user_id"`
+	Product     Product   `json:"product"`
+	OldPrice    *Price    `json:"old_price"`
+	NewPrice    *Price    `json:"new_price"`
+	BackInStock bool      `json:"back_in_stock"`
+	SentAt      time.Time `json:"sent_at"`
+}
+
+type Product struct {
+	Title        string    `json:"title"`
+	Link         string    `json:"link"`
+	Image        string    `json:"image,omitempty"`
+	Availability string    `json:"availability"`
+	CheckedAt    time.Time `json:"checked_at"`
+}
+
+// A Price is expressed in the minor units of its currency, e.g. cents, and formatted for display.
+type Price struct {
+	Amount    int64  `json:"amount"`
+	Currency  string `json:"currency"`
+	Formatted string `json:"formatted"`
+}
+
+// Notifier posts the notifications to the webhook of their user, or to the global one.
+// Failed deliveries are retried with exponential backoff, and then written to the dead-letter log.
+type Notifier struct {
+	// URL is the global webhook, used for the users who didn't set their own.
+	URL string
+	// Secret is the key of the signature of the payloads.
+	Secret string
+	// Client posts to the global webhook.
+	Client *http.Client
+	// UserClient posts to the webhooks of the users, which can't reach the addresses of the local network.
+	UserClient *http.Client
+	Retries    int
+	Backoff    time.Duration
+	// DeadLetter receives a JSON line for each notification that could not be delivered.
+	DeadLetter io.Writer
+
+	users Users
+	mu    sync.Mutex
+}
+
+var _ watchazon.Notifier = (*Notifier)(nil)
+
+// New returns a Notifier with the default retry settings, writing the failed deliveries to deadLetter.
+func New(url, secret string, users Users, deadLetter io.Writer) *Notifier {
+	return &Notifier{
+		URL:        url,
+		Secret:     secret,
+		Client:     &http.Client{Timeout: 10 * time.Second},
+		UserClient: publicClient(10 * time.Second),
+		Retries:    DefaultRetries,
+		Backoff:    DefaultBackoff,
+		DeadLetter: deadLetter,
+		users:      users,
+	}
+}
+
+// Notify delivers the notification, writing it to the dead-letter log if all the attempts fail or the
+// deadline of ctx expires first. Such failures are only reported if the dead-letter log can't be written, so that the
+// notification isn't delivered through this channel again.
+func (w *Notifier) Notify(ctx context.Context, n *watchazon.Notification) error {
+	url, client, err := w.target(ctx, n.UserID)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(NewPayload(n))
+	if err != nil {
+		return err
+	}
+
+	err = w.deliver(ctx, client, url, n.ID, body)
+	if err == nil {
+		return nil
+	}
+	// Deliveries canceled by a shutdown, rather than timed out, are left to the retries of the outbox.
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return err
+	}
+
+	slog.Warn("could not deliver webhook, dead-lettering it", "notification_id", n.ID, "user_id", n.UserID, "url", url, "error", err)
+	return w.deadLetter(url, body, err)
+}
+
+// target returns the webhook of the user, or the global one if it didn't set any, with the client posting to it.
+func (w *Notifier) target(ctx context.Context, userID int64) (string, *http.Client, error) {
+	u, err := w.users.GetUser(ctx, userID)
+	if err != nil && !errors.Is(err, watchazon.ErrNotFound) {
+		return "", nil, fmt.Errorf("could not get settings of %d: %w", userID, err)
+	}
+	if u != nil && u.Webhook != "" {
+		return u.Webhook, w.UserClient, nil
+	}
+	if w.URL == "" {
+		return "", nil, ErrNoURL
+	}
+	return w.URL, w.Client, nil
+}
+
+// deliver posts the body, retrying on network errors, server errors and rate limiting.
+// The retries that would start after the deadline of ctx are given up.
+func (w *Notifier) deliver(ctx context.Context, client *http.Client, url string, id uint64, body []byte) error {
+	var err error
+	for attempt := 0; attempt <= w.Retries; attempt++ {
+		if attempt > 0 {
+			wait := w.Backoff << (attempt - 1)
+			if deadline, ok := ctx.Deadline(); ok && time.Now().Add(wait).After(deadline) {
+				return err
+			}
+
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		var retry bool
+		if retry, err = w.post(ctx, client, url, id, body); !retry {
+			return err
+		}
+	}
+	return err
+}
+
+// post makes a single delivery attempt, reporting whether it can be retried if it failed.
+func (w *Notifier) post(ctx context.Context, client *http.Client, url string, id uint64, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(DeliveryHeader, strconv.FormatUint(id, 10))
+	req.Header.Set(SignatureHeader, Sign(w.Secret, body))
+
+	res, err := client.Do(req)
+	if errors.Is(err, ErrForbiddenAddress) {
+		return false, err
+	}
+	if err != nil {
+		return true, err
+	}
+	_, _ = io.Copy(io.Discard, res.Body)
+	_ = res.Body.Close()
+
+	switch {
+	case res.StatusCode >= 200 && res.StatusCode < 300:
+		return false, nil
+	case res.StatusCode >= 500 || res.StatusCode == http.StatusTooManyRequests:
+		return true, fmt.Errorf("webhook responded %s", res.Status)
+	default:
+		return false, fmt.Errorf("webhook responded %s", res.Status)
+	}
+}
+
+// deadLetter appends an undelivered payload to the dead-letter log.
+func (w *Notifier) deadLetter(url string, body []byte, cause error) error {
+	line, err := json.Marshal(struct {
+		Time    time.Time       `json:"time"`
+		URL     string          `json:"url"`
+		Error   string          `json:"error"`
+		Payload json.RawMessage `json:"payload"`
+	}{time.Now(), url, cause.Error(), body})
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, err := w.DeadLetter.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("could not write dead letter: %v: %w", err, cause)
+	}
+	return nil
+}
+
+// Sign returns the value of SignatureHeader for body.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// NewPayload returns the payload of the notification.
+func NewPayload(n *watchazon.Notification) Payload {
+	p := Payload{
+		ID:     n.ID,
+		UserID: n.UserID,
+		Product: Product{
+			Title:        n.Product.Title,
+			Link:         n.Product.Link,
+			Image:        n.Product.Image,
+			Availability: n.Product.FormattedAvailability(),
+			CheckedAt:    n.Product.CheckedAt,
+		},
+		NewPrice:    price(n.Product.Price),
+		BackInStock: n.BackInStock(),
+		SentAt:      time.Now(),
+	}
+	if n.Previous != nil {
+		p.OldPrice = price(n.Previous.Price)
+	}
+
+	return p
+}
+
+// price returns the price of the payload, nil for products without a price.
+func price(m watchazon.Money) *Price {
+	if m.IsZero() {
+		return nil
+	}
+	return &Price{Amount: m.Amount, Currency: m.Currency, Formatted: m.String()}
+}
@@ -0,0 +1,171 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/giornetta/watchazon"
+	"github.com/giornetta/watchazon/memory"
+)
+
+func notification() *watchazon.Notification {
+	return &watchazon.Notification{
+		ID:       7,
+		UserID:   1,
+		Product:  &watchazon.Product{Title: "Echo Dot", Link: "https://www.amazon.it/dp/B07PHPXHQS", Price: watchazon.Money{Amount: 4999, Currency: "EUR"}},
+		Previous: &watchazon.Product{Price: watchazon.Money{Amount: 5999, Currency: "EUR"}},
+	}
+}
+
+func TestNotifier_Notify(t *testing.T) {
+	tests := []struct {
+		name       string
+		failures   int32
+		status     int
+		wantCalls  int32
+		deadLetter bool
+	}{
+		{"Success", 0, http.StatusServiceUnavailable, 1, false},
+		{"Retried", 2, http.StatusServiceUnavailable, 3, false},
+		{"Too many failures", 10, http.StatusInternalServerError, 4, true},
+		{"Rejected", 10, http.StatusBadRequest, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				if got, want := r.Header.Get(SignatureHeader), Sign("secret", body); got != want {
+					t.Errorf("Notify() got signature %q, want %q", got, want)
+				}
+				if got := r.Header.Get(DeliveryHeader); got != "7" {
+					t.Errorf("Notify() got delivery %q, want 7", got)
+				}
+
+				var p Payload
+				if err := json.Unmarshal(body, &p); err != nil {
+					t.Errorf("Notify() posted invalid payload: %v", err)
+				}
+				if p.UserID != 1 || p.NewPrice == nil || p.NewPrice.Amount != 4999 || p.OldPrice == nil || p.OldPrice.Amount != 5999 {
+					t.Errorf("Notify() posted payload %+v", p)
+				}
+
+				if atomic.AddInt32(&calls, 1) <= tt.failures {
+					w.WriteHeader(tt.status)
+				}
+			}))
+			defer server.Close()
+
+			var deadLetter bytes.Buffer
+			w := New(server.URL, "secret", memory.New(), &deadLetter)
+			w.Backoff = time.Millisecond
+
+			if err := w.Notify(context.Background(), notification()); err != nil {
+				t.Fatalf("Notify() error = %v", err)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("Notify() made %d requests, want %d", calls, tt.wantCalls)
+			}
+			if got := deadLetter.Len() > 0; got != tt.deadLetter {
+				t.Errorf("Notify() wrote dead letter %q, want %v", deadLetter.String(), tt.deadLetter)
+			}
+			if tt.deadLetter && !strings.Contains(deadLetter.String(), `"amount":4999`) {
+				t.Errorf("Notify() dead letter %q doesn't contain the payload", deadLetter.String())
+			}
+		})
+	}
+}
+
+func TestNotifier_Notify_UserURL(t *testing.T) {
+	var global, own int32
+	globalServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { atomic.AddInt32(&global, 1) }))
+	defer globalServer.Close()
+	ownServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { atomic.AddInt32(&own, 1) }))
+	defer ownServer.Close()
+
+	users := memory.New()
+	if err := users.SaveUser(context.Background(), &watchazon.User{ID: 1, Webhook: ownServer.URL}); err != nil {
+		t.Fatalf("SaveUser() error = %v", err)
+	}
+
+	w := New(globalServer.URL, "secret", users, io.Discard)
+	// The test servers listen on loopback, which the webhooks of the users can't reach.
+	w.UserClient = http.DefaultClient
+	for _, id := range []int64{1, 2} {
+		n := notification()
+		n.UserID = id
+		if err := w.Notify(context.Background(), n); err != nil {
+			t.Fatalf("Notify() error = %v", err)
+		}
+	}
+
+	if own != 1 || global != 1 {
+		t.Errorf("Notify() posted %d times to the user webhook and %d to the global one, want 1 and 1", own, global)
+	}
+
+	if err := New("", "secret", memory.New(), io.Discard).Notify(context.Background(), notification()); err != ErrNoURL {
+		t.Errorf("Notify() without urls error = %v, want %v", err, ErrNoURL)
+	}
+}
+
+func TestNotifier_Notify_ForbiddenAddress(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { atomic.AddInt32(&calls, 1) }))
+	defer server.Close()
+
+	users := memory.New()
+	if err := users.SaveUser(context.Background(), &watchazon.User{ID: 1, Webhook: server.URL}); err != nil {
+		t.Fatalf("SaveUser() error = %v", err)
+	}
+
+	var deadLetter bytes.Buffer
+	w := New("", "secret", users, &deadLetter)
+	w.Backoff = time.Millisecond
+	if err := w.Notify(context.Background(), notification()); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	if calls != 0 {
+		t.Errorf("Notify() made %d requests to a loopback webhook of a user, want none", calls)
+	}
+	if !strings.Contains(deadLetter.String(), ErrForbiddenAddress.Error()) {
+		t.Errorf("Notify() wrote dead letter %q, want it forbidden", deadLetter.String())
+	}
+}
+
+func TestNotifier_Notify_Deadline(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	var deadLetter bytes.Buffer
+	w := New(server.URL, "secret", memory.New(), &deadLetter)
+	w.Backoff = time.Hour
+
+	// The retry would start after the deadline, so the payload is dead-lettered right away.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	start := time.Now()
+	if err := w.Notify(ctx, notification()); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Notify() took %v, want it to give up the retries past the deadline", elapsed)
+	}
+	if calls != 1 {
+		t.Errorf("Notify() made %d requests, want 1", calls)
+	}
+	if !strings.Contains(deadLetter.String(), "503") {
+		t.Errorf("Notify() wrote dead letter %q, want the last failure", deadLetter.String())
+	}
+}